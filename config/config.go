@@ -2,15 +2,19 @@ package config
 
 import (
 	"log"
+	"strings"
 
 	"github.com/spf13/viper"
 )
 
 type Config struct {
-	Mode     string
-	Port     string
-	Database DatabaseConfig
-	JWT      JWTConfig
+	Mode           string
+	Port           string
+	TrustedProxies []string // 受信任的反向代理地址或网段，只有来自这些地址的请求才采用 X-Forwarded-For 中的客户端IP
+	Database       DatabaseConfig
+	JWT            JWTConfig
+	SMS            SMSConfig
+	Storage        StorageConfig
 }
 
 type DatabaseConfig struct {
@@ -23,8 +27,35 @@ type DatabaseConfig struct {
 }
 
 type JWTConfig struct {
-	Secret string
-	Expire int
+	Secret        string
+	Expire        int // 访问令牌有效期（小时）
+	RefreshExpire int // 刷新令牌有效期（小时）
+	Issuer        string
+	Audience      string
+	ActiveKeyID   string   // 当前用于签发令牌的密钥ID
+	Keys          []JWTKey // 轮换期内可同时生效的多个密钥
+}
+
+// JWTKey 签名密钥，通过 kid 区分
+type JWTKey struct {
+	ID     string `mapstructure:"id"`
+	Secret string `mapstructure:"secret"`
+}
+
+// SMSConfig 短信发送配置
+type SMSConfig struct {
+	Provider string // log：仅写入日志（验证码打码）；file：追加写入文件，供开发和测试读取验证码；生产模式下均不可用
+	FilePath string
+}
+
+// StorageConfig 上传文件存储配置
+type StorageConfig struct {
+	Provider          string // local：存储在本地目录
+	LocalDir          string
+	SignSecret        string // 文件访问链接签名密钥，未配置时使用 JWT 密钥
+	URLExpireMinutes  int    // 文件访问链接有效期（分钟）
+	ThumbnailMaxPixel int    // 缩略图最长边像素
+	MaxImagePixels    int    // 上传图片允许的最大像素数（宽×高），超过的图片拒绝上传
 }
 
 var AppConfig *Config
@@ -38,6 +69,7 @@ func LoadConfig() {
 	// 设置默认值
 	viper.SetDefault("mode", "debug")
 	viper.SetDefault("port", "8080")
+	viper.SetDefault("trusted_proxies", "")
 	viper.SetDefault("database.host", "localhost")
 	viper.SetDefault("database.port", "3306")
 	viper.SetDefault("database.username", "root")
@@ -46,6 +78,17 @@ func LoadConfig() {
 	viper.SetDefault("database.charset", "utf8mb4")
 	viper.SetDefault("jwt.secret", "tangsong-esports-secret-key")
 	viper.SetDefault("jwt.expire", 24)
+	viper.SetDefault("jwt.refresh_expire", 168)
+	viper.SetDefault("jwt.issuer", "tangsong-esports")
+	viper.SetDefault("jwt.audience", "tangsong-esports-api")
+	viper.SetDefault("jwt.active_key_id", "default")
+	viper.SetDefault("sms.provider", "log")
+	viper.SetDefault("sms.file_path", "logs/sms.log")
+	viper.SetDefault("storage.provider", "local")
+	viper.SetDefault("storage.local_dir", "uploads")
+	viper.SetDefault("storage.url_expire_minutes", 30)
+	viper.SetDefault("storage.thumbnail_max_pixel", 320)
+	viper.SetDefault("storage.max_image_pixels", 40000000)
 
 	// 支持环境变量
 	viper.AutomaticEnv()
@@ -54,9 +97,15 @@ func LoadConfig() {
 		log.Println("配置文件读取失败，使用默认配置:", err)
 	}
 
+	var jwtKeys []JWTKey
+	if err := viper.UnmarshalKey("jwt.keys", &jwtKeys); err != nil {
+		log.Println("JWT密钥配置解析失败:", err)
+	}
+
 	AppConfig = &Config{
-		Mode: viper.GetString("mode"),
-		Port: viper.GetString("port"),
+		Mode:           viper.GetString("mode"),
+		Port:           viper.GetString("port"),
+		TrustedProxies: splitList(viper.GetString("trusted_proxies")),
 		Database: DatabaseConfig{
 			Host:     viper.GetString("database.host"),
 			Port:     viper.GetString("database.port"),
@@ -66,8 +115,36 @@ func LoadConfig() {
 			Charset:  viper.GetString("database.charset"),
 		},
 		JWT: JWTConfig{
-			Secret: viper.GetString("jwt.secret"),
-			Expire: viper.GetInt("jwt.expire"),
+			Secret:        viper.GetString("jwt.secret"),
+			Expire:        viper.GetInt("jwt.expire"),
+			RefreshExpire: viper.GetInt("jwt.refresh_expire"),
+			Issuer:        viper.GetString("jwt.issuer"),
+			Audience:      viper.GetString("jwt.audience"),
+			ActiveKeyID:   viper.GetString("jwt.active_key_id"),
+			Keys:          jwtKeys,
+		},
+		SMS: SMSConfig{
+			Provider: viper.GetString("sms.provider"),
+			FilePath: viper.GetString("sms.file_path"),
+		},
+		Storage: StorageConfig{
+			Provider:          viper.GetString("storage.provider"),
+			LocalDir:          viper.GetString("storage.local_dir"),
+			SignSecret:        viper.GetString("storage.sign_secret"),
+			URLExpireMinutes:  viper.GetInt("storage.url_expire_minutes"),
+			ThumbnailMaxPixel: viper.GetInt("storage.thumbnail_max_pixel"),
+			MaxImagePixels:    viper.GetInt("storage.max_image_pixels"),
 		},
 	}
 }
+
+// splitList 解析逗号分隔的配置项，忽略空白项
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
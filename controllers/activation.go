@@ -0,0 +1,126 @@
+package controllers
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"tangsong-esports/database"
+	"tangsong-esports/models"
+	"tangsong-esports/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 激活码长度，约50位熵，配合登录限流足以抵御猜测
+const activationCodeLength = 10
+
+var errActivationCodeInvalid = errors.New("激活码无效或已过期")
+
+// activationSettings 读取激活码有效期和链接地址
+func activationSettings() (time.Duration, string) {
+	ttl := 72 * time.Hour
+	var baseURL string
+
+	var configs []models.SystemConfig
+	database.DB.Where("config_key IN ? AND is_active = ?",
+		[]string{"customer_activation_code_hours", "customer_activation_url"}, true).Find(&configs)
+	for _, cfg := range configs {
+		switch cfg.ConfigKey {
+		case "customer_activation_code_hours":
+			if hours, err := strconv.Atoi(cfg.ConfigValue); err == nil && hours > 0 {
+				ttl = time.Duration(hours) * time.Hour
+			}
+		case "customer_activation_url":
+			baseURL = cfg.ConfigValue
+		}
+	}
+	return ttl, baseURL
+}
+
+// issueActivationCode 为客户生成一次性激活码，同时作废该客户尚未使用的旧码
+func issueActivationCode(tx *gorm.DB, customer *models.Customer, purpose string, operatorID uint) (*models.ActivationCodeResponse, error) {
+	code, err := utils.RandomCode(activationCodeLength)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if err := tx.Model(&models.CustomerActivationCode{}).
+		Where("customer_id = ? AND used_at IS NULL AND revoked_at IS NULL", customer.CustomerID).
+		Update("revoked_at", now).Error; err != nil {
+		return nil, err
+	}
+
+	ttl, baseURL := activationSettings()
+	record := models.CustomerActivationCode{
+		CustomerID: customer.CustomerID,
+		Purpose:    purpose,
+		CodeHash:   utils.HashOneTimeCode(code),
+		ExpiresAt:  now.Add(ttl),
+		CreatedBy:  operatorID,
+	}
+	if err := tx.Create(&record).Error; err != nil {
+		return nil, err
+	}
+
+	response := &models.ActivationCodeResponse{
+		Purpose:   purpose,
+		Code:      code,
+		ExpiresAt: record.ExpiresAt,
+	}
+	if baseURL != "" {
+		params := url.Values{}
+		params.Set("account", customer.Account)
+		params.Set("code", code)
+		response.Link = baseURL + "?" + params.Encode()
+	}
+	return response, nil
+}
+
+// consumeActivationCode 校验并使用激活码，成功后该码失效并记录使用信息
+func consumeActivationCode(tx *gorm.DB, c *gin.Context, customerID uint, code string) error {
+	now := time.Now()
+	result := tx.Model(&models.CustomerActivationCode{}).
+		Where("customer_id = ? AND code_hash = ? AND used_at IS NULL AND revoked_at IS NULL AND expires_at > ?",
+			customerID, utils.HashOneTimeCode(code), now).
+		Updates(map[string]interface{}{
+			"used_at":         now,
+			"used_ip":         c.ClientIP(),
+			"used_user_agent": c.GetHeader("User-Agent"),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected != 1 {
+		return errActivationCodeInvalid
+	}
+	return nil
+}
+
+// GetCustomerActivationCodes 获取客户激活码记录
+// @Summary 获取客户激活码记录
+// @Description 查看客户激活码/重置码的生成与使用记录，用于审计
+// @Tags 客户管理
+// @Accept json
+// @Produce json
+// @Param id path int true "客户ID"
+// @Success 200 {object} models.Response{data=[]models.CustomerActivationCode}
+// @Router /api/v1/customers/{id}/activation-codes [get]
+func GetCustomerActivationCodes(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.Error(c, "无效的客户ID")
+		return
+	}
+
+	var codes []models.CustomerActivationCode
+	if err := database.DB.Preload("Creator").Where("customer_id = ?", id).
+		Order("created_at DESC").Find(&codes).Error; err != nil {
+		utils.Error(c, "查询激活码记录失败")
+		return
+	}
+
+	utils.Success(c, codes)
+}
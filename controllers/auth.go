@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"errors"
 	"log"
 	"tangsong-esports/database"
 	"tangsong-esports/models"
@@ -17,7 +18,9 @@ import (
 // @Accept json
 // @Produce json
 // @Param login body models.LoginRequest true "登录信息"
-// @Success 200 {object} models.Response{data=models.LoginResponse}
+// @Success 200 {object} models.Response{data=models.AuthTokenResponse} "登录成功"
+// @Success 200 {object} models.Response{data=models.TwoFactorChallengeResponse} "需要两步验证"
+// @Success 200 {object} models.Response{data=models.PasswordChangeChallengeResponse} "需要先修改密码"
 // @Router /api/v1/login [post]
 func Login(c *gin.Context) {
 	var req models.LoginRequest
@@ -26,72 +29,96 @@ func Login(c *gin.Context) {
 		return
 	}
 
+	// 账号或IP处于锁定期时直接拒绝
+	ip := c.ClientIP()
+	if remaining := loginLockedFor(utils.SubjectStaff, req.Account, ip); remaining > 0 {
+		utils.TooManyRequests(c, loginLockedMessage(remaining))
+		return
+	}
+
 	// 查找用户
 	var member models.InternalMember
 	result := database.DB.Where("account = ?", req.Account).First(&member)
 	if result.Error != nil {
-		utils.Error(c, "账号或密码错误")
+		log.Printf("[Login] 账号不存在: %s (IP: %s)", req.Account, ip)
+		loginFailed(c, utils.SubjectStaff, req.Account, "账号或密码错误")
 		return
 	}
 
 	// 验证密码
 	if !utils.CheckPassword(req.Password, member.PasswordHash) {
-		utils.Error(c, "账号或密码错误")
+		recordMemberLogin(c, member.MemberID, models.LoginStatusFailed, models.LoginFailWrongPassword)
+		loginFailed(c, utils.SubjectStaff, req.Account, "账号或密码错误")
 		return
 	}
 
 	// 检查账户状态
 	if member.Status != "正常" {
+		recordMemberLogin(c, member.MemberID, models.LoginStatusFailed, models.LoginFailDisabled)
 		utils.Error(c, "账户已被禁用")
 		return
 	}
 
 	if !member.IsEnabled {
+		recordMemberLogin(c, member.MemberID, models.LoginStatusFailed, models.LoginFailNotEnabled)
 		utils.Error(c, "账户未启用")
 		return
 	}
 
-	// 生成JWT令牌
-	token, err := utils.GenerateToken(member.MemberID, member.Account, member.UserRole)
-	if err != nil {
-		log.Printf("[Login] 生成访问令牌失败: %v", err)
-		utils.Error(c, "生成令牌失败")
+	// 使用默认密码或被要求改密时，先返回改密挑战，由 /login/change-password 继续登录
+	if member.MustChangePassword {
+		respondPasswordChangeChallenge(c, &member)
 		return
 	}
 
-	// 生成刷新令牌
-	refreshToken, err := utils.GenerateRefreshToken(member.MemberID, member.Account, member.UserRole)
+	continueStaffLogin(c, &member)
+}
+
+// continueStaffLogin 密码校验通过后的后续步骤：需要两步验证时返回挑战，否则直接完成登录
+func continueStaffLogin(c *gin.Context, member *models.InternalMember) {
+	// 已启用两步验证或角色要求两步验证时，先返回登录挑战，由 /login/2fa 完成登录
+	if member.TOTPEnabled || twoFactorRequired(member.UserRole) {
+		respondTwoFactorChallenge(c, member)
+		return
+	}
+
+	completeStaffLogin(c, member, nil)
+}
+
+// completeStaffLogin 创建会话并签发令牌，完成内部成员登录
+func completeStaffLogin(c *gin.Context, member *models.InternalMember, recoveryCodes []string) {
+	// 创建服务端会话
+	session, err := createSession(c, utils.SubjectStaff, member.MemberID)
 	if err != nil {
-		log.Printf("[Login] 生成刷新令牌失败: %v", err)
-		utils.Error(c, "生成刷新令牌失败")
+		log.Printf("[Login] 创建会话失败: %v", err)
+		utils.Error(c, "创建会话失败")
 		return
 	}
 
-	// 记录登录日志
-	loginLog := models.MemberLoginLogs{
-		MemberID:    member.MemberID,
-		LoginTime:   time.Now(),
-		LoginIP:     c.ClientIP(),
-		UserAgent:   c.GetHeader("User-Agent"),
-		LoginStatus: "成功",
+	// 生成访问令牌和刷新令牌
+	token, refreshToken, err := issueSessionTokens(session, member.Account, member.UserRole)
+	if err != nil {
+		log.Printf("[Login] 生成令牌失败: %v", err)
+		utils.Error(c, "生成令牌失败")
+		return
 	}
-	database.DB.Create(&loginLog)
+
+	// 记录登录日志并清除失败计数
+	recordMemberLogin(c, member.MemberID, models.LoginStatusSuccess, "")
+	resetLoginFailures(utils.SubjectStaff, member.Account)
 
 	// 更新最后登录信息
 	now := time.Now()
-	member.LastLoginAt = &now
-	member.LastLoginIP = c.ClientIP()
-	database.DB.Save(&member)
+	database.DB.Model(member).Updates(map[string]interface{}{
+		"last_login_at": now,
+		"last_login_ip": c.ClientIP(),
+	})
 
 	log.Printf("[Login] 用户登录成功: %s (ID: %d)", member.Account, member.MemberID)
 
 	// 返回登录信息
-	response := models.RefreshTokenResponse{
-		AccessToken:  token,
-		RefreshToken: refreshToken,
-		ExpiresIn:    int64(24 * 3600), // 24小时
-		User:         &member,
-	}
+	response := newAuthTokenResponse(session, token, refreshToken, member)
+	response.RecoveryCodes = recoveryCodes
 
 	utils.SuccessWithMessage(c, "登录成功", response)
 }
@@ -103,7 +130,7 @@ func Login(c *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param refresh body models.RefreshTokenRequest true "刷新令牌信息"
-// @Success 200 {object} models.Response{data=models.RefreshTokenResponse}
+// @Success 200 {object} models.Response{data=models.AuthTokenResponse}
 // @Failure 401 {object} models.Response
 // @Failure 403 {object} models.Response
 // @Router /api/v1/refresh [post]
@@ -130,55 +157,77 @@ func RefreshToken(c *gin.Context) {
 		return
 	}
 
-	log.Printf("[RefreshToken] 令牌解x析成功，用户ID: %d", claims.MemberID)
+	// 只接受内部成员的刷新令牌
+	if claims.SubjectType != utils.SubjectStaff {
+		utils.Forbidden(c, "无效的用户类型")
+		return
+	}
+
+	log.Printf("[RefreshToken] 令牌解x析成功，用户ID: %d", claims.SubjectID)
+
+	// 校验会话并检测刷新令牌重放
+	session, err := consumeRefreshToken(claims)
+	if err != nil {
+		log.Printf("[RefreshToken] 会话校验失败，用户ID: %d, 错误: %v", claims.SubjectID, err)
+		utils.Unauthorized(c, "刷新令牌无效或已过期")
+		return
+	}
 
 	// 查找用户
 	var member models.InternalMember
-	result := database.DB.Where("member_id = ?", claims.MemberID).First(&member)
+	result := database.DB.Where("member_id = ?", claims.SubjectID).First(&member)
 	if result.Error != nil {
-		log.Printf("[RefreshToken] 用户查询失败，用户ID: %d, 错误: %v", claims.MemberID, result.Error)
+		log.Printf("[RefreshToken] 用户查询失败，用户ID: %d, 错误: %v", claims.SubjectID, result.Error)
+		revokeSession(session, models.SessionRevokeAccountDelete)
 		utils.Unauthorized(c, "用户不存在")
 		return
 	}
 
 	// 检查账户状态
 	if member.Status != "正常" {
-		log.Printf("[RefreshToken] 账户状态异常，用户ID: %d, 状态: %s", claims.MemberID, member.Status)
+		log.Printf("[RefreshToken] 账户状态异常，用户ID: %d, 状态: %s", claims.SubjectID, member.Status)
+		revokeSession(session, models.SessionRevokeAccountOff)
 		utils.Unauthorized(c, "账户已被禁用")
 		return
 	}
 
 	if !member.IsEnabled {
-		log.Printf("[RefreshToken] 账户未启用，用户ID: %d", claims.MemberID)
+		log.Printf("[RefreshToken] 账户未启用，用户ID: %d", claims.SubjectID)
+		revokeSession(session, models.SessionRevokeAccountOff)
 		utils.Unauthorized(c, "账户未启用")
 		return
 	}
 
-	// 生成新的访问令牌
-	accessToken, err := utils.GenerateToken(member.MemberID, member.Account, member.UserRole)
-	if err != nil {
-		log.Printf("[RefreshToken] 生成访问令牌失败: %v", err)
-		utils.Error(c, "生成访问令牌失败")
+	// 会话建立后被要求改密或启用两步验证的成员不能继续续期，需重新登录完成对应步骤
+	if member.MustChangePassword {
+		log.Printf("[RefreshToken] 成员需修改密码，用户ID: %d", claims.SubjectID)
+		revokeSession(session, models.SessionRevokePasswordReset)
+		utils.Unauthorized(c, "需要修改密码，请重新登录")
 		return
 	}
 
-	// 生成新的刷新令牌
-	refreshToken, err := utils.GenerateRefreshToken(member.MemberID, member.Account, member.UserRole)
-	if err != nil {
-		log.Printf("[RefreshToken] 生成刷新令牌失败: %v", err)
-		utils.Error(c, "生成刷新令牌失败")
+	if !member.TOTPEnabled && twoFactorRequired(member.UserRole) {
+		log.Printf("[RefreshToken] 成员需启用两步验证，用户ID: %d", claims.SubjectID)
+		revokeSession(session, models.SessionRevokeTwoFactor)
+		utils.Unauthorized(c, "需要启用两步验证，请重新登录")
+		return
+	}
+
+	// 轮换令牌，旧刷新令牌随即失效
+	accessToken, refreshToken, err := issueSessionTokens(session, member.Account, member.UserRole)
+	if errors.Is(err, errRefreshTokenReused) {
+		utils.Unauthorized(c, "刷新令牌无效或已过期")
+		return
+	} else if err != nil {
+		log.Printf("[RefreshToken] 生成令牌失败: %v", err)
+		utils.Error(c, "生成令牌失败")
 		return
 	}
 
-	log.Printf("[RefreshToken] 令牌刷新成功，用户ID: %d", claims.MemberID)
+	log.Printf("[RefreshToken] 令牌刷新成功，用户ID: %d", claims.SubjectID)
 
 	// 返回新的令牌信息
-	response := models.RefreshTokenResponse{
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
-		ExpiresIn:    int64(24 * 3600), // 24小时
-		User:         &member,
-	}
+	response := newAuthTokenResponse(session, accessToken, refreshToken, &member)
 
 	utils.SuccessWithMessage(c, "令牌刷新成功", response)
 }
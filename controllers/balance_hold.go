@@ -0,0 +1,120 @@
+package controllers
+
+import (
+	"errors"
+	"tangsong-esports/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// activeOrderHold 查询订单当前生效的冻结记录，没有时返回 nil
+func activeOrderHold(tx *gorm.DB, orderID uint) (*models.BalanceHold, error) {
+	var hold models.BalanceHold
+	err := tx.Where("order_id = ? AND status = ?", orderID, models.HoldStatusActive).First(&hold).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &hold, nil
+}
+
+// freezeOrderBalance 余额支付的订单提交时冻结订单金额，可用余额不足时返回错误
+// 订单重新提交时复用原冻结记录
+func freezeOrderBalance(tx *gorm.DB, order *models.PlaymateOrder, amount models.Money) error {
+	if !order.UseBalancePayment {
+		return nil
+	}
+	financial, err := lockCustomerFinancial(tx, order.CustomerID)
+	if err != nil {
+		return err
+	}
+	if available := financial.AvailableBalance(); available < amount {
+		return newOrderStateError(models.StatusError, "客户可用余额不足，可用余额：%s，订单金额：%s", available, amount)
+	}
+	financial.FrozenBalance += amount
+	if err := saveCustomerFinancial(tx, financial); err != nil {
+		return err
+	}
+
+	var hold models.BalanceHold
+	err = tx.Where("order_id = ?", order.OrderID).First(&hold).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	hold.OrderID = order.OrderID
+	hold.CustomerID = order.CustomerID
+	hold.Amount = amount
+	hold.Status = models.HoldStatusActive
+	hold.ClosedAt = nil
+	return tx.Save(&hold).Error
+}
+
+// adjustOrderHold 订单金额变更时按差额调整冻结金额，增加部分需要可用余额足够
+func adjustOrderHold(tx *gorm.DB, order *models.PlaymateOrder, amount models.Money) error {
+	if !order.UseBalancePayment {
+		return nil
+	}
+	hold, err := activeOrderHold(tx, order.OrderID)
+	if err != nil {
+		return err
+	}
+	if hold == nil {
+		return freezeOrderBalance(tx, order, amount)
+	}
+
+	financial, err := lockCustomerFinancial(tx, order.CustomerID)
+	if err != nil {
+		return err
+	}
+	delta := amount - hold.Amount
+	if delta == 0 {
+		return nil
+	}
+	if available := financial.AvailableBalance(); delta > available {
+		return newOrderStateError(models.StatusError, "客户可用余额不足，可用余额：%s，需追加冻结：%s", available, delta)
+	}
+	financial.FrozenBalance += delta
+	if err := saveCustomerFinancial(tx, financial); err != nil {
+		return err
+	}
+	hold.Amount = amount
+	return tx.Save(hold).Error
+}
+
+// closeOrderHold 解除订单的冻结金额，status 为已扣款或已释放；订单没有生效的冻结记录时不做处理
+// 调用方需已持有客户财务信息的行锁，financial 由调用方保存
+func closeOrderHold(tx *gorm.DB, financial *models.CustomerFinancialInfo, orderID uint, status string, now time.Time) error {
+	hold, err := activeOrderHold(tx, orderID)
+	if err != nil || hold == nil {
+		return err
+	}
+	financial.FrozenBalance -= hold.Amount
+	if financial.FrozenBalance < 0 {
+		financial.FrozenBalance = 0
+	}
+	hold.Status = status
+	hold.ClosedAt = &now
+	return tx.Save(hold).Error
+}
+
+// releaseOrderHold 订单驳回时释放冻结金额
+func releaseOrderHold(tx *gorm.DB, order *models.PlaymateOrder, now time.Time) error {
+	if !order.UseBalancePayment {
+		return nil
+	}
+	hold, err := activeOrderHold(tx, order.OrderID)
+	if err != nil || hold == nil {
+		return err
+	}
+	financial, err := lockCustomerFinancial(tx, order.CustomerID)
+	if err != nil {
+		return err
+	}
+	if err := closeOrderHold(tx, financial, order.OrderID, models.HoldStatusReleased, now); err != nil {
+		return err
+	}
+	return saveCustomerFinancial(tx, financial)
+}
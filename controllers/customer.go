@@ -1,11 +1,15 @@
 package controllers
 
 import (
+	"errors"
 	"strconv"
+	"strings"
 	"tangsong-esports/database"
+	"tangsong-esports/middleware"
 	"tangsong-esports/models"
 	"tangsong-esports/utils"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
@@ -90,7 +94,7 @@ func GetCustomers(c *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param customer body models.CustomerCreateRequest true "客户信息"
-// @Success 200 {object} models.Response{data=models.Customer}
+// @Success 200 {object} models.Response{data=models.CustomerCreateResponse}
 // @Router /api/v1/customers [post]
 func CreateCustomer(c *gin.Context) {
 	var req models.CustomerCreateRequest
@@ -98,6 +102,11 @@ func CreateCustomer(c *gin.Context) {
 		utils.Error(c, "请求参数错误")
 		return
 	}
+	if message := models.ValidateExclusiveDiscount(req.ExclusiveDiscountType, req.ExclusiveDiscountValue); message != "" {
+		utils.Error(c, message)
+		return
+	}
+	req.ExclusiveDiscountType, req.ExclusiveDiscountValue = models.NormalizeExclusiveDiscount(req.ExclusiveDiscountType, req.ExclusiveDiscountValue)
 
 	// 检查账号是否已存在
 	var existingCustomer models.Customer
@@ -117,6 +126,11 @@ func CreateCustomer(c *gin.Context) {
 	var passwordHash string
 	var passwordStatus string
 	if req.Password != "" {
+		if err := checkNewPassword(utils.SubjectCustomer, 0, req.Account, req.Password, ""); err != nil {
+			tx.Rollback()
+			utils.Error(c, err.Error())
+			return
+		}
 		// 如果提供了密码，则进行哈希
 		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 		if err != nil {
@@ -154,25 +168,55 @@ func CreateCustomer(c *gin.Context) {
 		utils.Error(c, "创建客户失败")
 		return
 	}
-	// 创建财务信息
+	if passwordHash != "" {
+		if err := recordPasswordHistory(tx, utils.SubjectCustomer, customer.CustomerID, passwordHash); err != nil {
+			tx.Rollback()
+			utils.Error(c, "创建客户失败")
+			return
+		}
+	}
+	// 创建财务信息，初始充值通过钱包流水入账
 	financialInfo := models.CustomerFinancialInfo{
 		CustomerID:        customer.CustomerID,
 		InitialRealCharge: req.InitialRealCharge,
 		TotalConsumption:  0,
 		TotalRealCharge:   req.InitialRealCharge,
-		CurrentBalance:    req.InitialRealCharge,
+		CurrentBalance:    0,
 	}
 	if err := tx.Create(&financialInfo).Error; err != nil {
 		tx.Rollback()
 		utils.Error(c, "创建财务信息失败")
 		return
 	}
+	if req.InitialRealCharge > 0 {
+		operatorID, _ := middleware.CurrentMemberID(c)
+		if _, err := postWalletEntry(tx, &financialInfo, walletPosting{
+			EntryType:     models.LedgerEntryRecharge,
+			Amount:        req.InitialRealCharge,
+			In:            true,
+			ReferenceType: models.LedgerRefCustomer,
+			ReferenceID:   customer.CustomerID,
+			OperatorID:    operatorID,
+			Notes:         "初始充值",
+		}); err != nil {
+			tx.Rollback()
+			utils.Error(c, "创建财务信息失败")
+			return
+		}
+		if err := saveCustomerFinancial(tx, &financialInfo); err != nil {
+			tx.Rollback()
+			utils.Error(c, "创建财务信息失败")
+			return
+		}
+	}
 
 	// 创建偏好设置
 	preferences := models.CustomerPreferences{
-		CustomerID:   customer.CustomerID,
-		PlatformBoss: req.PlatformBoss,
-		ExclusiveCS:  req.ExclusiveCS,
+		CustomerID:             customer.CustomerID,
+		PlatformBoss:           req.PlatformBoss,
+		ExclusiveCS:            req.ExclusiveCS,
+		ExclusiveDiscountType:  req.ExclusiveDiscountType,
+		ExclusiveDiscountValue: req.ExclusiveDiscountValue,
 	}
 	if err := tx.Create(&preferences).Error; err != nil {
 		tx.Rollback()
@@ -180,6 +224,18 @@ func CreateCustomer(c *gin.Context) {
 		return
 	}
 
+	// 未设置密码时生成激活码，客户凭激活码自行设置密码
+	var activation *models.ActivationCodeResponse
+	if passwordStatus == "unset" {
+		operatorID, _ := middleware.CurrentMemberID(c)
+		activation, err = issueActivationCode(tx, &customer, models.ActivationPurposeActivate, operatorID)
+		if err != nil {
+			tx.Rollback()
+			utils.Error(c, "生成激活码失败")
+			return
+		}
+	}
+
 	// 提交事务
 	tx.Commit()
 
@@ -187,7 +243,10 @@ func CreateCustomer(c *gin.Context) {
 	database.DB.Preload("FinancialInfo").Preload("Preferences").
 		First(&customer, customer.CustomerID)
 
-	utils.SuccessWithMessage(c, "创建客户成功", customer)
+	utils.SuccessWithMessage(c, "创建客户成功", models.CustomerCreateResponse{
+		Customer:   customer,
+		Activation: activation,
+	})
 }
 
 // UpdateCustomer 更新客户
@@ -213,6 +272,11 @@ func UpdateCustomer(c *gin.Context) {
 		utils.Error(c, "请求参数错误")
 		return
 	}
+	if message := models.ValidateExclusiveDiscount(req.ExclusiveDiscountType, req.ExclusiveDiscountValue); message != "" {
+		utils.Error(c, message)
+		return
+	}
+	req.ExclusiveDiscountType, req.ExclusiveDiscountValue = models.NormalizeExclusiveDiscount(req.ExclusiveDiscountType, req.ExclusiveDiscountValue)
 
 	// 查找客户
 	var customer models.Customer
@@ -228,6 +292,11 @@ func UpdateCustomer(c *gin.Context) {
 	// 开启事务
 	tx := database.DB.Begin()
 
+	// 更换手机号后需重新验证
+	if req.PhoneNumber != customer.PhoneNumber {
+		customer.IsPhoneVerified = false
+	}
+
 	// 更新基本信息
 	customer.CustomerName = req.CustomerName
 	customer.ContactMethod = req.ContactMethod
@@ -237,6 +306,14 @@ func UpdateCustomer(c *gin.Context) {
 	customer.AdditionalInfo2 = req.AdditionalInfo2
 	customer.AdditionalInfo3 = req.AdditionalInfo3
 	customer.Notes = req.Notes
+	if req.Status != "" {
+		if req.Status != "正常" && req.Status != "禁用" && req.Status != "过期" {
+			tx.Rollback()
+			utils.Error(c, "无效的账户状态")
+			return
+		}
+		customer.Status = req.Status
+	}
 
 	if err := tx.Save(&customer).Error; err != nil {
 		tx.Rollback()
@@ -249,9 +326,11 @@ func UpdateCustomer(c *gin.Context) {
 	if err := tx.Where("customer_id = ?", customer.CustomerID).First(&preferences).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			preferences = models.CustomerPreferences{
-				CustomerID:   customer.CustomerID,
-				PlatformBoss: req.PlatformBoss,
-				ExclusiveCS:  req.ExclusiveCS,
+				CustomerID:             customer.CustomerID,
+				PlatformBoss:           req.PlatformBoss,
+				ExclusiveCS:            req.ExclusiveCS,
+				ExclusiveDiscountType:  req.ExclusiveDiscountType,
+				ExclusiveDiscountValue: req.ExclusiveDiscountValue,
 			}
 			tx.Create(&preferences)
 		} else {
@@ -262,12 +341,19 @@ func UpdateCustomer(c *gin.Context) {
 	} else {
 		preferences.PlatformBoss = req.PlatformBoss
 		preferences.ExclusiveCS = req.ExclusiveCS
+		preferences.ExclusiveDiscountType = req.ExclusiveDiscountType
+		preferences.ExclusiveDiscountValue = req.ExclusiveDiscountValue
 		tx.Save(&preferences)
 	}
 
 	// 提交事务
 	tx.Commit()
 
+	// 账户被禁用时注销其全部会话
+	if customer.Status != "正常" {
+		revokeSubjectSessions(utils.SubjectCustomer, customer.CustomerID, models.SessionRevokeAccountOff)
+	}
+
 	// 重新查询完整信息
 	database.DB.Preload("FinancialInfo").Preload("Preferences").
 		First(&customer, customer.CustomerID)
@@ -308,6 +394,7 @@ func DeleteCustomer(c *gin.Context) {
 		utils.Error(c, "删除失败")
 		return
 	}
+	revokeSubjectSessions(utils.SubjectCustomer, customer.CustomerID, models.SessionRevokeAccountDelete)
 
 	utils.SuccessWithMessage(c, "删除客户成功", nil)
 }
@@ -344,13 +431,15 @@ func GetCustomerByID(c *gin.Context) {
 
 // RechargeCustomer 客户充值
 // @Summary 客户充值
-// @Description 为客户账户充值
+// @Description 为客户账户充值，实充金额计入实充余额，赠送金额计入赠送余额；收款单号重复时拒绝充值，可携带 Idempotency-Key 安全重试
 // @Tags 客户管理
 // @Accept json
 // @Produce json
 // @Param id path int true "客户ID"
+// @Param Idempotency-Key header string false "幂等键，重试时携带相同的值"
 // @Param recharge body models.CustomerRechargeRequest true "充值信息"
 // @Success 200 {object} models.Response{data=models.CustomerRechargeHistory}
+// @Failure 409 {object} models.Response "并发修改冲突，请重试"
 // @Router /api/v1/customers/{id}/recharge [post]
 func RechargeCustomer(c *gin.Context) {
 	idStr := c.Param("id")
@@ -365,6 +454,18 @@ func RechargeCustomer(c *gin.Context) {
 		utils.Error(c, "请求参数错误")
 		return
 	}
+	if !req.RealChargeAmount.IsPositive() {
+		utils.Error(c, "实充金额必须大于0")
+		return
+	}
+	if req.GiftAmount.IsNegative() {
+		utils.Error(c, "赠送金额不能为负数")
+		return
+	}
+	if utf8.RuneCountInString(strings.TrimSpace(req.TransactionID)) > 100 {
+		utils.Error(c, "收款单号不能超过100个字符")
+		return
+	}
 
 	// 验证客户是否存在
 	var customer models.Customer
@@ -378,7 +479,7 @@ func RechargeCustomer(c *gin.Context) {
 	}
 
 	// 获取操作员ID
-	operatorID, exists := c.Get("member_id")
+	operatorID, exists := middleware.CurrentMemberID(c)
 	if !exists {
 		utils.Error(c, "未找到操作员信息")
 		return
@@ -390,6 +491,12 @@ func RechargeCustomer(c *gin.Context) {
 	// 计算充值总额
 	totalRechargeAmount := req.RealChargeAmount + req.GiftAmount
 
+	// 收款单号有唯一索引，未填写时存为 NULL
+	var transactionID *string
+	if trimmed := strings.TrimSpace(req.TransactionID); trimmed != "" {
+		transactionID = &trimmed
+	}
+
 	// 创建充值记录
 	rechargeRecord := models.CustomerRechargeHistory{
 		CustomerID:          uint(id),
@@ -397,41 +504,79 @@ func RechargeCustomer(c *gin.Context) {
 		GiftAmount:          req.GiftAmount,
 		TotalRechargeAmount: totalRechargeAmount,
 		PaymentMethod:       req.PaymentMethod,
-		TransactionID:       req.TransactionID,
+		TransactionID:       transactionID,
 		Notes:               req.Notes,
-		OperatorID:          operatorID.(uint),
+		OperatorID:          operatorID,
 		RechargeAt:          time.Now(),
 	}
 
+	// 同一收款单号只能登记一次，由唯一索引保证，不同客户并发登记同一单号时后提交的失败
 	if err := tx.Create(&rechargeRecord).Error; err != nil {
 		tx.Rollback()
-		utils.Error(c, "创建充值记录失败")
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			utils.Conflict(c, "该收款单号已登记过充值，请勿重复充值")
+		} else {
+			utils.Error(c, "创建充值记录失败")
+		}
 		return
 	}
 
-	// 更新客户财务信息
+	// 更新客户财务信息，加行锁防止与审批扣款等并发修改互相覆盖
 	var financialInfo models.CustomerFinancialInfo
-	if err := tx.Where("customer_id = ?", uint(id)).First(&financialInfo).Error; err != nil {
+	if err := forUpdate(tx).Where("customer_id = ?", uint(id)).First(&financialInfo).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			// 如果不存在财务信息，则创建
-			financialInfo = models.CustomerFinancialInfo{
-				CustomerID:        uint(id),
-				InitialRealCharge: 0,
-				TotalConsumption:  0,
-				TotalRealCharge:   req.RealChargeAmount,
-				CurrentBalance:    totalRechargeAmount,
+			financialInfo = models.CustomerFinancialInfo{CustomerID: uint(id)}
+			if err := tx.Create(&financialInfo).Error; err != nil {
+				tx.Rollback()
+				utils.Error(c, "创建财务信息失败")
+				return
 			}
-			tx.Create(&financialInfo)
 		} else {
 			tx.Rollback()
 			utils.Error(c, "查询财务信息失败")
 			return
 		}
-	} else {
-		// 更新财务信息
-		financialInfo.TotalRealCharge += req.RealChargeAmount
-		financialInfo.CurrentBalance += totalRechargeAmount
-		tx.Save(&financialInfo)
+	}
+
+	// 实充和赠送分别记入钱包流水
+	postings := []walletPosting{
+		{EntryType: models.LedgerEntryRecharge, Amount: req.RealChargeAmount, Notes: req.Notes},
+		{EntryType: models.LedgerEntryGift, Amount: req.GiftAmount, Notes: req.Notes},
+	}
+	for _, posting := range postings {
+		if posting.Amount <= 0 {
+			continue
+		}
+		posting.In = true
+		posting.ReferenceType = models.LedgerRefRecharge
+		posting.ReferenceID = rechargeRecord.RechargeID
+		posting.OperatorID = operatorID
+		if _, err := postWalletEntry(tx, &financialInfo, posting); err != nil {
+			tx.Rollback()
+			utils.Error(c, "记录钱包流水失败")
+			return
+		}
+	}
+
+	financialInfo.TotalRealCharge += req.RealChargeAmount
+	if err := saveCustomerFinancial(tx, &financialInfo); err != nil {
+		tx.Rollback()
+		if errors.Is(err, errVersionConflict) {
+			utils.Conflict(c, err.Error())
+		} else {
+			utils.Error(c, "更新财务信息失败")
+		}
+		return
+	}
+
+	// 记录充值后的实充和赠送余额
+	rechargeRecord.RealBalanceAfter = financialInfo.RealBalance
+	rechargeRecord.GiftBalanceAfter = financialInfo.GiftBalance
+	if err := tx.Save(&rechargeRecord).Error; err != nil {
+		tx.Rollback()
+		utils.Error(c, "更新充值记录失败")
+		return
 	}
 
 	// 提交事务
@@ -445,7 +590,7 @@ func RechargeCustomer(c *gin.Context) {
 
 // GetCustomerRechargeHistory 获取客户充值记录
 // @Summary 获取客户充值记录
-// @Description 获取指定客户的充值记录
+// @Description 获取指定客户的充值记录，包含每次充值后的实充余额和赠送余额
 // @Tags 客户管理
 // @Accept json
 // @Produce json
@@ -516,12 +661,12 @@ func GetCustomerRechargeHistory(c *gin.Context) {
 
 // AdminResetCustomerPassword 管理员重置客户密码
 // @Summary 管理员重置客户密码
-// @Description 管理员可以直接为任何客户重置密码
+// @Description 管理员可以直接为客户设置新密码；不传新密码时生成一次性重置码，由客户自行设置
 // @Tags 客户管理
 // @Accept json
 // @Produce json
 // @Param reset body models.AdminResetCustomerPasswordRequest true "重置信息"
-// @Success 200 {object} models.StandardResponse
+// @Success 200 {object} models.Response{data=models.AdminResetCustomerPasswordResponse}
 // @Router /api/v1/customers/reset-password [post]
 func AdminResetCustomerPassword(c *gin.Context) {
 	var req models.AdminResetCustomerPasswordRequest
@@ -541,6 +686,42 @@ func AdminResetCustomerPassword(c *gin.Context) {
 		return
 	}
 
+	operatorID, _ := middleware.CurrentMemberID(c)
+
+	// 未指定新密码时，标记为需要重置并生成重置码
+	if req.NewPassword == "" {
+		var activation *models.ActivationCodeResponse
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&customer).Update("password_status", "need_reset").Error; err != nil {
+				return err
+			}
+			var err error
+			activation, err = issueActivationCode(tx, &customer, models.ActivationPurposeReset, operatorID)
+			return err
+		})
+		if err != nil {
+			utils.Error(c, "生成重置码失败")
+			return
+		}
+
+		revokeSubjectSessions(utils.SubjectCustomer, customer.CustomerID, models.SessionRevokeAdmin)
+		logOperation(operatorID, "重置密码", "客户管理", "生成客户重置码："+customer.Account,
+			strconv.FormatUint(uint64(customer.CustomerID), 10), "客户", c.ClientIP(), c.GetHeader("User-Agent"))
+
+		utils.Success(c, models.AdminResetCustomerPasswordResponse{
+			Success:    true,
+			Message:    "已生成重置码",
+			Activation: activation,
+		})
+		return
+	}
+
+	// 校验密码策略
+	if err := checkNewPassword(utils.SubjectCustomer, customer.CustomerID, customer.Account, req.NewPassword, customer.PasswordHash); err != nil {
+		utils.Error(c, err.Error())
+		return
+	}
+
 	// 生成新密码哈希
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
 	if err != nil {
@@ -554,13 +735,23 @@ func AdminResetCustomerPassword(c *gin.Context) {
 		"password_status": "set",
 	}
 
-	if err := database.DB.Model(&customer).Updates(updates).Error; err != nil {
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&customer).Updates(updates).Error; err != nil {
+			return err
+		}
+		return recordPasswordHistory(tx, utils.SubjectCustomer, customer.CustomerID, string(hashedPassword))
+	})
+	if err != nil {
 		utils.Error(c, "密码重置失败")
 		return
 	}
 
-	utils.Success(c, gin.H{
-		"success": true,
-		"message": "客户密码重置成功",
+	revokeSubjectSessions(utils.SubjectCustomer, customer.CustomerID, models.SessionRevokeAdmin)
+	logOperation(operatorID, "重置密码", "客户管理", "重置客户密码："+customer.Account,
+		strconv.FormatUint(uint64(customer.CustomerID), 10), "客户", c.ClientIP(), c.GetHeader("User-Agent"))
+
+	utils.Success(c, models.AdminResetCustomerPasswordResponse{
+		Success: true,
+		Message: "客户密码重置成功",
 	})
 }
@@ -1,8 +1,10 @@
 package controllers
 
 import (
+	"errors"
 	"log"
 	"tangsong-esports/database"
+	"tangsong-esports/middleware"
 	"tangsong-esports/models"
 	"tangsong-esports/utils"
 	"time"
@@ -19,7 +21,7 @@ import (
 // @Accept json
 // @Produce json
 // @Param register body models.CustomerRegisterRequest true "注册信息"
-// @Success 200 {object} models.Response{data=models.CustomerLoginResponse}
+// @Success 200 {object} models.Response{data=models.AuthTokenResponse}
 // @Router /api/v1/customer/register [post]
 func CustomerRegister(c *gin.Context) {
 	var req models.CustomerRegisterRequest
@@ -52,6 +54,12 @@ func CustomerRegister(c *gin.Context) {
 		}
 	}
 
+	// 校验密码策略
+	if err := checkNewPassword(utils.SubjectCustomer, 0, req.Account, req.Password, ""); err != nil {
+		utils.Error(c, err.Error())
+		return
+	}
+
 	// 加密密码
 	hashedPassword, err := utils.HashPassword(req.Password)
 	if err != nil {
@@ -84,6 +92,11 @@ func CustomerRegister(c *gin.Context) {
 		utils.Error(c, "创建客户失败")
 		return
 	}
+	if err := recordPasswordHistory(tx, utils.SubjectCustomer, customer.CustomerID, hashedPassword); err != nil {
+		tx.Rollback()
+		utils.Error(c, "创建客户失败")
+		return
+	}
 
 	// 创建财务信息（初始余额为0）
 	financialInfo := models.CustomerFinancialInfo{
@@ -114,25 +127,7 @@ func CustomerRegister(c *gin.Context) {
 	// 提交事务
 	tx.Commit()
 
-	// 生成JWT令牌
-	token, err := utils.GenerateToken(customer.CustomerID, customer.Account, "customer")
-	if err != nil {
-		log.Printf("[CustomerRegister] 生成访问令牌失败: %v", err)
-		utils.Error(c, "生成令牌失败")
-		return
-	}
-
-	// 重新查询完整信息
-	database.DB.Preload("FinancialInfo").Preload("Preferences").
-		First(&customer, customer.CustomerID)
-
-	response := models.CustomerLoginResponse{
-		Token:     token,
-		ExpiresIn: 24 * 60 * 60, // 24小时
-		User:      &customer,
-	}
-
-	utils.SuccessWithMessage(c, "注册成功", response)
+	completeCustomerLogin(c, &customer, "注册成功")
 }
 
 // CustomerLogin 客户登录
@@ -142,7 +137,7 @@ func CustomerRegister(c *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param login body models.CustomerLoginRequest true "登录信息"
-// @Success 200 {object} models.Response{data=models.CustomerLoginResponse}
+// @Success 200 {object} models.Response{data=models.AuthTokenResponse}
 // @Router /api/v1/customer/login [post]
 func CustomerLogin(c *gin.Context) {
 	var req models.CustomerLoginRequest
@@ -151,11 +146,19 @@ func CustomerLogin(c *gin.Context) {
 		return
 	}
 
+	// 账号或IP处于锁定期时直接拒绝
+	ip := c.ClientIP()
+	if remaining := loginLockedFor(utils.SubjectCustomer, req.Account, ip); remaining > 0 {
+		utils.TooManyRequests(c, loginLockedMessage(remaining))
+		return
+	}
+
 	// 查找客户
 	var customer models.Customer
 	if err := database.DB.Where("account = ?", req.Account).First(&customer).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			utils.Error(c, "账户名或密码错误")
+			log.Printf("[CustomerLogin] 账号不存在: %s (IP: %s)", req.Account, ip)
+			loginFailed(c, utils.SubjectCustomer, req.Account, "账户名或密码错误")
 		} else {
 			utils.Error(c, "登录失败")
 		}
@@ -164,52 +167,67 @@ func CustomerLogin(c *gin.Context) {
 
 	// 检查密码状态
 	if customer.PasswordStatus == "unset" {
+		recordCustomerLogin(c, customer.CustomerID, models.LoginStatusFailed, models.LoginFailPasswordUnset)
 		utils.Error(c, "账户密码未设置，请联系管理员或使用设置密码功能")
 		return
 	}
 
 	if customer.PasswordStatus == "need_reset" {
+		recordCustomerLogin(c, customer.CustomerID, models.LoginStatusFailed, models.LoginFailPasswordUnset)
 		utils.Error(c, "账户密码需要重置，请使用设置密码功能")
 		return
 	}
 
 	// 验证密码
 	if err := bcrypt.CompareHashAndPassword([]byte(customer.PasswordHash), []byte(req.Password)); err != nil {
-		utils.Error(c, "账户名或密码错误")
+		recordCustomerLogin(c, customer.CustomerID, models.LoginStatusFailed, models.LoginFailWrongPassword)
+		loginFailed(c, utils.SubjectCustomer, req.Account, "账户名或密码错误")
 		return
 	}
 
 	// 检查账户状态
 	if customer.Status != "正常" {
+		recordCustomerLogin(c, customer.CustomerID, models.LoginStatusFailed, models.LoginFailDisabled)
 		utils.Error(c, "账户已被禁用")
 		return
 	}
 
-	// 生成JWT令牌
-	token, err := utils.GenerateToken(customer.CustomerID, customer.Account, "customer")
+	completeCustomerLogin(c, &customer, "登录成功")
+}
+
+// completeCustomerLogin 创建会话并签发令牌，完成客户登录
+func completeCustomerLogin(c *gin.Context, customer *models.Customer, message string) {
+	session, err := createSession(c, utils.SubjectCustomer, customer.CustomerID)
 	if err != nil {
-		log.Printf("[CustomerLogin] 生成访问令牌失败: %v", err)
+		log.Printf("[CustomerLogin] 创建会话失败: %v", err)
+		utils.Error(c, "创建会话失败")
+		return
+	}
+
+	// 生成访问令牌和刷新令牌
+	token, refreshToken, err := issueSessionTokens(session, customer.Account, models.RoleCustomer)
+	if err != nil {
+		log.Printf("[CustomerLogin] 生成令牌失败: %v", err)
 		utils.Error(c, "生成令牌失败")
 		return
 	}
 
+	// 记录登录日志并清除失败计数
+	recordCustomerLogin(c, customer.CustomerID, models.LoginStatusSuccess, "")
+	resetLoginFailures(utils.SubjectCustomer, customer.Account)
+
 	// 更新最后登录信息
 	now := time.Now()
-	customer.LastLoginAt = &now
-	customer.LastLoginIP = c.ClientIP()
-	database.DB.Save(&customer)
+	database.DB.Model(customer).Updates(map[string]interface{}{
+		"last_login_at": now,
+		"last_login_ip": c.ClientIP(),
+	})
 
 	// 重新查询完整信息
 	database.DB.Preload("FinancialInfo").Preload("Preferences").
-		First(&customer, customer.CustomerID)
+		First(customer, customer.CustomerID)
 
-	response := models.CustomerLoginResponse{
-		Token:     token,
-		ExpiresIn: 24 * 60 * 60, // 24小时
-		User:      &customer,
-	}
-
-	utils.SuccessWithMessage(c, "登录成功", response)
+	utils.SuccessWithMessage(c, message, newAuthTokenResponse(session, token, refreshToken, customer))
 
 	log.Printf("[CustomerLogin] 客户登录成功: %s (ID: %d)", customer.Account, customer.CustomerID)
 }
@@ -220,11 +238,11 @@ func CustomerLogin(c *gin.Context) {
 // @Tags 客户认证
 // @Accept json
 // @Produce json
-// @Param refresh body models.CustomerRefreshTokenRequest true "刷新令牌信息"
-// @Success 200 {object} models.Response{data=models.CustomerRefreshTokenResponse}
+// @Param refresh body models.RefreshTokenRequest true "刷新令牌信息"
+// @Success 200 {object} models.Response{data=models.AuthTokenResponse}
 // @Router /api/v1/customer/refresh [post]
 func CustomerRefreshToken(c *gin.Context) {
-	var req models.CustomerRefreshTokenRequest
+	var req models.RefreshTokenRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		utils.Error(c, "请求参数错误")
 		return
@@ -238,17 +256,26 @@ func CustomerRefreshToken(c *gin.Context) {
 		return
 	}
 
-	// 验证用户角色
-	if claims.UserRole != "customer" {
+	// 验证令牌主体类型
+	if claims.SubjectType != utils.SubjectCustomer {
 		utils.ErrorWithCode(c, 403, "无效的用户类型")
 		return
 	}
 
+	// 校验会话并检测刷新令牌重放
+	session, err := consumeRefreshToken(claims)
+	if err != nil {
+		log.Printf("[CustomerRefreshToken] 会话校验失败: %v", err)
+		utils.ErrorWithCode(c, 401, "刷新令牌无效或已过期")
+		return
+	}
+
 	// 查找客户
 	var customer models.Customer
 	if err := database.DB.Preload("FinancialInfo").Preload("Preferences").
-		First(&customer, claims.MemberID).Error; err != nil {
+		First(&customer, claims.SubjectID).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
+			revokeSession(session, models.SessionRevokeAccountDelete)
 			utils.ErrorWithCode(c, 404, "客户不存在")
 		} else {
 			utils.ErrorWithCode(c, 500, "查询客户失败")
@@ -258,32 +285,23 @@ func CustomerRefreshToken(c *gin.Context) {
 
 	// 检查账户状态
 	if customer.Status != "正常" {
+		revokeSession(session, models.SessionRevokeAccountOff)
 		utils.ErrorWithCode(c, 403, "账户已被禁用")
 		return
 	}
 
-	// 生成新的访问令牌
-	accessToken, err := utils.GenerateToken(customer.CustomerID, customer.Account, "customer")
-	if err != nil {
-		log.Printf("[CustomerRefreshToken] 生成访问令牌失败: %v", err)
-		utils.ErrorWithCode(c, 500, "生成访问令牌失败")
+	// 轮换令牌，旧刷新令牌随即失效
+	accessToken, refreshToken, err := issueSessionTokens(session, customer.Account, models.RoleCustomer)
+	if errors.Is(err, errRefreshTokenReused) {
+		utils.ErrorWithCode(c, 401, "刷新令牌无效或已过期")
 		return
-	}
-
-	// 生成新的刷新令牌
-	refreshToken, err := utils.GenerateRefreshToken(customer.CustomerID, customer.Account, "customer")
-	if err != nil {
-		log.Printf("[CustomerRefreshToken] 生成刷新令牌失败: %v", err)
-		utils.ErrorWithCode(c, 500, "生成刷新令牌失败")
+	} else if err != nil {
+		log.Printf("[CustomerRefreshToken] 生成令牌失败: %v", err)
+		utils.ErrorWithCode(c, 500, "生成令牌失败")
 		return
 	}
 
-	response := models.CustomerRefreshTokenResponse{
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
-		ExpiresIn:    24 * 60 * 60, // 24小时
-		User:         &customer,
-	}
+	response := newAuthTokenResponse(session, accessToken, refreshToken, &customer)
 
 	utils.SuccessWithMessage(c, "令牌刷新成功", response)
 
@@ -300,7 +318,7 @@ func CustomerRefreshToken(c *gin.Context) {
 // @Router /api/v1/customer/profile [get]
 func GetCustomerProfile(c *gin.Context) {
 	// 从中间件获取客户ID
-	customerID, exists := c.Get("member_id")
+	customerID, exists := middleware.CurrentCustomerID(c)
 	if !exists {
 		utils.Error(c, "未找到客户信息")
 		return
@@ -331,7 +349,7 @@ func GetCustomerProfile(c *gin.Context) {
 // @Router /api/v1/customer/profile [put]
 func UpdateCustomerProfile(c *gin.Context) {
 	// 从中间件获取客户ID
-	customerID, exists := c.Get("member_id")
+	customerID, exists := middleware.CurrentCustomerID(c)
 	if !exists {
 		utils.Error(c, "未找到客户信息")
 		return
@@ -368,6 +386,11 @@ func UpdateCustomerProfile(c *gin.Context) {
 		}
 	}
 
+	// 更换手机号后需重新验证
+	if req.PhoneNumber != customer.PhoneNumber {
+		customer.IsPhoneVerified = false
+	}
+
 	// 更新基本信息（不包括账号和密码）
 	customer.CustomerName = req.CustomerName
 	customer.ContactMethod = req.ContactMethod
@@ -392,7 +415,7 @@ func UpdateCustomerProfile(c *gin.Context) {
 
 // CustomerSetPassword 客户设置密码（首次设置或管理员重置后设置）
 // @Summary 客户设置密码
-// @Description 为管理员创建的客户账户设置密码，或重置密码后设置新密码
+// @Description 凭管理员生成的一次性激活码或重置码，为客户账户设置密码
 // @Tags 客户认证
 // @Accept json
 // @Produce json
@@ -406,11 +429,18 @@ func CustomerSetPassword(c *gin.Context) {
 		return
 	}
 
+	// 激活码与密码同样受登录失败锁定保护，防止暴力猜测
+	ip := c.ClientIP()
+	if remaining := loginLockedFor(utils.SubjectCustomer, req.Account, ip); remaining > 0 {
+		utils.TooManyRequests(c, loginLockedMessage(remaining))
+		return
+	}
+
 	// 查找客户
 	var customer models.Customer
 	if err := database.DB.Where("account = ?", req.Account).First(&customer).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			utils.Error(c, "账户不存在")
+			loginFailed(c, utils.SubjectCustomer, req.Account, "激活码无效或已过期")
 		} else {
 			utils.Error(c, "查询失败")
 		}
@@ -423,6 +453,12 @@ func CustomerSetPassword(c *gin.Context) {
 		return
 	}
 
+	// 校验密码策略
+	if err := checkNewPassword(utils.SubjectCustomer, customer.CustomerID, customer.Account, req.Password, customer.PasswordHash); err != nil {
+		utils.Error(c, err.Error())
+		return
+	}
+
 	// 生成密码哈希
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
@@ -430,18 +466,34 @@ func CustomerSetPassword(c *gin.Context) {
 		return
 	}
 
-	// 更新密码和状态
-	updates := map[string]interface{}{
-		"password_hash":   string(hashedPassword),
-		"password_status": "set",
-		"updated_at":      time.Now(),
+	// 使用激活码并更新密码
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := consumeActivationCode(tx, c, customer.CustomerID, req.Code); err != nil {
+			return err
+		}
+		updates := map[string]interface{}{
+			"password_hash":   string(hashedPassword),
+			"password_status": "set",
+			"updated_at":      time.Now(),
+		}
+		if err := tx.Model(&customer).Updates(updates).Error; err != nil {
+			return err
+		}
+		return recordPasswordHistory(tx, utils.SubjectCustomer, customer.CustomerID, string(hashedPassword))
+	})
+	if err == errActivationCodeInvalid {
+		log.Printf("[CustomerSetPassword] 激活码校验失败: %s (IP: %s)", req.Account, ip)
+		loginFailed(c, utils.SubjectCustomer, req.Account, "激活码无效或已过期")
+		return
 	}
-
-	if err := database.DB.Model(&customer).Updates(updates).Error; err != nil {
+	if err != nil {
 		utils.Error(c, "设置密码失败")
 		return
 	}
 
+	resetLoginFailures(utils.SubjectCustomer, customer.Account)
+	log.Printf("[CustomerSetPassword] 客户通过激活码设置密码: %s (ID: %d, IP: %s)", customer.Account, customer.CustomerID, ip)
+
 	utils.Success(c, gin.H{
 		"success": true,
 		"message": "密码设置成功",
@@ -459,7 +511,7 @@ func CustomerSetPassword(c *gin.Context) {
 // @Router /api/v1/customer/reset-password [post]
 func CustomerResetPassword(c *gin.Context) {
 	// 从中间件获取客户ID
-	customerID, exists := c.Get("member_id")
+	customerID, exists := middleware.CurrentCustomerID(c)
 	if !exists {
 		utils.Error(c, "未找到客户信息")
 		return
@@ -488,6 +540,12 @@ func CustomerResetPassword(c *gin.Context) {
 		return
 	}
 
+	// 校验密码策略
+	if err := checkNewPassword(utils.SubjectCustomer, customer.CustomerID, customer.Account, req.NewPassword, customer.PasswordHash); err != nil {
+		utils.Error(c, err.Error())
+		return
+	}
+
 	// 生成新密码哈希
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
 	if err != nil {
@@ -501,7 +559,13 @@ func CustomerResetPassword(c *gin.Context) {
 		"updated_at":    time.Now(),
 	}
 
-	if err := database.DB.Model(&customer).Updates(updates).Error; err != nil {
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&customer).Updates(updates).Error; err != nil {
+			return err
+		}
+		return recordPasswordHistory(tx, utils.SubjectCustomer, customer.CustomerID, string(hashedPassword))
+	})
+	if err != nil {
 		utils.Error(c, "重置密码失败")
 		return
 	}
@@ -514,15 +578,15 @@ func CustomerResetPassword(c *gin.Context) {
 
 // GetCustomerBalance 获取客户余额信息
 // @Summary 获取客户余额信息
-// @Description 获取当前登录客户的余额和财务信息
+// @Description 获取当前登录客户的余额和财务信息，余额分为实充余额（可退）和赠送余额（不可退），可用余额已扣除待审批订单冻结的金额
 // @Tags 客户认证
 // @Accept json
 // @Produce json
-// @Success 200 {object} models.Response{data=models.CustomerFinancialInfo}
+// @Success 200 {object} models.Response{data=models.CustomerBalanceResponse}
 // @Router /api/v1/customer/balance [get]
 func GetCustomerBalance(c *gin.Context) {
 	// 从中间件获取客户ID
-	customerID, exists := c.Get("member_id")
+	customerID, exists := middleware.CurrentCustomerID(c)
 	if !exists {
 		utils.Error(c, "未找到客户信息")
 		return
@@ -539,5 +603,8 @@ func GetCustomerBalance(c *gin.Context) {
 		return
 	}
 
-	utils.Success(c, financialInfo)
+	utils.Success(c, models.CustomerBalanceResponse{
+		CustomerFinancialInfo: financialInfo,
+		AvailableBalance:      financialInfo.AvailableBalance(),
+	})
 }
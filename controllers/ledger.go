@@ -0,0 +1,465 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"tangsong-esports/database"
+	"tangsong-esports/middleware"
+	"tangsong-esports/models"
+	"tangsong-esports/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var (
+	errInsufficientBalance = errors.New("客户余额不足")
+	errAlreadyReversed     = errors.New("该流水已冲正")
+)
+
+// moneyRounding 从系统配置读取金额舍入规则，缺省为四舍五入
+func moneyRounding() models.RoundingMode {
+	var config models.SystemConfig
+	database.DB.Where("config_key = ? AND is_active = ?", "money_rounding_mode", true).First(&config)
+	return models.ParseRoundingMode(config.ConfigValue)
+}
+
+// balanceDeductionOrder 从系统配置读取余额支付的扣款顺序，缺省先扣赠送余额
+func balanceDeductionOrder() string {
+	var config models.SystemConfig
+	database.DB.Where("config_key = ? AND is_active = ?", "balance_deduction_order", true).First(&config)
+	switch config.ConfigValue {
+	case models.DeductRealFirst, models.DeductProportional:
+		return config.ConfigValue
+	default:
+		return models.DeductGiftFirst
+	}
+}
+
+// walletPosting 一笔待记账的钱包资金变动
+type walletPosting struct {
+	EntryType     string
+	Amount        models.Money // 正数
+	GiftAmount    models.Money // Amount 中计入赠送余额的部分，赠送流水固定为全额
+	In            bool         // true 表示资金进入客户钱包
+	ReferenceType string
+	ReferenceID   uint
+	OperatorID    uint
+	Notes         string
+}
+
+// postWalletEntry 记一笔钱包流水，同步变动 financial 的实充、赠送和总余额并记录记账后余额
+// 调用方负责在同一事务中保存 financial
+func postWalletEntry(tx *gorm.DB, financial *models.CustomerFinancialInfo, p walletPosting) (*models.WalletLedgerEntry, error) {
+	if p.Amount <= 0 {
+		return nil, fmt.Errorf("流水金额必须大于0: %s", p.Amount)
+	}
+	debit, credit, ok := models.WalletLedgerAccounts(p.EntryType, p.In)
+	if !ok {
+		return nil, fmt.Errorf("不支持的流水类型: %s", p.EntryType)
+	}
+	if p.EntryType == models.LedgerEntryGift {
+		p.GiftAmount = p.Amount
+	}
+	if p.GiftAmount < 0 || p.GiftAmount > p.Amount {
+		return nil, fmt.Errorf("赠送部分超出流水金额: %s", p.GiftAmount)
+	}
+
+	entry := models.WalletLedgerEntry{
+		CustomerID:    financial.CustomerID,
+		EntryType:     p.EntryType,
+		DebitAccount:  debit,
+		CreditAccount: credit,
+		Amount:        p.Amount,
+		GiftAmount:    p.GiftAmount,
+		ReferenceType: p.ReferenceType,
+		ReferenceID:   p.ReferenceID,
+		Notes:         p.Notes,
+	}
+	if p.OperatorID != 0 {
+		entry.OperatorID = &p.OperatorID
+	}
+	return &entry, appendWalletEntry(tx, financial, &entry)
+}
+
+// appendWalletEntry 写入流水并更新余额，出账时任一类余额不足或动用了冻结金额返回 errInsufficientBalance
+func appendWalletEntry(tx *gorm.DB, financial *models.CustomerFinancialInfo, entry *models.WalletLedgerEntry) error {
+	delta := entry.WalletDelta()
+	giftDelta := entry.GiftDelta()
+	realBalance := financial.RealBalance + delta - giftDelta
+	giftBalance := financial.GiftBalance + giftDelta
+	if realBalance.IsNegative() || giftBalance.IsNegative() {
+		return errInsufficientBalance
+	}
+	if delta.IsNegative() && realBalance+giftBalance < financial.FrozenBalance {
+		return errInsufficientBalance
+	}
+	financial.RealBalance = realBalance
+	financial.GiftBalance = giftBalance
+	financial.CurrentBalance = realBalance + giftBalance
+	entry.BalanceAfter = financial.CurrentBalance
+	entry.GiftBalanceAfter = giftBalance
+	return tx.Create(entry).Error
+}
+
+// ledgerSummary 按流水汇总的客户钱包余额
+type ledgerSummary struct {
+	Balance     models.Money
+	GiftBalance models.Money
+	Count       int64
+}
+
+// ledgerBalance 按流水汇总客户钱包总余额和赠送余额
+func ledgerBalance(db *gorm.DB, customerID uint) (ledgerSummary, error) {
+	var result ledgerSummary
+	wallet := models.LedgerAccountCustomerWallet
+	err := db.Model(&models.WalletLedgerEntry{}).
+		Select(`COALESCE(SUM(CASE WHEN credit_account = ? THEN amount WHEN debit_account = ? THEN -amount ELSE 0 END), 0) AS balance,
+			COALESCE(SUM(CASE WHEN credit_account = ? THEN gift_amount WHEN debit_account = ? THEN -gift_amount ELSE 0 END), 0) AS gift_balance,
+			COUNT(*) AS count`, wallet, wallet, wallet, wallet).
+		Where("customer_id = ?", customerID).
+		Scan(&result).Error
+	return result, err
+}
+
+// queryWalletLedger 分页查询客户钱包流水
+func queryWalletLedger(c *gin.Context, customerID uint) {
+	var req models.WalletLedgerFilterRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		utils.Error(c, "请求参数错误")
+		return
+	}
+
+	// 设置默认值
+	if req.Page <= 0 {
+		req.Page = 1
+	}
+	if req.PageSize <= 0 {
+		req.PageSize = 10
+	}
+
+	query := database.DB.Model(&models.WalletLedgerEntry{}).Where("customer_id = ?", customerID)
+	if req.EntryType != "" {
+		query = query.Where("entry_type = ?", req.EntryType)
+	}
+	if req.StartDate != "" {
+		query = query.Where("DATE(created_at) >= ?", req.StartDate)
+	}
+	if req.EndDate != "" {
+		query = query.Where("DATE(created_at) <= ?", req.EndDate)
+	}
+
+	// 计算总数
+	var total int64
+	query.Count(&total)
+
+	// 分页查询
+	var entries []models.WalletLedgerEntry
+	offset := (req.Page - 1) * req.PageSize
+	if err := query.Preload("Operator").Order("entry_id DESC").
+		Offset(offset).Limit(req.PageSize).Find(&entries).Error; err != nil {
+		utils.Error(c, "查询流水失败")
+		return
+	}
+
+	utils.Success(c, models.PageResponse{
+		List:     entries,
+		Total:    total,
+		Page:     req.Page,
+		PageSize: req.PageSize,
+	})
+}
+
+// parseCustomerID 解析路径中的客户ID并确认客户存在
+func parseCustomerID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.Error(c, "无效的客户ID")
+		return 0, false
+	}
+
+	var customer models.Customer
+	if err := database.DB.First(&customer, uint(id)).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.NotFound(c, "客户不存在")
+		} else {
+			utils.Error(c, "查询客户失败")
+		}
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// GetCustomerLedger 获取客户钱包流水
+// @Summary 获取客户钱包流水
+// @Description 分页获取指定客户的钱包流水，包括充值、赠送、订单扣款、退款、调账和冲正
+// @Tags 客户管理
+// @Accept json
+// @Produce json
+// @Param id path int true "客户ID"
+// @Param page query int false "页码" default(1)
+// @Param page_size query int false "每页数量" default(10)
+// @Param entry_type query string false "流水类型" Enums(recharge,gift,order_charge,refund,adjustment,reversal)
+// @Param start_date query string false "开始日期(YYYY-MM-DD)"
+// @Param end_date query string false "结束日期(YYYY-MM-DD)"
+// @Success 200 {object} models.Response{data=models.PageResponse}
+// @Router /api/v1/customers/{id}/ledger [get]
+func GetCustomerLedger(c *gin.Context) {
+	customerID, ok := parseCustomerID(c)
+	if !ok {
+		return
+	}
+	queryWalletLedger(c, customerID)
+}
+
+// GetMyLedger 客户查看自己的钱包流水
+// @Summary 客户查看自己的钱包流水
+// @Description 分页获取当前客户的钱包流水
+// @Tags 客户认证
+// @Accept json
+// @Produce json
+// @Param page query int false "页码" default(1)
+// @Param page_size query int false "每页数量" default(10)
+// @Param entry_type query string false "流水类型" Enums(recharge,gift,order_charge,refund,adjustment,reversal)
+// @Success 200 {object} models.Response{data=models.PageResponse}
+// @Router /api/v1/customer/ledger [get]
+func GetMyLedger(c *gin.Context) {
+	customerID, exists := middleware.CurrentCustomerID(c)
+	if !exists {
+		utils.Error(c, "未找到客户信息")
+		return
+	}
+	queryWalletLedger(c, customerID)
+}
+
+// ReconcileCustomerLedger 客户钱包对账
+// @Summary 客户钱包对账
+// @Description 比较按流水汇总的总余额、赠送余额与客户当前记录是否一致
+// @Tags 客户管理
+// @Accept json
+// @Produce json
+// @Param id path int true "客户ID"
+// @Success 200 {object} models.Response{data=models.WalletReconcileResponse}
+// @Router /api/v1/customers/{id}/ledger/reconcile [get]
+func ReconcileCustomerLedger(c *gin.Context) {
+	customerID, ok := parseCustomerID(c)
+	if !ok {
+		return
+	}
+
+	summary, err := ledgerBalance(database.DB, customerID)
+	if err != nil {
+		utils.Error(c, "汇总流水失败")
+		return
+	}
+
+	var financial models.CustomerFinancialInfo
+	database.DB.Where("customer_id = ?", customerID).First(&financial)
+
+	difference := financial.CurrentBalance - summary.Balance
+	giftDifference := financial.GiftBalance - summary.GiftBalance
+	utils.Success(c, models.WalletReconcileResponse{
+		CustomerID:      customerID,
+		LedgerBalance:   summary.Balance,
+		RecordedBalance: financial.CurrentBalance,
+		Difference:      difference,
+		LedgerGift:      summary.GiftBalance,
+		RecordedGift:    financial.GiftBalance,
+		GiftDifference:  giftDifference,
+		Balanced:        difference.IsZero() && giftDifference.IsZero(),
+		EntryCount:      summary.Count,
+	})
+}
+
+// AdjustCustomerBalance 人工调整客户余额
+// @Summary 人工调整客户余额
+// @Description 以调账流水增加或减少客户的实充或赠送余额，必须填写原因
+// @Tags 客户管理
+// @Accept json
+// @Produce json
+// @Param id path int true "客户ID"
+// @Param data body models.BalanceAdjustmentRequest true "调账信息"
+// @Success 200 {object} models.Response{data=models.WalletLedgerEntry}
+// @Failure 409 {object} models.Response "并发修改冲突，请重试"
+// @Router /api/v1/customers/{id}/ledger/adjustments [post]
+func AdjustCustomerBalance(c *gin.Context) {
+	customerID, ok := parseCustomerID(c)
+	if !ok {
+		return
+	}
+
+	var req models.BalanceAdjustmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.Error(c, "请求参数错误")
+		return
+	}
+	if req.Amount == 0 {
+		utils.Error(c, "调账金额不能为0")
+		return
+	}
+	if req.Bucket == "" {
+		req.Bucket = models.BalanceBucketReal
+	}
+	if req.Bucket != models.BalanceBucketReal && req.Bucket != models.BalanceBucketGift {
+		utils.Error(c, "无效的余额类型")
+		return
+	}
+
+	operatorID, exists := middleware.CurrentMemberID(c)
+	if !exists {
+		utils.Error(c, "未找到操作员信息")
+		return
+	}
+
+	var entry *models.WalletLedgerEntry
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var financial models.CustomerFinancialInfo
+		if err := forUpdate(tx).Where("customer_id = ?", customerID).
+			FirstOrCreate(&financial, models.CustomerFinancialInfo{CustomerID: customerID}).Error; err != nil {
+			return err
+		}
+
+		posting := walletPosting{
+			EntryType:  models.LedgerEntryAdjustment,
+			Amount:     req.Amount.Abs(),
+			In:         req.Amount.IsPositive(),
+			OperatorID: operatorID,
+			Notes:      req.Reason,
+		}
+		if req.Bucket == models.BalanceBucketGift {
+			posting.GiftAmount = posting.Amount
+		}
+
+		var err error
+		entry, err = postWalletEntry(tx, &financial, posting)
+		if err != nil {
+			return err
+		}
+		return saveCustomerFinancial(tx, &financial)
+	})
+	if err != nil {
+		if errors.Is(err, errInsufficientBalance) {
+			utils.Error(c, "客户余额不足，无法扣减")
+		} else if errors.Is(err, errVersionConflict) {
+			utils.Conflict(c, err.Error())
+		} else {
+			utils.Error(c, "调账失败")
+		}
+		return
+	}
+
+	logOperation(operatorID, "调账", "客户管理", fmt.Sprintf("调整客户余额：%s元，原因：%s", req.Amount, req.Reason),
+		strconv.FormatUint(uint64(customerID), 10), "客户", c.ClientIP(), c.GetHeader("User-Agent"))
+
+	utils.SuccessWithMessage(c, "调账成功", entry)
+}
+
+// ReverseLedgerEntry 冲正钱包流水
+// @Summary 冲正钱包流水
+// @Description 对充值、赠送或调账流水做反向记账，每条流水只能冲正一次；订单扣款和退款请通过订单退回处理
+// @Tags 客户管理
+// @Accept json
+// @Produce json
+// @Param id path int true "客户ID"
+// @Param entryId path int true "流水ID"
+// @Param data body models.ReverseLedgerEntryRequest true "冲正原因"
+// @Success 200 {object} models.Response{data=models.WalletLedgerEntry}
+// @Failure 409 {object} models.Response "该流水已冲正或并发修改冲突"
+// @Router /api/v1/customers/{id}/ledger/{entryId}/reverse [post]
+func ReverseLedgerEntry(c *gin.Context) {
+	customerID, ok := parseCustomerID(c)
+	if !ok {
+		return
+	}
+	entryID, err := strconv.ParseUint(c.Param("entryId"), 10, 32)
+	if err != nil {
+		utils.Error(c, "无效的流水ID")
+		return
+	}
+
+	var req models.ReverseLedgerEntryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.Error(c, "请求参数错误")
+		return
+	}
+
+	operatorID, exists := middleware.CurrentMemberID(c)
+	if !exists {
+		utils.Error(c, "未找到操作员信息")
+		return
+	}
+
+	var original models.WalletLedgerEntry
+	if err := database.DB.Where("entry_id = ? AND customer_id = ?", entryID, customerID).First(&original).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.NotFound(c, "流水不存在")
+		} else {
+			utils.Error(c, "查询流水失败")
+		}
+		return
+	}
+
+	switch original.EntryType {
+	case models.LedgerEntryRecharge, models.LedgerEntryGift, models.LedgerEntryAdjustment:
+	default:
+		utils.Error(c, "该类型流水不能直接冲正")
+		return
+	}
+
+	reversal := models.WalletLedgerEntry{
+		CustomerID:    customerID,
+		EntryType:     models.LedgerEntryReversal,
+		DebitAccount:  original.CreditAccount,
+		CreditAccount: original.DebitAccount,
+		Amount:        original.Amount,
+		GiftAmount:    original.GiftAmount,
+		ReferenceType: models.LedgerRefEntry,
+		ReferenceID:   original.EntryID,
+		ReversalOfID:  &original.EntryID,
+		OperatorID:    &operatorID,
+		Notes:         req.Reason,
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var financial models.CustomerFinancialInfo
+		if err := forUpdate(tx).Where("customer_id = ?", customerID).First(&financial).Error; err != nil {
+			return err
+		}
+		// 客户财务信息行锁使同一客户的冲正串行执行，锁内检查是否已冲正；唯一索引兜底
+		var count int64
+		if err := tx.Model(&models.WalletLedgerEntry{}).Where("reversal_of_id = ?", original.EntryID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return errAlreadyReversed
+		}
+		if err := appendWalletEntry(tx, &financial, &reversal); err != nil {
+			if errors.Is(err, gorm.ErrDuplicatedKey) {
+				return errAlreadyReversed
+			}
+			return err
+		}
+		if original.EntryType == models.LedgerEntryRecharge {
+			financial.TotalRealCharge -= original.Amount
+		}
+		return saveCustomerFinancial(tx, &financial)
+	})
+	if err != nil {
+		if errors.Is(err, errInsufficientBalance) {
+			utils.Error(c, "客户余额不足，无法冲正")
+		} else if errors.Is(err, errAlreadyReversed) {
+			utils.Conflict(c, err.Error())
+		} else if errors.Is(err, errVersionConflict) {
+			utils.Conflict(c, err.Error())
+		} else {
+			utils.Error(c, "冲正失败")
+		}
+		return
+	}
+
+	logOperation(operatorID, "冲正", "客户管理", fmt.Sprintf("冲正钱包流水%d：%s元，原因：%s", original.EntryID, original.Amount, req.Reason),
+		strconv.FormatUint(uint64(customerID), 10), "客户", c.ClientIP(), c.GetHeader("User-Agent"))
+
+	utils.SuccessWithMessage(c, "冲正成功", reversal)
+}
@@ -0,0 +1,295 @@
+package controllers
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"tangsong-esports/database"
+	"tangsong-esports/middleware"
+	"tangsong-esports/models"
+	"tangsong-esports/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// loginLockPolicies 从系统配置读取账号和IP的锁定策略，缺省时使用内置默认值
+func loginLockPolicies() (utils.LoginLockPolicy, utils.LoginLockPolicy) {
+	values := map[string]string{}
+	var configs []models.SystemConfig
+	database.DB.Where("config_key LIKE ? AND is_active = ?", "login_%", true).Find(&configs)
+	for _, cfg := range configs {
+		values[cfg.ConfigKey] = cfg.ConfigValue
+	}
+
+	intValue := func(key string, def int) int {
+		if v, err := strconv.Atoi(values[key]); err == nil && v >= 0 {
+			return v
+		}
+		return def
+	}
+
+	window := time.Duration(intValue("login_failure_window_minutes", 15)) * time.Minute
+	lock := time.Duration(intValue("login_lock_minutes", 15)) * time.Minute
+	maxLock := time.Duration(intValue("login_lock_max_minutes", 1440)) * time.Minute
+
+	account := utils.LoginLockPolicy{
+		MaxFailures:     intValue("login_max_failures_per_account", 5),
+		Window:          window,
+		LockDuration:    lock,
+		MaxLockDuration: maxLock,
+	}
+	ip := account
+	ip.MaxFailures = intValue("login_max_failures_per_ip", 20)
+	return account, ip
+}
+
+func loginAccountKey(subjectType, account string) string {
+	return "account:" + subjectType + ":" + account
+}
+
+func loginIPKey(ip string) string {
+	return "ip:" + ip
+}
+
+// loginLockedFor 检查账号或IP是否处于锁定期，返回剩余锁定时长
+func loginLockedFor(subjectType, account, ip string) time.Duration {
+	limiter := utils.DefaultLoginLimiter()
+	accountLock := limiter.LockedFor(loginAccountKey(subjectType, account))
+	ipLock := limiter.LockedFor(loginIPKey(ip))
+	if ipLock > accountLock {
+		return ipLock
+	}
+	return accountLock
+}
+
+// recordLoginFailure 累计账号和IP的失败次数，返回触发的锁定时长
+func recordLoginFailure(subjectType, account, ip string) time.Duration {
+	accountPolicy, ipPolicy := loginLockPolicies()
+	limiter := utils.DefaultLoginLimiter()
+	accountLock := limiter.RecordFailure(loginAccountKey(subjectType, account), accountPolicy)
+	ipLock := limiter.RecordFailure(loginIPKey(ip), ipPolicy)
+	if ipLock > accountLock {
+		accountLock = ipLock
+	}
+	if accountLock > 0 {
+		log.Printf("[LoginGuard] 登录失败次数过多，锁定 %s/%s (IP: %s) %v", subjectType, account, ip, accountLock)
+	}
+	return accountLock
+}
+
+// resetLoginFailures 登录成功后清除账号的失败计数
+func resetLoginFailures(subjectType, account string) {
+	utils.DefaultLoginLimiter().Reset(loginAccountKey(subjectType, account))
+}
+
+// loginFailed 记录凭据错误并响应，触发锁定时提示剩余时间
+func loginFailed(c *gin.Context, subjectType, account, message string) {
+	if locked := recordLoginFailure(subjectType, account, c.ClientIP()); locked > 0 {
+		utils.TooManyRequests(c, loginLockedMessage(locked))
+		return
+	}
+	utils.Error(c, message)
+}
+
+// loginLockedMessage 锁定提示，按分钟向上取整
+func loginLockedMessage(remaining time.Duration) string {
+	minutes := int(math.Ceil(remaining.Minutes()))
+	return fmt.Sprintf("登录失败次数过多，请%d分钟后再试", minutes)
+}
+
+// recordMemberLogin 写入内部成员登录日志
+func recordMemberLogin(c *gin.Context, memberID uint, status, reason string) {
+	database.DB.Create(&models.MemberLoginLogs{
+		MemberID:      memberID,
+		LoginTime:     time.Now(),
+		LoginIP:       c.ClientIP(),
+		UserAgent:     c.GetHeader("User-Agent"),
+		LoginStatus:   status,
+		FailureReason: reason,
+	})
+}
+
+// recordCustomerLogin 写入客户登录日志
+func recordCustomerLogin(c *gin.Context, customerID uint, status, reason string) {
+	database.DB.Create(&models.CustomerLoginLogs{
+		CustomerID:    customerID,
+		LoginTime:     time.Now(),
+		LoginIP:       c.ClientIP(),
+		UserAgent:     c.GetHeader("User-Agent"),
+		LoginStatus:   status,
+		FailureReason: reason,
+	})
+}
+
+// UnlockLogin 解除登录锁定
+// @Summary 解除登录锁定
+// @Description 管理员解除账号或IP的登录锁定
+// @Tags 会话管理
+// @Accept json
+// @Produce json
+// @Param data body models.LoginUnlockRequest true "解锁信息"
+// @Success 200 {object} models.Response{data=models.StandardResponse}
+// @Router /api/v1/login-locks/unlock [post]
+func UnlockLogin(c *gin.Context) {
+	var req models.LoginUnlockRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.Error(c, "请求参数错误")
+		return
+	}
+	if req.SubjectType != utils.SubjectStaff && req.SubjectType != utils.SubjectCustomer {
+		utils.Error(c, "无效的主体类型")
+		return
+	}
+	if req.Account == "" && req.IP == "" {
+		utils.Error(c, "账号和IP至少填写一项")
+		return
+	}
+
+	limiter := utils.DefaultLoginLimiter()
+	if req.Account != "" {
+		limiter.Reset(loginAccountKey(req.SubjectType, req.Account))
+	}
+	if req.IP != "" {
+		limiter.Reset(loginIPKey(req.IP))
+	}
+
+	operatorID, _ := middleware.CurrentMemberID(c)
+	logOperation(operatorID, "解锁", "会话管理",
+		fmt.Sprintf("解除登录锁定：%s/%s IP:%s", req.SubjectType, req.Account, req.IP),
+		req.Account, req.SubjectType, c.ClientIP(), c.GetHeader("User-Agent"))
+
+	utils.SuccessWithMessage(c, "解除锁定成功", models.StandardResponse{
+		Success: true,
+		Message: "解除锁定成功",
+	})
+}
+
+// GetMemberLoginLogs 获取内部成员登录日志
+// @Summary 获取内部成员登录日志
+// @Description 分页获取内部成员登录记录，包含失败记录
+// @Tags 系统管理
+// @Accept json
+// @Produce json
+// @Param page query int false "页码" default(1)
+// @Param page_size query int false "每页数量" default(10)
+// @Param member_id query int false "成员ID"
+// @Param login_status query string false "登录状态(成功/失败)"
+// @Param login_ip query string false "登录IP"
+// @Param start_date query string false "开始日期(YYYY-MM-DD)"
+// @Param end_date query string false "结束日期(YYYY-MM-DD)"
+// @Success 200 {object} models.Response{data=models.PageResponse}
+// @Router /api/v1/login-logs/members [get]
+func GetMemberLoginLogs(c *gin.Context) {
+	var req models.PageRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		utils.Error(c, "请求参数错误")
+		return
+	}
+
+	query := database.DB.Model(&models.MemberLoginLogs{})
+	if memberID := c.Query("member_id"); memberID != "" {
+		query = query.Where("member_id = ?", memberID)
+	}
+	queryLoginLogs(c, query, req, &[]models.MemberLoginLogs{}, "Member")
+}
+
+// GetCustomerLoginLogs 获取客户登录日志
+// @Summary 获取客户登录日志
+// @Description 分页获取客户登录记录，包含失败记录
+// @Tags 系统管理
+// @Accept json
+// @Produce json
+// @Param page query int false "页码" default(1)
+// @Param page_size query int false "每页数量" default(10)
+// @Param customer_id query int false "客户ID"
+// @Param login_status query string false "登录状态(成功/失败)"
+// @Param login_ip query string false "登录IP"
+// @Param start_date query string false "开始日期(YYYY-MM-DD)"
+// @Param end_date query string false "结束日期(YYYY-MM-DD)"
+// @Success 200 {object} models.Response{data=models.PageResponse}
+// @Router /api/v1/login-logs/customers [get]
+func GetCustomerLoginLogs(c *gin.Context) {
+	var req models.PageRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		utils.Error(c, "请求参数错误")
+		return
+	}
+
+	query := database.DB.Model(&models.CustomerLoginLogs{})
+	if customerID := c.Query("customer_id"); customerID != "" {
+		query = query.Where("customer_id = ?", customerID)
+	}
+	queryLoginLogs(c, query, req, &[]models.CustomerLoginLogs{}, "Customer")
+}
+
+// GetMyCustomerLoginLogs 获取当前客户的登录记录
+// @Summary 获取我的登录记录
+// @Description 客户查看自己的登录记录
+// @Tags 客户认证
+// @Accept json
+// @Produce json
+// @Param page query int false "页码" default(1)
+// @Param page_size query int false "每页数量" default(10)
+// @Success 200 {object} models.Response{data=models.PageResponse}
+// @Router /api/v1/customer/login-logs [get]
+func GetMyCustomerLoginLogs(c *gin.Context) {
+	customerID, exists := middleware.CurrentCustomerID(c)
+	if !exists {
+		utils.Error(c, "未找到客户信息")
+		return
+	}
+
+	var req models.PageRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		utils.Error(c, "请求参数错误")
+		return
+	}
+
+	query := database.DB.Model(&models.CustomerLoginLogs{}).Where("customer_id = ?", customerID)
+	queryLoginLogs(c, query, req, &[]models.CustomerLoginLogs{}, "")
+}
+
+// queryLoginLogs 登录日志通用的筛选与分页
+func queryLoginLogs(c *gin.Context, query *gorm.DB, req models.PageRequest, logs interface{}, preload string) {
+	if req.Page <= 0 {
+		req.Page = 1
+	}
+	if req.PageSize <= 0 {
+		req.PageSize = 10
+	}
+
+	if status := c.Query("login_status"); status != "" {
+		query = query.Where("login_status = ?", status)
+	}
+	if ip := c.Query("login_ip"); ip != "" {
+		query = query.Where("login_ip = ?", ip)
+	}
+	if startDate := c.Query("start_date"); startDate != "" {
+		query = query.Where("DATE(login_time) >= ?", startDate)
+	}
+	if endDate := c.Query("end_date"); endDate != "" {
+		query = query.Where("DATE(login_time) <= ?", endDate)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	if preload != "" {
+		query = query.Preload(preload)
+	}
+	offset := (req.Page - 1) * req.PageSize
+	if err := query.Order("login_time DESC").Offset(offset).Limit(req.PageSize).Find(logs).Error; err != nil {
+		utils.Error(c, "查询登录日志失败")
+		return
+	}
+
+	utils.Success(c, models.PageResponse{
+		List:     logs,
+		Total:    total,
+		Page:     req.Page,
+		PageSize: req.PageSize,
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"log"
 	"strconv"
 	"tangsong-esports/database"
+	"tangsong-esports/middleware"
 	"tangsong-esports/models"
 	"tangsong-esports/utils"
 	"time"
@@ -110,6 +111,16 @@ func CreateMember(c *gin.Context) {
 		return
 	}
 
+	// 校验密码策略
+	if req.Password == "" {
+		utils.Error(c, "密码不能为空")
+		return
+	}
+	if err := checkNewPassword(utils.SubjectStaff, 0, req.Account, req.Password, ""); err != nil {
+		utils.Error(c, err.Error())
+		return
+	}
+
 	// 加密密码
 	hashedPassword, err := utils.HashPassword(req.Password)
 	if err != nil {
@@ -138,6 +149,11 @@ func CreateMember(c *gin.Context) {
 		utils.Error(c, "创建成员失败")
 		return
 	}
+	if err := recordPasswordHistory(tx, utils.SubjectStaff, member.MemberID, hashedPassword); err != nil {
+		tx.Rollback()
+		utils.Error(c, "创建成员失败")
+		return
+	}
 
 	// 创建权限设置
 	permissions := models.MemberPermissions{
@@ -233,15 +249,36 @@ func UpdateMember(c *gin.Context) {
 	member.Department = req.Department
 	member.UserRole = req.UserRole
 	member.Notes = req.Notes
+	if req.Status != "" {
+		if req.Status != "正常" && req.Status != "禁用" {
+			tx.Rollback()
+			utils.Error(c, "无效的账户状态")
+			return
+		}
+		member.Status = req.Status
+	}
+	if req.IsEnabled != nil {
+		member.IsEnabled = *req.IsEnabled
+	}
 
-	// 如果提供了新密码，则更新密码
+	// 如果提供了新密码，则校验密码策略后更新密码
 	if req.Password != "" {
+		if err := checkNewPassword(utils.SubjectStaff, member.MemberID, member.Account, req.Password, member.PasswordHash); err != nil {
+			tx.Rollback()
+			utils.Error(c, err.Error())
+			return
+		}
 		hashedPassword, err := utils.HashPassword(req.Password)
 		if err != nil {
 			tx.Rollback()
 			utils.Error(c, "密码加密失败")
 			return
 		}
+		if err := recordPasswordHistory(tx, utils.SubjectStaff, member.MemberID, hashedPassword); err != nil {
+			tx.Rollback()
+			utils.Error(c, "更新成员失败")
+			return
+		}
 		member.PasswordHash = hashedPassword
 	}
 
@@ -294,6 +331,12 @@ func UpdateMember(c *gin.Context) {
 
 	// 提交事务
 	tx.Commit()
+	middleware.InvalidatePermissionCache()
+
+	// 账户被禁用时注销其全部会话
+	if member.Status != "正常" || !member.IsEnabled {
+		revokeSubjectSessions(utils.SubjectStaff, member.MemberID, models.SessionRevokeAccountOff)
+	}
 
 	// 重新查询完整信息
 	database.DB.Preload("Permissions").Preload("FinancialSettings").Preload("Relationships").
@@ -335,6 +378,8 @@ func DeleteMember(c *gin.Context) {
 		utils.Error(c, "删除失败")
 		return
 	}
+	middleware.InvalidatePermissionCache()
+	revokeSubjectSessions(utils.SubjectStaff, member.MemberID, models.SessionRevokeAccountDelete)
 
 	utils.SuccessWithMessage(c, "删除成员成功", nil)
 }
@@ -2,8 +2,10 @@ package controllers
 
 import (
 	"fmt"
+	"sort"
 	"strconv"
 	"tangsong-esports/database"
+	"tangsong-esports/middleware"
 	"tangsong-esports/models"
 	"tangsong-esports/utils"
 	"time"
@@ -78,6 +80,7 @@ func CreateOrderCategory(c *gin.Context) {
 		IsRequired:      req.IsRequired,
 		IsAccelerated:   req.IsAccelerated,
 		AdditionalInfo:  req.AdditionalInfo,
+		Aliases:         req.Aliases,
 	}
 
 	if err := database.DB.Create(&category).Error; err != nil {
@@ -132,6 +135,7 @@ func UpdateOrderCategory(c *gin.Context) {
 	category.IsRequired = req.IsRequired
 	category.IsAccelerated = req.IsAccelerated
 	category.AdditionalInfo = req.AdditionalInfo
+	category.Aliases = req.Aliases
 
 	if err := database.DB.Save(&category).Error; err != nil {
 		utils.Error(c, "更新订单类别失败")
@@ -200,19 +204,14 @@ func GetOrders(c *gin.Context) {
 		return
 	}
 	//判断当前用户身份
-	memberID, exists := c.Get("member_id")
+	memberID, exists := middleware.CurrentMemberID(c)
 	if !exists {
 		utils.Error(c, "未找到报单人信息")
 		return
 	}
-	var role string
-	isAdmin := true
-	query := database.DB.Model(&models.PlaymateOrder{}).Where("playmate_orders.reporter_id = ?", memberID)
-	// 检查权限是不是超级管理员、管理员
-	database.DB.Model(&models.InternalMember{}).Select("user_role").Where("member_id = ?", memberID).First(&role)
-	if role != "超级管理员" && role != "管理员" {
-		isAdmin = false
-	}
+	var query *gorm.DB
+	// 拥有查看全部订单权限的用户可以查询所有订单
+	isAdmin := middleware.HasPermission(c, models.PermOrderViewAll)
 	// 设置默认值
 
 	if req.Page <= 0 {
@@ -282,12 +281,15 @@ func GetOrders(c *gin.Context) {
 
 // CreateOrder 创建订单
 // @Summary 创建陪玩订单
-// @Description 创建新的陪玩订单
+// @Description 创建新的陪玩订单，单价取自所选价目、填写的单价或类别默认价目，并按客户专属折扣和手动折扣计算最终价格；余额支付的订单会冻结客户的订单金额，可用余额不足时创建失败
 // @Tags 订单管理
 // @Accept json
 // @Produce json
+// @Param Idempotency-Key header string false "幂等键，重试时携带相同的值"
 // @Param order body models.OrderCreateRequest true "订单信息"
 // @Success 200 {object} models.Response{data=models.PlaymateOrder}
+// @Failure 403 {object} models.Response "没有设置手动折扣或取消专属折扣的权限"
+// @Failure 422 {object} models.Response{data=[]models.FieldError} "时间、时长、单价或折扣校验失败，或与报单人的其他订单时间重叠"
 // @Router /api/v1/orders [post]
 func CreateOrder(c *gin.Context) {
 	var req models.OrderCreateRequest
@@ -298,7 +300,7 @@ func CreateOrder(c *gin.Context) {
 	}
 
 	// 获取报单人ID
-	reporterID, exists := c.Get("member_id")
+	reporterID, exists := middleware.CurrentMemberID(c)
 	if !exists {
 		utils.Error(c, "未找到报单人信息")
 		return
@@ -320,9 +322,20 @@ func CreateOrder(c *gin.Context) {
 	// 开启事务
 	tx := database.DB.Begin()
 
+	// 校验时间、时长和时间重叠
+	if errs, err := validateOrderRequest(tx, reporterID, &req, 0); err != nil {
+		tx.Rollback()
+		respondOrderStateError(c, err, "校验订单失败")
+		return
+	} else if len(errs) > 0 {
+		tx.Rollback()
+		utils.ValidationFailed(c, errs)
+		return
+	}
+
 	// 创建订单基本信息
 	order := models.PlaymateOrder{
-		ReporterID:            reporterID.(uint),
+		ReporterID:            reporterID,
 		CustomerID:            req.CustomerID,
 		OrderCategoryID:       req.OrderCategoryID,
 		ProjectCategory:       req.ProjectCategory,
@@ -343,27 +356,30 @@ func CreateOrder(c *gin.Context) {
 		return
 	}
 
-	// 计算价格
-	totalPrice := req.UnitPrice * req.DurationHours
-	finalPrice := totalPrice
-
-	// 创建价格信息
-	pricing := models.OrderPricing{
-		OrderID:    order.OrderID,
-		UnitPrice:  req.UnitPrice,
-		TotalPrice: totalPrice,
-		FinalPrice: finalPrice,
+	// 计算价格并创建价格信息和折扣明细
+	pricing := models.OrderPricing{OrderID: order.OrderID}
+	if errs, err := applyPricingRequest(c, tx, &order, &pricing, &req); err != nil {
+		tx.Rollback()
+		respondOrderStateError(c, err, "创建价格信息失败")
+		return
+	} else if len(errs) > 0 {
+		tx.Rollback()
+		utils.ValidationFailed(c, errs)
+		return
 	}
-	if err := tx.Create(&pricing).Error; err != nil {
+	finalPrice := pricing.FinalPrice
+
+	// 余额支付的订单提交时冻结订单金额
+	if err := freezeOrderBalance(tx, &order, finalPrice); err != nil {
 		tx.Rollback()
-		utils.Error(c, "创建价格信息失败")
+		respondOrderStateError(c, err, "冻结客户余额失败")
 		return
 	}
 
 	// 创建工作流状态
 	workflow := models.OrderWorkflow{
 		OrderID:     order.OrderID,
-		OrderStatus: "待处理",
+		OrderStatus: models.OrderStatusPending,
 	}
 	if err := tx.Create(&workflow).Error; err != nil {
 		tx.Rollback()
@@ -388,7 +404,7 @@ func CreateOrder(c *gin.Context) {
 
 	// 重新查询完整信息
 	database.DB.Preload("Reporter.FinancialSettings").Preload("Customer").Preload("Category").
-		Preload("Pricing").Preload("Workflow").Preload("PaymentInfo").
+		Preload("Pricing.Discounts").Preload("Workflow").Preload("PaymentInfo").
 		First(&order, order.OrderID)
 
 	utils.SuccessWithMessage(c, "创建订单成功", order)
@@ -396,50 +412,52 @@ func CreateOrder(c *gin.Context) {
 
 // UpdateOrder 更新订单
 // @Summary 更新陪玩订单
-// @Description 更新陪玩订单信息
+// @Description 更新陪玩订单信息并重新计价，未传手动折扣时保留原有的手动折扣
 // @Tags 订单管理
 // @Accept json
 // @Produce json
 // @Param id path int true "订单ID"
 // @Param order body models.OrderCreateRequest true "订单信息"
 // @Success 200 {object} models.Response{data=models.PlaymateOrder}
+// @Failure 403 {object} models.Response "不是自己报的单，或没有设置手动折扣、取消专属折扣的权限"
+// @Failure 422 {object} models.Response{data=[]models.FieldError} "时间、时长、单价或折扣校验失败，或与报单人的其他订单时间重叠"
 // @Router /api/v1/orders/{id} [put]
 func UpdateOrder(c *gin.Context) {
-	idStr := c.Param("id")
-	id, err := strconv.ParseUint(idStr, 10, 32)
-	if err != nil {
-		utils.Error(c, "无效的订单ID")
-		return
-	}
-
 	var req models.OrderCreateRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		utils.Error(c, "请求参数错误")
 		return
 	}
 
-	// 查找订单
-	var order models.PlaymateOrder
-	if err := database.DB.First(&order, uint(id)).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			utils.NotFound(c, "订单不存在")
-		} else {
-			utils.Error(c, "查询失败")
-		}
+	// 查找订单，没有查看全部订单权限的成员只能修改自己报的单
+	order, ok := findAccessibleOrder(c)
+	if !ok {
 		return
 	}
 
-	// 检查订单状态是否允许修改
+	// 开启事务
+	tx := database.DB.Begin()
+
+	// 锁定工作流后检查订单状态是否允许修改，避免与审批并发时修改已审批的订单
 	var workflow models.OrderWorkflow
-	if err := database.DB.Where("order_id = ?", order.OrderID).First(&workflow).Error; err == nil {
-		if workflow.OrderStatus != "待处理" {
+	if err := forUpdate(tx).Where("order_id = ?", order.OrderID).First(&workflow).Error; err == nil {
+		if workflow.OrderStatus != models.OrderStatusPending {
+			tx.Rollback()
 			utils.Error(c, "只有待处理状态的订单才能修改")
 			return
 		}
 	}
 
-	// 开启事务
-	tx := database.DB.Begin()
+	// 校验时间、时长和时间重叠
+	if errs, err := validateOrderRequest(tx, order.ReporterID, &req, order.OrderID); err != nil {
+		tx.Rollback()
+		respondOrderStateError(c, err, "校验订单失败")
+		return
+	} else if len(errs) > 0 {
+		tx.Rollback()
+		utils.ValidationFailed(c, errs)
+		return
+	}
 
 	// 更新订单基本信息
 	order.ProjectCategory = req.ProjectCategory
@@ -450,22 +468,34 @@ func UpdateOrder(c *gin.Context) {
 	order.InternalNotes = req.InternalNotes
 	order.OrderNotes = req.OrderNotes
 
-	if err := tx.Save(&order).Error; err != nil {
+	if err := tx.Save(order).Error; err != nil {
 		tx.Rollback()
 		utils.Error(c, "更新订单失败")
 		return
 	}
 
-	// 更新价格信息
+	// 重新计价，没有价格信息的历史订单补建
 	var pricing models.OrderPricing
-	if err := tx.Where("order_id = ?", order.OrderID).First(&pricing).Error; err == nil {
-		totalPrice := req.UnitPrice * req.DurationHours
-		finalPrice := totalPrice
+	if err := tx.Where("order_id = ?", order.OrderID).First(&pricing).Error; err != nil && err != gorm.ErrRecordNotFound {
+		tx.Rollback()
+		utils.Error(c, "查询价格信息失败")
+		return
+	}
+	if errs, err := applyPricingRequest(c, tx, order, &pricing, &req); err != nil {
+		tx.Rollback()
+		respondOrderStateError(c, err, "更新价格信息失败")
+		return
+	} else if len(errs) > 0 {
+		tx.Rollback()
+		utils.ValidationFailed(c, errs)
+		return
+	}
 
-		pricing.UnitPrice = req.UnitPrice
-		pricing.TotalPrice = totalPrice
-		pricing.FinalPrice = finalPrice
-		tx.Save(&pricing)
+	// 金额变化时同步调整冻结金额
+	if err := adjustOrderHold(tx, order, pricing.FinalPrice); err != nil {
+		tx.Rollback()
+		respondOrderStateError(c, err, "调整冻结余额失败")
+		return
 	}
 
 	// 提交事务
@@ -473,8 +503,8 @@ func UpdateOrder(c *gin.Context) {
 
 	// 重新查询完整信息
 	database.DB.Preload("Reporter.FinancialSettings").Preload("Customer").Preload("Category").
-		Preload("Pricing").Preload("Workflow").Preload("PaymentInfo").
-		First(&order, order.OrderID)
+		Preload("Pricing.Discounts").Preload("Workflow").Preload("PaymentInfo").
+		First(order, order.OrderID)
 
 	utils.SuccessWithMessage(c, "更新订单成功", order)
 }
@@ -499,7 +529,7 @@ func GetOrderByID(c *gin.Context) {
 	var order models.PlaymateOrder
 	if err := database.DB.
 		Preload("Reporter.FinancialSettings").Preload("Customer").Preload("Category").
-		Preload("Pricing").Preload("Workflow").Preload("PaymentInfo").Preload("Images").
+		Preload("Pricing.Discounts").Preload("Workflow").Preload("PaymentInfo").Preload("Images").Preload("ImageDuplicates").
 		First(&order, uint(id)).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			utils.NotFound(c, "订单不存在")
@@ -509,18 +539,28 @@ func GetOrderByID(c *gin.Context) {
 		return
 	}
 
+	// 没有查看全部订单权限的用户只能查看自己报的单
+	if !middleware.HasPermission(c, models.PermOrderViewAll) {
+		memberID, _ := middleware.CurrentMemberID(c)
+		if order.ReporterID != memberID {
+			utils.Forbidden(c, "无权限查看该订单")
+			return
+		}
+	}
+
 	// 手动查询客户信息并设置customerName
 	var customer models.Customer
 	if err := database.DB.Where("customer_id = ? AND deleted_at IS NULL", order.CustomerID).First(&customer).Error; err == nil {
 		order.CustomerName = customer.CustomerName
 	}
+	signOrderImages(order.Images)
 
 	utils.Success(c, order)
 }
 
 // UpdateOrderStatus 更新订单状态
 // @Summary 更新订单状态
-// @Description 更新陪玩订单状态
+// @Description 按订单状态流转规则更新陪玩订单状态，不允许的流转返回409
 // @Tags 订单管理
 // @Accept json
 // @Produce json
@@ -542,97 +582,37 @@ func UpdateOrderStatus(c *gin.Context) {
 		return
 	}
 
-	// 获取审批人ID
-	approverID, exists := c.Get("member_id")
-	if !exists {
-		utils.Error(c, "未找到审批人信息")
+	// 获取审批人信息
+	approver, ok := currentMember(c)
+	if !ok {
 		return
 	}
 
-	// 查找订单工作流
-	var workflow models.OrderWorkflow
-	if err := database.DB.Where("order_id = ?", uint(id)).First(&workflow).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			utils.NotFound(c, "订单不存在")
-		} else {
-			utils.Error(c, "查询失败")
-		}
+	var result *orderTransitionResult
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		result, err = transitionOrder(tx, orderTransitionInput{
+			OrderID:  uint(id),
+			ToStatus: req.OrderStatus,
+			Operator: approver,
+			Reason:   req.RejectionReason,
+		})
+		return err
+	})
+	if err != nil {
+		respondOrderStateError(c, err, "更新状态失败")
 		return
 	}
-
-	// 更新状态
-	workflow.OrderStatus = req.OrderStatus
-	workflow.ApproverID = &[]uint{approverID.(uint)}[0]
-	now := time.Now()
-	workflow.ApprovalTime = &now
-
-	if req.OrderStatus == "驳回" {
-		workflow.RejectionReason = req.RejectionReason
-	}
-
-	if err := database.DB.Save(&workflow).Error; err != nil {
-		utils.Error(c, "更新状态失败")
-		return
+	if result.Refund != nil {
+		logRefund(c, approver.MemberID, result.Refund)
 	}
 
 	// 重新查询完整信息
+	workflow := result.Workflow
 	database.DB.Preload("Order").Preload("Approver").First(&workflow, workflow.WorkflowID)
 
 	utils.SuccessWithMessage(c, "更新状态成功", workflow)
 }
 
-// UploadOrderImages 上传订单图片
-// @Summary 上传订单图片
-// @Description 为订单上传图片
-// @Tags 订单管理
-// @Accept multipart/form-data
-// @Produce json
-// @Param id path int true "订单ID"
-// @Param image_type formData string false "图片类型"
-// @Param notes formData string false "图片备注"
-// @Success 200 {object} models.Response{data=models.OrderImages}
-// @Router /api/v1/orders/{id}/images [post]
-func UploadOrderImages(c *gin.Context) {
-	idStr := c.Param("id")
-	id, err := strconv.ParseUint(idStr, 10, 32)
-	if err != nil {
-		utils.Error(c, "无效的订单ID")
-		return
-	}
-
-	// 验证订单是否存在
-	var order models.PlaymateOrder
-	if err := database.DB.First(&order, uint(id)).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			utils.NotFound(c, "订单不存在")
-		} else {
-			utils.Error(c, "查询订单失败")
-		}
-		return
-	}
-
-	// 获取表单数据
-	imageType := c.PostForm("image_type")
-	notes := c.PostForm("notes")
-
-	// 这里应该实现文件上传逻辑
-	// 暂时返回模拟数据
-	orderImage := models.OrderImages{
-		OrderID:   uint(id),
-		ImageURL:  "/uploads/order_images/example.jpg", // 实际应该是上传后的文件路径
-		ImageType: imageType,
-		Notes:     notes,
-		UploadAt:  time.Now(),
-	}
-
-	if err := database.DB.Create(&orderImage).Error; err != nil {
-		utils.Error(c, "保存图片记录失败")
-		return
-	}
-
-	utils.SuccessWithMessage(c, "上传图片成功", orderImage)
-}
-
 // GetOrderStats 获取订单统计数据
 // @Summary 获取订单统计数据
 // @Description 根据条件统计订单数量、时长、金额和佣金
@@ -680,20 +660,20 @@ func GetOrderStats(c *gin.Context) {
 	if req.EndDate != "" {
 		query = query.Where("DATE(playmate_orders.end_time) <= ?", req.EndDate)
 	}
+	query = query.Session(&gorm.Session{})
 
 	// 执行统计查询
 	var result struct {
-		TotalCount         int64   `json:"total_count"`
-		TotalDurationHours float64 `json:"total_duration_hours"`
-		TotalAmount        float64 `json:"total_amount"`
-		TotalCommission    float64 `json:"total_commission"`
+		TotalCount         int64          `json:"total_count"`
+		TotalDurationHours models.Decimal `json:"total_duration_hours"`
+		TotalAmount        models.Money   `json:"total_amount"`
+		TotalCommission    models.Money   `json:"total_commission"`
 	}
 
 	err := query.Select(`
 		COUNT(DISTINCT playmate_orders.order_id) as total_count,
 		COALESCE(SUM(playmate_orders.duration_hours), 0) as total_duration_hours,
-		COALESCE(SUM(order_pricing.final_price), 0) as total_amount,
-		COALESCE(SUM(order_pricing.final_price * order_categories.commission_rate), 0) as total_commission
+		COALESCE(SUM(order_pricing.final_price), 0) as total_amount
 	`).Scan(&result).Error
 
 	if err != nil {
@@ -701,6 +681,18 @@ func GetOrderStats(c *gin.Context) {
 		return
 	}
 
+	// 佣金按每个订单的提成比例逐单计算
+	var commissionLines []commissionLine
+	if err := query.Select("playmate_orders.order_id, playmate_orders.reporter_id, playmate_orders.order_category_id, order_pricing.final_price").
+		Scan(&commissionLines).Error; err != nil {
+		utils.Error(c, "统计查询失败")
+		return
+	}
+	if result.TotalCommission, err = sumOrderCommission(database.DB, commissionLines); err != nil {
+		utils.Error(c, "计算佣金失败")
+		return
+	}
+
 	// 构建响应数据
 	statsData := models.GetOrderStatsResData{
 		TotalCount:         int(result.TotalCount),
@@ -716,7 +708,7 @@ func GetOrderStats(c *gin.Context) {
 
 // GetPendingOrders 获取待审批订单列表
 // @Summary 获取待审批订单列表
-// @Description 获取所有待处理状态的订单列表
+// @Description 获取所有待处理状态的订单列表，image_duplicates 为订单图片与其他订单图片重复的标记
 // @Tags 订单审批
 // @Accept json
 // @Produce json
@@ -740,7 +732,7 @@ func GetPendingOrders(c *gin.Context) {
 	// 构建查询，只查询待处理状态的订单
 	query := database.DB.Model(&models.PlaymateOrder{}).
 		Joins("JOIN order_workflow ON playmate_orders.order_id = order_workflow.order_id").
-		Where("order_workflow.order_status = ?", "待处理")
+		Where("order_workflow.order_status = ?", models.OrderStatusPending)
 
 	// 应用筛选条件
 	query = applyOrderFilters(query, req)
@@ -754,7 +746,7 @@ func GetPendingOrders(c *gin.Context) {
 	offset := (req.Page - 1) * req.PageSize
 	err := query.
 		Preload("Reporter.FinancialSettings").Preload("Customer").Preload("Category").
-		Preload("Pricing").Preload("Workflow").Preload("PaymentInfo").
+		Preload("Pricing").Preload("Workflow").Preload("PaymentInfo").Preload("ImageDuplicates").
 		Order("report_time DESC").Offset(offset).Limit(req.PageSize).Find(&orders).Error
 
 	if err != nil {
@@ -831,13 +823,15 @@ func GetApprovalOrders(c *gin.Context) {
 
 // ApproveOrder 审批通过订单
 // @Summary 审批通过订单
-// @Description 将订单状态更新为已确认，同时从客户余额中扣除订单金额并更新支付状态为已付款
+// @Description 将订单状态更新为已确认，审批前按当前价目和客户专属折扣重新计价，再从客户余额中扣除订单金额并更新支付状态为已付款
 // @Tags 订单审批
 // @Accept json
 // @Produce json
 // @Param id path string true "订单ID"
+// @Param Idempotency-Key header string false "幂等键，重试时携带相同的值"
 // @Param data body models.ApproveOrderRequest true "审批信息"
 // @Success 200 {object} models.Response{data=models.StandardResponse}
+// @Failure 409 {object} models.Response "并发修改冲突，请重试"
 // @Router /api/v1/order-approval/{id}/approve [post]
 func ApproveOrder(c *gin.Context) {
 	orderID := c.Param("id")
@@ -853,168 +847,31 @@ func ApproveOrder(c *gin.Context) {
 		return
 	}
 
-	// 获取操作人ID
-	operatorID, exists := c.Get("member_id")
-	if !exists {
-		utils.Error(c, "未找到操作人信息")
-		return
-	}
-
-	// 查找订单工作流
-	var workflow models.OrderWorkflow
-	if err := database.DB.Where("order_id = ?", uint(id)).First(&workflow).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			utils.NotFound(c, "订单不存在")
-		} else {
-			utils.Error(c, "查询失败")
-		}
-		return
-	}
-
-	// 检查当前状态
-	if workflow.OrderStatus != "待处理" {
-		utils.Error(c, "只有待处理状态的订单才能审批")
-		return
-	}
-
 	// 获取操作人信息
-	var operator models.InternalMember
-	if err := database.DB.First(&operator, operatorID).Error; err != nil {
-		utils.Error(c, "获取操作人信息失败")
-		return
-	}
-
-	// 开启事务
-	tx := database.DB.Begin()
-
-	// 记录旧状态
-	oldStatus := workflow.OrderStatus
-
-	// 更新订单状态
-	workflow.OrderStatus = "已确认"
-	workflow.ApproverID = &[]uint{operatorID.(uint)}[0]
-	now := time.Now()
-	workflow.ApprovalTime = &now
-
-	if err := tx.Save(&workflow).Error; err != nil {
-		tx.Rollback()
-		utils.Error(c, "更新订单状态失败")
-		return
-	}
-
-	// 记录操作历史
-	history := models.OrderApprovalHistory{
-		OrderID:      uint(id),
-		OperatorID:   operatorID.(uint),
-		OperatorName: operator.Name,
-		Action:       "approve",
-		FromStatus:   oldStatus,
-		ToStatus:     "已确认",
-		Notes:        req.Notes,
-	}
-
-	if err := tx.Create(&history).Error; err != nil {
-		tx.Rollback()
-		utils.Error(c, "记录操作历史失败")
-		return
-	}
-
-	// === 新增扣款逻辑 ===
-	// 获取订单信息（包括客户ID和价格信息）
-	var order models.PlaymateOrder
-	if err := tx.Preload("Pricing").First(&order, uint(id)).Error; err != nil {
-		tx.Rollback()
-		utils.Error(c, "获取订单信息失败")
-		return
-	}
-	// 检查订单是否允许使用余额支付
-	if order.UseBalancePayment == false {
-		// 更新订单支付状态
-		var paymentInfo models.OrderPaymentInfo
-		if err := tx.Where("order_id = ?", uint(id)).First(&paymentInfo).Error; err != nil {
-			tx.Rollback()
-			utils.Error(c, "获取支付信息失败")
-			return
-		}
-		paymentInfo.PaymentStatus = "已付款"
-		paymentInfo.PaymentMethod = "直接支付"
-		paymentTime := time.Now()
-		paymentInfo.PaymentTime = &paymentTime
-		if err := tx.Save(&paymentInfo).Error; err != nil {
-			tx.Rollback()
-			utils.Error(c, "更新支付状态失败")
-			return
-		}
-		// 提交事务
-		tx.Commit()
-		response := models.StandardResponse{
-			Success: true,
-			Message: fmt.Sprintf("订单审批成功,未走余额支付流程，订单ID: %d", id),
-		}
-
-		utils.SuccessWithMessage(c, "订单审批成功", response)
-		return
-	}
-	// 获取客户财务信息
-	var customerFinancial models.CustomerFinancialInfo
-	if err := tx.Where("customer_id = ?", order.CustomerID).First(&customerFinancial).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			tx.Rollback()
-			utils.Error(c, "客户财务信息不存在，请先为客户充值")
-			return
-		} else {
-			tx.Rollback()
-			utils.Error(c, "获取客户财务信息失败")
-			return
-		}
-	}
-
-	// 计算订单金额
-	originalAmount := order.Pricing.FinalPrice
-	actualAmount := originalAmount
-
-	// 检查余额是否足够
-	if customerFinancial.CurrentBalance < actualAmount {
-		tx.Rollback()
-		utils.Error(c, fmt.Sprintf("客户余额不足，当前余额：%.2f，订单金额：%.2f",
-			customerFinancial.CurrentBalance, actualAmount))
-		return
-	}
-
-	// 扣除客户余额
-	customerFinancial.CurrentBalance -= actualAmount
-	customerFinancial.TotalConsumption += actualAmount
-	if err := tx.Save(&customerFinancial).Error; err != nil {
-		tx.Rollback()
-		utils.Error(c, "扣款失败")
-		return
-	}
-
-	// 更新订单支付状态
-	var paymentInfo models.OrderPaymentInfo
-	if err := tx.Where("order_id = ?", uint(id)).First(&paymentInfo).Error; err != nil {
-		tx.Rollback()
-		utils.Error(c, "获取支付信息失败")
-		return
-	}
-
-	paymentInfo.PaymentStatus = "已付款"
-	paymentInfo.PaymentMethod = "余额支付"
-	paymentTime := time.Now()
-	paymentInfo.PaymentTime = &paymentTime
-	if err := tx.Save(&paymentInfo).Error; err != nil {
-		tx.Rollback()
-		utils.Error(c, "更新支付状态失败")
+	operator, ok := currentMember(c)
+	if !ok {
+		return
+	}
+
+	// 状态流转时完成扣款和支付状态更新
+	var result *orderTransitionResult
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		result, err = transitionOrder(tx, orderTransitionInput{
+			OrderID:  uint(id),
+			ToStatus: models.OrderStatusConfirmed,
+			Operator: operator,
+			Notes:    req.Notes,
+		})
+		return err
+	})
+	if err != nil {
+		respondOrderStateError(c, err, "订单审批失败")
 		return
 	}
 
-	// 提交事务
-	tx.Commit()
-
 	response := models.StandardResponse{
 		Success: true,
-		Message: fmt.Sprintf("订单审批成功！扣款金额：%.2f元",
-			actualAmount),
+		Message: result.Message,
 	}
 
 	utils.SuccessWithMessage(c, "订单审批成功", response)
@@ -1027,6 +884,7 @@ func ApproveOrder(c *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param id path string true "订单ID"
+// @Param Idempotency-Key header string false "幂等键，重试时携带相同的值"
 // @Param data body models.RejectOrderRequest true "驳回信息"
 // @Success 200 {object} models.Response{data=models.StandardResponse}
 // @Router /api/v1/order-approval/{id}/reject [post]
@@ -1044,76 +902,27 @@ func RejectOrder(c *gin.Context) {
 		return
 	}
 
-	// 获取操作人ID
-	operatorID, exists := c.Get("member_id")
-	if !exists {
-		utils.Error(c, "未找到操作人信息")
-		return
-	}
-
-	// 查找订单工作流
-	var workflow models.OrderWorkflow
-	if err := database.DB.Where("order_id = ?", uint(id)).First(&workflow).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			utils.NotFound(c, "订单不存在")
-		} else {
-			utils.Error(c, "查询失败")
-		}
-		return
-	}
-
-	// 检查当前状态
-	if workflow.OrderStatus != "待处理" {
-		utils.Error(c, "只有待处理状态的订单才能驳回")
-		return
-	}
-
 	// 获取操作人信息
-	var operator models.InternalMember
-	if err := database.DB.First(&operator, operatorID).Error; err != nil {
-		utils.Error(c, "获取操作人信息失败")
+	operator, ok := currentMember(c)
+	if !ok {
 		return
 	}
 
-	// 开启事务
-	tx := database.DB.Begin()
-
-	// 记录旧状态
-	oldStatus := workflow.OrderStatus
-
-	// 更新订单状态
-	workflow.OrderStatus = "驳回"
-	workflow.RejectionReason = req.Reason
-	workflow.ApproverID = &[]uint{operatorID.(uint)}[0]
-	now := time.Now()
-	workflow.ApprovalTime = &now
-
-	if err := tx.Save(&workflow).Error; err != nil {
-		tx.Rollback()
-		utils.Error(c, "更新订单状态失败")
-		return
-	}
-
-	// 记录操作历史
-	history := models.OrderApprovalHistory{
-		OrderID:      uint(id),
-		OperatorID:   operatorID.(uint),
-		OperatorName: operator.Name,
-		Action:       "reject",
-		FromStatus:   oldStatus,
-		ToStatus:     "驳回",
-		Reason:       req.Reason,
-		Notes:        req.Notes,
-	}
-
-	if err := tx.Create(&history).Error; err != nil {
-		tx.Rollback()
-		utils.Error(c, "记录操作历史失败")
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		_, err := transitionOrder(tx, orderTransitionInput{
+			OrderID:  uint(id),
+			ToStatus: models.OrderStatusRejected,
+			Operator: operator,
+			Reason:   req.Reason,
+			Notes:    req.Notes,
+		})
+		return err
+	})
+	if err != nil {
+		respondOrderStateError(c, err, "订单驳回失败")
 		return
 	}
 
-	tx.Commit()
-
 	response := models.StandardResponse{
 		Success: true,
 		Message: "订单驳回成功",
@@ -1124,10 +933,11 @@ func RejectOrder(c *gin.Context) {
 
 // BatchApproval 批量审批
 // @Summary 批量审批订单
-// @Description 批量审批或驳回订单
+// @Description 批量审批或驳回订单，每个订单按单独审批的规则扣款；审批前按客户汇总检查余额；all_or_nothing 为 true 时任一失败整批回滚
 // @Tags 订单审批
 // @Accept json
 // @Produce json
+// @Param Idempotency-Key header string false "幂等键，重试时携带相同的值"
 // @Param data body models.BatchApprovalRequest true "批量审批信息"
 // @Success 200 {object} models.Response{data=models.BatchApprovalResponse}
 // @Router /api/v1/order-approval/batch [post]
@@ -1138,24 +948,29 @@ func BatchApproval(c *gin.Context) {
 		return
 	}
 
-	// 获取操作人ID
-	operatorID, exists := c.Get("member_id")
-	if !exists {
-		utils.Error(c, "未找到操作人信息")
+	var toStatus string
+	switch req.Action {
+	case "approve":
+		toStatus = models.OrderStatusConfirmed
+	case "reject":
+		toStatus = models.OrderStatusRejected
+	default:
+		utils.Error(c, "无效的操作类型")
 		return
 	}
 
 	// 获取操作人信息
-	var operator models.InternalMember
-	if err := database.DB.First(&operator, operatorID).Error; err != nil {
-		utils.Error(c, "获取操作人信息失败")
+	operator, ok := currentMember(c)
+	if !ok {
 		return
 	}
 
 	var failures []models.BatchApprovalFailure
 	successCount := 0
 
-	// 逐个处理订单
+	// 解析订单ID，重复的只处理一次
+	var orderIDs []uint
+	seen := make(map[uint]bool)
 	for _, orderIDStr := range req.OrderIDs {
 		orderID, err := strconv.ParseUint(orderIDStr, 10, 32)
 		if err != nil {
@@ -1165,88 +980,90 @@ func BatchApproval(c *gin.Context) {
 			})
 			continue
 		}
-
-		// 查找订单工作流
-		var workflow models.OrderWorkflow
-		if err := database.DB.Where("order_id = ?", uint(orderID)).First(&workflow).Error; err != nil {
-			failures = append(failures, models.BatchApprovalFailure{
-				OrderID: orderIDStr,
-				Error:   "订单不存在",
-			})
-			continue
+		if !seen[uint(orderID)] {
+			seen[uint(orderID)] = true
+			orderIDs = append(orderIDs, uint(orderID))
 		}
+	}
+	// 按订单ID顺序加锁，避免两个批量审批以相反顺序锁定订单而死锁
+	sort.Slice(orderIDs, func(i, j int) bool { return orderIDs[i] < orderIDs[j] })
 
-		// 检查当前状态
-		if workflow.OrderStatus != "待处理" {
-			failures = append(failures, models.BatchApprovalFailure{
-				OrderID: orderIDStr,
-				Error:   "只有待处理状态的订单才能审批",
-			})
-			continue
+	// 审批通过前按客户汇总检查余额，避免扣了一部分才发现余额不足
+	precheckFailures := map[uint]string{}
+	if toStatus == models.OrderStatusConfirmed {
+		var err error
+		precheckFailures, err = precheckBatchBalance(orderIDs)
+		if err != nil {
+			utils.Error(c, "检查客户余额失败")
+			return
 		}
-
-		// 开启事务
-		tx := database.DB.Begin()
-
-		// 记录旧状态
-		oldStatus := workflow.OrderStatus
-		var newStatus string
-		var action string
-
-		switch req.Action {
-		case "approve":
-			newStatus = "已确认"
-			action = "approve"
-		case "reject":
-			newStatus = "驳回"
-			action = "reject"
-			workflow.RejectionReason = req.Reason
-		default:
+	}
+	for _, orderID := range orderIDs {
+		if message, exists := precheckFailures[orderID]; exists {
 			failures = append(failures, models.BatchApprovalFailure{
-				OrderID: orderIDStr,
-				Error:   "无效的操作类型",
+				OrderID: strconv.FormatUint(uint64(orderID), 10),
+				Error:   message,
 			})
-			continue
 		}
+	}
 
-		// 更新订单状态
-		workflow.OrderStatus = newStatus
-		workflow.ApproverID = &[]uint{operatorID.(uint)}[0]
-		now := time.Now()
-		workflow.ApprovalTime = &now
-
-		if err := tx.Save(&workflow).Error; err != nil {
-			tx.Rollback()
-			failures = append(failures, models.BatchApprovalFailure{
-				OrderID: orderIDStr,
-				Error:   "更新订单状态失败",
-			})
-			continue
+	newInput := func(orderID uint) orderTransitionInput {
+		return orderTransitionInput{
+			OrderID:  orderID,
+			ToStatus: toStatus,
+			Operator: operator,
+			Reason:   req.Reason,
+			Notes:    req.Notes,
 		}
+	}
 
-		// 记录操作历史
-		history := models.OrderApprovalHistory{
-			OrderID:      uint(orderID),
-			OperatorID:   operatorID.(uint),
-			OperatorName: operator.Name,
-			Action:       action,
-			FromStatus:   oldStatus,
-			ToStatus:     newStatus,
-			Reason:       req.Reason,
-			Notes:        req.Notes,
+	rolledBack := false
+	if req.AllOrNothing {
+		// 整批模式：全部订单在同一事务中处理，任一失败则整批回滚
+		if len(failures) > 0 {
+			rolledBack = true
+		} else {
+			var failedID uint
+			err := database.DB.Transaction(func(tx *gorm.DB) error {
+				for _, orderID := range orderIDs {
+					if _, err := transitionOrder(tx, newInput(orderID)); err != nil {
+						failedID = orderID
+						return err
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				rolledBack = true
+				failures = append(failures, models.BatchApprovalFailure{
+					OrderID: strconv.FormatUint(uint64(failedID), 10),
+					Error:   orderStateErrorMessage(err, "更新订单状态失败"),
+				})
+			} else {
+				successCount = len(orderIDs)
+			}
 		}
+	} else {
+		// 逐个处理订单，每个订单单独事务
+		for _, orderID := range orderIDs {
+			if _, exists := precheckFailures[orderID]; exists {
+				continue
+			}
 
-		if err := tx.Create(&history).Error; err != nil {
-			tx.Rollback()
-			failures = append(failures, models.BatchApprovalFailure{
-				OrderID: orderIDStr,
-				Error:   "记录操作历史失败",
+			err := database.DB.Transaction(func(tx *gorm.DB) error {
+				_, err := transitionOrder(tx, newInput(orderID))
+				return err
 			})
-			continue
-		}
+			if err != nil {
+				failures = append(failures, models.BatchApprovalFailure{
+					OrderID: strconv.FormatUint(uint64(orderID), 10),
+					Error:   orderStateErrorMessage(err, "更新订单状态失败"),
+				})
+				continue
+			}
 
-		tx.Commit()
-		successCount++
+			successCount++
+		}
 	}
 
 	response := models.BatchApprovalResponse{
@@ -1254,6 +1071,7 @@ func BatchApproval(c *gin.Context) {
 		SuccessCount: successCount,
 		FailureCount: len(failures),
 		Failures:     failures,
+		RolledBack:   rolledBack,
 	}
 
 	utils.Success(c, response)
@@ -1261,7 +1079,7 @@ func BatchApproval(c *gin.Context) {
 
 // UpdateOrderStatusV2 更新订单状态（审批模块使用）
 // @Summary 更新订单状态
-// @Description 更新订单状态
+// @Description 按订单状态流转规则更新订单状态并记录操作历史，不允许的流转返回409
 // @Tags 订单审批
 // @Accept json
 // @Produce json
@@ -1283,79 +1101,137 @@ func UpdateOrderStatusV2(c *gin.Context) {
 		return
 	}
 
-	// 获取操作人ID
-	operatorID, exists := c.Get("member_id")
-	if !exists {
-		utils.Error(c, "未找到操作人信息")
+	// 获取操作人信息
+	operator, ok := currentMember(c)
+	if !ok {
+		return
+	}
+
+	var result *orderTransitionResult
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		result, err = transitionOrder(tx, orderTransitionInput{
+			OrderID:         uint(id),
+			ToStatus:        req.Status,
+			Operator:        operator,
+			Reason:          req.Reason,
+			Notes:           req.Notes,
+			RefundAmount:    req.RefundAmount,
+			RefundReference: req.RefundReference,
+		})
+		return err
+	})
+	if err != nil {
+		respondOrderStateError(c, err, "更新订单状态失败")
 		return
 	}
 
-	// 查找订单工作流
-	var workflow models.OrderWorkflow
-	if err := database.DB.Where("order_id = ?", uint(id)).First(&workflow).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			utils.NotFound(c, "订单不存在")
-		} else {
-			utils.Error(c, "查询失败")
-		}
-		return
+	message := "状态更新成功"
+	if result.Message != "" {
+		message = result.Message
 	}
-
-	// 获取操作人信息
-	var operator models.InternalMember
-	if err := database.DB.First(&operator, operatorID).Error; err != nil {
-		utils.Error(c, "获取操作人信息失败")
-		return
+	if result.Refund != nil {
+		logRefund(c, operator.MemberID, result.Refund)
+	}
+	response := models.StandardResponse{
+		Success: true,
+		Message: message,
 	}
 
-	// 开启事务
-	tx := database.DB.Begin()
+	utils.SuccessWithMessage(c, "状态更新成功", response)
+}
 
-	// 记录旧状态
-	oldStatus := workflow.OrderStatus
+// ReturnOrder 退回订单
+// @Summary 退回订单
+// @Description 将已确认的订单退回并退款：余额支付的退回客户余额，直接支付的需填写外部退款流水号；可部分退款
+// @Tags 订单审批
+// @Accept json
+// @Produce json
+// @Param id path string true "订单ID"
+// @Param Idempotency-Key header string false "幂等键，重试时携带相同的值"
+// @Param data body models.ReturnOrderRequest true "退回信息"
+// @Success 200 {object} models.Response{data=models.OrderRefund}
+// @Router /api/v1/order-approval/{id}/return [post]
+func ReturnOrder(c *gin.Context) {
+	orderID := c.Param("id")
+	id, err := strconv.ParseUint(orderID, 10, 32)
+	if err != nil {
+		utils.Error(c, "无效的订单ID")
+		return
+	}
 
-	// 更新订单状态
-	workflow.OrderStatus = req.Status
-	workflow.ApproverID = &[]uint{operatorID.(uint)}[0]
-	now := time.Now()
-	workflow.ApprovalTime = &now
+	var req models.ReturnOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.Error(c, "请求参数错误")
+		return
+	}
 
-	if req.Status == "驳回" && req.Reason != "" {
-		workflow.RejectionReason = req.Reason
+	// 获取操作人信息
+	operator, ok := currentMember(c)
+	if !ok {
+		return
+	}
+
+	var result *orderTransitionResult
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		result, err = transitionOrder(tx, orderTransitionInput{
+			OrderID:         uint(id),
+			ToStatus:        models.OrderStatusReturned,
+			Operator:        operator,
+			Reason:          req.Reason,
+			Notes:           req.Notes,
+			RefundAmount:    req.RefundAmount,
+			RefundReference: req.RefundReference,
+		})
+		return err
+	})
+	if err != nil {
+		respondOrderStateError(c, err, "订单退回失败")
+		return
 	}
 
-	if err := tx.Save(&workflow).Error; err != nil {
-		tx.Rollback()
-		utils.Error(c, "更新订单状态失败")
+	if result.Refund == nil {
+		utils.SuccessWithMessage(c, "订单已退回，未退款", nil)
 		return
 	}
+	logRefund(c, operator.MemberID, result.Refund)
+	utils.SuccessWithMessage(c, result.Message, result.Refund)
+}
 
-	// 记录操作历史
-	history := models.OrderApprovalHistory{
-		OrderID:      uint(id),
-		OperatorID:   operatorID.(uint),
-		OperatorName: operator.Name,
-		Action:       "status_change",
-		FromStatus:   oldStatus,
-		ToStatus:     req.Status,
-		Reason:       req.Reason,
-		Notes:        req.Notes,
+// GetOrderRefunds 获取订单退款记录
+// @Summary 获取订单退款记录
+// @Description 获取订单的全部退款记录
+// @Tags 订单审批
+// @Accept json
+// @Produce json
+// @Param id path string true "订单ID"
+// @Success 200 {object} models.Response{data=[]models.OrderRefund}
+// @Router /api/v1/order-approval/{id}/refunds [get]
+func GetOrderRefunds(c *gin.Context) {
+	orderID := c.Param("id")
+	id, err := strconv.ParseUint(orderID, 10, 32)
+	if err != nil {
+		utils.Error(c, "无效的订单ID")
+		return
 	}
 
-	if err := tx.Create(&history).Error; err != nil {
-		tx.Rollback()
-		utils.Error(c, "记录操作历史失败")
+	var refunds []models.OrderRefund
+	if err := database.DB.Preload("Operator").Where("order_id = ?", uint(id)).
+		Order("refunded_at DESC").Find(&refunds).Error; err != nil {
+		utils.Error(c, "查询退款记录失败")
 		return
 	}
 
-	tx.Commit()
+	utils.Success(c, refunds)
+}
 
-	response := models.StandardResponse{
-		Success: true,
-		Message: "状态更新成功",
+// logRefund 记录退款操作日志
+func logRefund(c *gin.Context, operatorID uint, refund *models.OrderRefund) {
+	description := fmt.Sprintf("订单退回退款：订单%d，%s %s元", refund.OrderID, refund.RefundMethod, refund.Amount)
+	if refund.ExternalReference != "" {
+		description += "，流水号：" + refund.ExternalReference
 	}
-
-	utils.SuccessWithMessage(c, "状态更新成功", response)
+	logOperation(operatorID, "退款", "订单管理", description,
+		strconv.FormatUint(uint64(refund.OrderID), 10), "订单", c.ClientIP(), c.GetHeader("User-Agent"))
 }
 
 // GetStatistics 获取统计数据
@@ -1395,24 +1271,37 @@ func GetStatistics(c *gin.Context) {
 
 	// 计算基础统计
 	var stats struct {
-		TotalCount  int64   `json:"total_count"`
-		TotalHours  float64 `json:"total_hours"`
-		TotalAmount float64 `json:"total_amount"`
+		TotalCount  int64          `json:"total_count"`
+		TotalHours  models.Decimal `json:"total_hours"`
+		TotalAmount models.Money   `json:"total_amount"`
 	}
 
-	err := query.Select("COUNT(*) as total_count, SUM(duration_hours) as total_hours, SUM(order_pricing.final_price) as total_amount").
+	err := query.Select("COUNT(*) as total_count, COALESCE(SUM(duration_hours), 0) as total_hours, COALESCE(SUM(order_pricing.final_price), 0) as total_amount").
 		Scan(&stats).Error
 	if err != nil {
 		utils.Error(c, "查询统计数据失败")
 		return
 	}
 
-	// 计算平均价格和佣金
-	averagePrice := float64(0)
-	if stats.TotalCount > 0 {
-		averagePrice = stats.TotalAmount / float64(stats.TotalCount)
+	// 计算平均价格和佣金，佣金按每个订单的提成比例逐单计算
+	rounding := moneyRounding()
+	averagePrice := stats.TotalAmount.Div(stats.TotalCount, rounding)
+
+	var commissionLines []commissionLine
+	commissionQuery := database.DB.Model(&models.PlaymateOrder{}).
+		Joins("JOIN order_workflow ON playmate_orders.order_id = order_workflow.order_id").
+		Joins("JOIN order_pricing ON playmate_orders.order_id = order_pricing.order_id").
+		Select("playmate_orders.order_id, playmate_orders.reporter_id, playmate_orders.order_category_id, order_pricing.final_price")
+	commissionQuery = applyOrderFilters(commissionQuery, filterReq)
+	if err := commissionQuery.Scan(&commissionLines).Error; err != nil {
+		utils.Error(c, "查询统计数据失败")
+		return
+	}
+	totalCommission, err := sumOrderCommission(database.DB, commissionLines)
+	if err != nil {
+		utils.Error(c, "计算佣金失败")
+		return
 	}
-	totalCommission := stats.TotalAmount * 0.1 // 假设10%的佣金率
 
 	// 获取状态分布
 	var statusDistribution []struct {
@@ -1625,6 +1514,8 @@ func applyOrderFilters(query *gorm.DB, req models.OrderApprovalFilterRequest) *g
 		switch req.DateType {
 		case "approve":
 			query = query.Where("DATE(order_workflow.approval_time) >= ?", req.StartDate)
+		case "settle":
+			query = query.Where("DATE(order_workflow.settlement_time) >= ?", req.StartDate)
 		default: // submit
 			query = query.Where("DATE(playmate_orders.report_time) >= ?", req.StartDate)
 		}
@@ -1633,6 +1524,8 @@ func applyOrderFilters(query *gorm.DB, req models.OrderApprovalFilterRequest) *g
 		switch req.DateType {
 		case "approve":
 			query = query.Where("DATE(order_workflow.approval_time) <= ?", req.EndDate)
+		case "settle":
+			query = query.Where("DATE(order_workflow.settlement_time) <= ?", req.EndDate)
 		default: // submit
 			query = query.Where("DATE(playmate_orders.report_time) <= ?", req.EndDate)
 		}
@@ -1641,11 +1534,11 @@ func applyOrderFilters(query *gorm.DB, req models.OrderApprovalFilterRequest) *g
 	// 金额筛选
 	if req.MinAmount > 0 {
 		query = query.Joins("JOIN order_pricing ON playmate_orders.order_id = order_pricing.order_id").
-			Where("order_pricing.final_price >= ?", req.MinAmount)
+			Where("order_pricing.final_price >= ?", models.MoneyFromFloat(req.MinAmount))
 	}
 	if req.MaxAmount > 0 {
 		query = query.Joins("JOIN order_pricing ON playmate_orders.order_id = order_pricing.order_id").
-			Where("order_pricing.final_price <= ?", req.MaxAmount)
+			Where("order_pricing.final_price <= ?", models.MoneyFromFloat(req.MaxAmount))
 	}
 
 	// 排序
@@ -1681,26 +1574,19 @@ func applyOrderFilters(query *gorm.DB, req models.OrderApprovalFilterRequest) *g
 // @Produce json
 // @Param page query int false "页码" default(1)
 // @Param page_size query int false "每页数量" default(10)
-// @Param order_status query string false "订单状态筛选" Enums(待处理,已确认,驳回,已退回)
+// @Param order_status query string false "订单状态筛选" Enums(待处理,驳回,已确认,已结算,已完成,已退回)
 // @Param start_date query string false "开始日期(YYYY-MM-DD)"
 // @Param end_date query string false "结束日期(YYYY-MM-DD)"
 // @Success 200 {object} models.Response{data=models.PageResponse}
 // @Router /api/v1/customer/orders [get]
 func GetCustomerOrders(c *gin.Context) {
 	// 获取当前客户ID
-	customerID, exists := c.Get("member_id")
+	customerID, exists := middleware.CurrentCustomerID(c)
 	if !exists {
 		utils.Error(c, "未找到客户信息")
 		return
 	}
 
-	// 检查用户角色是否为客户
-	userRole, roleExists := c.Get("user_role")
-	if !roleExists || userRole != "customer" {
-		utils.ErrorWithCode(c, 403, "无权限访问")
-		return
-	}
-
 	var req models.PageRequest
 	if err := c.ShouldBindQuery(&req); err != nil {
 		utils.Error(c, "请求参数错误")
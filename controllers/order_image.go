@@ -0,0 +1,465 @@
+package controllers
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"tangsong-esports/config"
+	"tangsong-esports/database"
+	"tangsong-esports/middleware"
+	"tangsong-esports/models"
+	"tangsong-esports/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// allowedImageTypes 允许上传的图片类型（按文件内容识别）及对应扩展名
+var allowedImageTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// orderImageLimits 从系统配置读取单张图片大小上限和单次上传数量上限
+func orderImageLimits() (maxSize int64, maxFiles int) {
+	maxSize, maxFiles = 5*1024*1024, 9
+
+	var configs []models.SystemConfig
+	database.DB.Where("config_key IN ? AND is_active = ?", []string{"order_image_max_size", "order_image_max_files"}, true).Find(&configs)
+	for _, cfg := range configs {
+		value, err := strconv.ParseInt(cfg.ConfigValue, 10, 64)
+		if err != nil || value <= 0 {
+			continue
+		}
+		switch cfg.ConfigKey {
+		case "order_image_max_size":
+			maxSize = value
+		case "order_image_max_files":
+			maxFiles = int(value)
+		}
+	}
+	return maxSize, maxFiles
+}
+
+// findAccessibleOrder 查询订单，没有查看全部订单权限的成员只能操作自己报的单；失败时已写入响应
+func findAccessibleOrder(c *gin.Context) (*models.PlaymateOrder, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.Error(c, "无效的订单ID")
+		return nil, false
+	}
+
+	var order models.PlaymateOrder
+	if err := database.DB.First(&order, uint(id)).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.NotFound(c, "订单不存在")
+		} else {
+			utils.Error(c, "查询订单失败")
+		}
+		return nil, false
+	}
+
+	if !middleware.HasPermission(c, models.PermOrderViewAll) {
+		memberID, _ := middleware.CurrentMemberID(c)
+		if order.ReporterID != memberID {
+			utils.Forbidden(c, "无权限操作该订单")
+			return nil, false
+		}
+	}
+	return &order, true
+}
+
+// signOrderImages 为图片生成带签名的访问链接
+func signOrderImages(images []models.OrderImages) {
+	for i := range images {
+		images[i].URL = utils.SignFileURL(images[i].ImageURL)
+		if images[i].ThumbnailKey != "" {
+			images[i].ThumbnailURL = utils.SignFileURL(images[i].ThumbnailKey)
+		}
+	}
+}
+
+// storeOrderImage 校验并保存一个上传文件，生成缩略图，返回未入库的图片记录
+func storeOrderImage(storage utils.Storage, orderID uint, file *multipart.FileHeader, maxSize int64) (*models.OrderImages, error) {
+	if file.Size > maxSize {
+		return nil, fmt.Errorf("文件 %s 超过大小限制 %d 字节", file.Filename, maxSize)
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("读取文件 %s 失败", file.Filename)
+	}
+	defer src.Close()
+
+	// 多读一个字节，用于发现声明大小与实际内容不符的文件
+	data, err := io.ReadAll(io.LimitReader(src, maxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("读取文件 %s 失败", file.Filename)
+	}
+	if int64(len(data)) > maxSize {
+		return nil, fmt.Errorf("文件 %s 超过大小限制 %d 字节", file.Filename, maxSize)
+	}
+
+	// 按文件内容识别类型，不信任扩展名和客户端声明的 Content-Type
+	contentType := http.DetectContentType(data)
+	ext, ok := allowedImageTypes[contentType]
+	if !ok {
+		return nil, fmt.Errorf("文件 %s 不是支持的图片格式（%s）", file.Filename, contentType)
+	}
+
+	// 解码前按图片头部声明的尺寸检查像素数，避免体积很小但尺寸巨大的图片解码时占满内存
+	width, height, sizeErr := utils.ImageSize(bytes.NewReader(data))
+	maxPixels := int64(config.AppConfig.Storage.MaxImagePixels)
+	if sizeErr == nil && maxPixels > 0 && int64(width)*int64(height) > maxPixels {
+		return nil, fmt.Errorf("文件 %s 尺寸过大（%d×%d），最多 %d 像素", file.Filename, width, height, maxPixels)
+	}
+
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+	name := hex.EncodeToString(random)
+	key := fmt.Sprintf("orders/%d/%s%s", orderID, name, ext)
+	if err := storage.Put(key, bytes.NewReader(data), contentType); err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(data)
+	image := &models.OrderImages{
+		OrderID:      orderID,
+		ImageURL:     key,
+		ContentType:  contentType,
+		FileSize:     int64(len(data)),
+		OriginalName: path.Base(file.Filename),
+		ContentHash:  hex.EncodeToString(sum[:]),
+		UploadAt:     time.Now(),
+	}
+
+	// 标准库无法解码的格式（如 WebP）不生成缩略图和感知哈希
+	if sizeErr != nil {
+		return image, nil
+	}
+	decoded, err := utils.DecodeImage(bytes.NewReader(data))
+	if err != nil {
+		return image, nil
+	}
+	phash := utils.DifferenceHash(decoded)
+	image.PHash = &phash
+	if thumbnail, err := utils.MakeThumbnail(decoded, config.AppConfig.Storage.ThumbnailMaxPixel); err == nil {
+		thumbnailKey := fmt.Sprintf("orders/%d/%s_thumb.jpg", orderID, name)
+		if err := storage.Put(thumbnailKey, bytes.NewReader(thumbnail), "image/jpeg"); err != nil {
+			log.Printf("[Storage] 保存缩略图失败: %v", err)
+		} else {
+			image.ThumbnailKey = thumbnailKey
+		}
+	}
+	return image, nil
+}
+
+// imageSimilarityThreshold 从系统配置读取判定为相似图片的感知哈希最大汉明距离，缺省 6，0 表示只检测完全相同的图片
+func imageSimilarityThreshold() int {
+	var cfg models.SystemConfig
+	database.DB.Where("config_key = ? AND is_active = ?", "image_similarity_threshold", true).First(&cfg)
+	if threshold, err := strconv.Atoi(cfg.ConfigValue); err == nil && threshold >= 0 {
+		return threshold
+	}
+	return 6
+}
+
+// flagDuplicateImages 查找与其他订单已有图片相同或相似的图片并记录，返回标记数
+func flagDuplicateImages(tx *gorm.DB, images []models.OrderImages) (int, error) {
+	threshold := imageSimilarityThreshold()
+	flagged := 0
+	for _, image := range images {
+		var matches []struct {
+			ImageID  uint
+			OrderID  uint
+			Distance int
+		}
+		query := tx.Table("order_images").
+			Joins("JOIN playmate_orders ON playmate_orders.order_id = order_images.order_id AND playmate_orders.deleted_at IS NULL").
+			Where("order_images.order_id <> ?", image.OrderID)
+		if image.PHash != nil && threshold > 0 {
+			query = query.Select("order_images.image_id, order_images.order_id, "+
+				"CASE WHEN order_images.content_hash = ? THEN 0 ELSE BIT_COUNT(order_images.perceptual_hash ^ ?) END AS distance",
+				image.ContentHash, *image.PHash).
+				Where("order_images.content_hash = ? OR BIT_COUNT(order_images.perceptual_hash ^ ?) <= ?",
+					image.ContentHash, *image.PHash, threshold)
+		} else {
+			query = query.Select("order_images.image_id, order_images.order_id, 0 AS distance").
+				Where("order_images.content_hash = ?", image.ContentHash)
+		}
+		if err := query.Order("order_images.image_id").Scan(&matches).Error; err != nil {
+			return flagged, err
+		}
+
+		for _, match := range matches {
+			duplicate := models.OrderImageDuplicate{
+				ImageID:        image.ImageID,
+				OrderID:        image.OrderID,
+				MatchedImageID: match.ImageID,
+				MatchedOrderID: match.OrderID,
+				MatchType:      models.ImageMatchSimilar,
+				Distance:       match.Distance,
+			}
+			if match.Distance == 0 {
+				duplicate.MatchType = models.ImageMatchExact
+			}
+			if err := tx.Create(&duplicate).Error; err != nil {
+				return flagged, err
+			}
+			flagged++
+		}
+	}
+	return flagged, nil
+}
+
+// deleteStoredImage 删除图片及缩略图文件
+func deleteStoredImage(storage utils.Storage, image *models.OrderImages) {
+	for _, key := range []string{image.ImageURL, image.ThumbnailKey} {
+		if key == "" {
+			continue
+		}
+		if err := storage.Delete(key); err != nil {
+			log.Printf("[Storage] 删除文件 %s 失败: %v", key, err)
+		}
+	}
+}
+
+// UploadOrderImages 上传订单图片
+// @Summary 上传订单图片
+// @Description 为订单上传一张或多张图片（表单字段 files，可重复），按文件内容校验格式，大小受 order_image_max_size 配置限制；
+// @Description 与其他订单已有图片相同或相似的图片会被标记，审核时可见
+// @Tags 订单管理
+// @Accept multipart/form-data
+// @Produce json
+// @Param id path int true "订单ID"
+// @Param files formData file true "图片文件，可多个"
+// @Param image_type formData string false "图片类型" Enums(结算截图,聊天记录,游戏截图,其他)
+// @Param notes formData string false "图片备注"
+// @Success 200 {object} models.Response{data=[]models.OrderImages}
+// @Router /api/v1/orders/{id}/images [post]
+func UploadOrderImages(c *gin.Context) {
+	order, ok := findAccessibleOrder(c)
+	if !ok {
+		return
+	}
+
+	// 获取表单数据
+	imageType := c.PostForm("image_type")
+	if imageType == "" {
+		imageType = models.ImageTypeOther
+	}
+	if !models.IsValidImageType(imageType) {
+		utils.Error(c, "无效的图片类型")
+		return
+	}
+	notes := c.PostForm("notes")
+
+	form, err := c.MultipartForm()
+	if err != nil {
+		utils.Error(c, "请使用 multipart/form-data 上传图片")
+		return
+	}
+	files := append(form.File["files"], form.File["file"]...)
+	if len(files) == 0 {
+		utils.Error(c, "请选择要上传的图片")
+		return
+	}
+	maxSize, maxFiles := orderImageLimits()
+	if len(files) > maxFiles {
+		utils.Error(c, fmt.Sprintf("单次最多上传%d张图片", maxFiles))
+		return
+	}
+
+	operatorID, _ := middleware.CurrentMemberID(c)
+	storage := utils.DefaultStorage()
+	images := make([]models.OrderImages, 0, len(files))
+	for _, file := range files {
+		image, err := storeOrderImage(storage, order.OrderID, file, maxSize)
+		if err != nil {
+			for i := range images {
+				deleteStoredImage(storage, &images[i])
+			}
+			utils.Error(c, err.Error())
+			return
+		}
+		image.ImageType = imageType
+		image.Notes = notes
+		image.UploaderID = &operatorID
+		images = append(images, *image)
+	}
+
+	var flagged int
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&images).Error; err != nil {
+			return err
+		}
+		flagged, err = flagDuplicateImages(tx, images)
+		return err
+	})
+	if err != nil {
+		for i := range images {
+			deleteStoredImage(storage, &images[i])
+		}
+		utils.Error(c, "保存图片记录失败")
+		return
+	}
+
+	description := fmt.Sprintf("订单%d上传%d张%s", order.OrderID, len(images), imageType)
+	if flagged > 0 {
+		description += fmt.Sprintf("，发现%d处与其他订单重复的图片", flagged)
+	}
+	logOperation(operatorID, "上传", "订单管理", description,
+		strconv.FormatUint(uint64(order.OrderID), 10), "订单", c.ClientIP(), c.GetHeader("User-Agent"))
+
+	signOrderImages(images)
+	utils.SuccessWithMessage(c, "上传图片成功", images)
+}
+
+// GetOrderImages 获取订单图片列表
+// @Summary 获取订单图片列表
+// @Description 获取订单的全部图片，返回带签名的访问链接
+// @Tags 订单管理
+// @Accept json
+// @Produce json
+// @Param id path int true "订单ID"
+// @Param image_type query string false "图片类型"
+// @Success 200 {object} models.Response{data=[]models.OrderImages}
+// @Router /api/v1/orders/{id}/images [get]
+func GetOrderImages(c *gin.Context) {
+	order, ok := findAccessibleOrder(c)
+	if !ok {
+		return
+	}
+
+	query := database.DB.Where("order_id = ?", order.OrderID)
+	if imageType := c.Query("image_type"); imageType != "" {
+		query = query.Where("image_type = ?", imageType)
+	}
+
+	var images []models.OrderImages
+	if err := query.Order("image_id").Find(&images).Error; err != nil {
+		utils.Error(c, "查询失败")
+		return
+	}
+
+	signOrderImages(images)
+	utils.Success(c, images)
+}
+
+// DeleteOrderImage 删除订单图片
+// @Summary 删除订单图片
+// @Description 删除订单图片记录及存储的文件和缩略图；图片是服务凭证，订单审批通过后只有订单审核人员可以删除
+// @Tags 订单管理
+// @Accept json
+// @Produce json
+// @Param id path int true "订单ID"
+// @Param image_id path int true "图片ID"
+// @Success 200 {object} models.Response
+// @Failure 403 {object} models.Response "订单已审批通过，没有订单审核权限"
+// @Router /api/v1/orders/{id}/images/{image_id} [delete]
+func DeleteOrderImage(c *gin.Context) {
+	order, ok := findAccessibleOrder(c)
+	if !ok {
+		return
+	}
+
+	imageID, err := strconv.ParseUint(c.Param("image_id"), 10, 32)
+	if err != nil {
+		utils.Error(c, "无效的图片ID")
+		return
+	}
+
+	var image models.OrderImages
+	if err := database.DB.Where("order_id = ?", order.OrderID).First(&image, uint(imageID)).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.NotFound(c, "图片不存在")
+		} else {
+			utils.Error(c, "查询失败")
+		}
+		return
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		// 锁定工作流，避免与审批并发时删除已审批订单的图片
+		var workflow models.OrderWorkflow
+		if err := forUpdate(tx).Where("order_id = ?", order.OrderID).First(&workflow).Error; err != nil {
+			return err
+		}
+		if workflow.OrderStatus != models.OrderStatusPending && workflow.OrderStatus != models.OrderStatusRejected &&
+			!middleware.HasPermission(c, models.PermOrderAudit) {
+			return newOrderStateError(models.StatusForbidden, "订单%s，只有订单审核人员可以删除图片", workflow.OrderStatus)
+		}
+
+		if err := tx.Where("image_id = ? OR matched_image_id = ?", image.ImageID, image.ImageID).
+			Delete(&models.OrderImageDuplicate{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&image).Error
+	})
+	if err != nil {
+		respondOrderStateError(c, err, "删除失败")
+		return
+	}
+	deleteStoredImage(utils.DefaultStorage(), &image)
+
+	operatorID, _ := middleware.CurrentMemberID(c)
+	logOperation(operatorID, "删除", "订单管理", fmt.Sprintf("删除订单%d的图片%d", order.OrderID, image.ImageID),
+		strconv.FormatUint(uint64(order.OrderID), 10), "订单", c.ClientIP(), c.GetHeader("User-Agent"))
+
+	utils.SuccessWithMessage(c, "删除成功", nil)
+}
+
+// ServeFile 通过签名链接访问上传的文件
+// @Summary 访问上传的文件
+// @Description 校验链接签名和有效期后返回文件内容，签名链接由图片列表等接口生成
+// @Tags 文件
+// @Produce octet-stream
+// @Param key path string true "文件路径"
+// @Param expires query int true "过期时间戳"
+// @Param signature query string true "签名"
+// @Success 200 {file} file
+// @Router /api/v1/files/{key} [get]
+func ServeFile(c *gin.Context) {
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	if !utils.VerifyFileSignature(key, c.Query("expires"), c.Query("signature")) {
+		utils.Forbidden(c, "链接无效或已过期")
+		return
+	}
+
+	file, err := utils.DefaultStorage().Get(key)
+	if err != nil {
+		if errors.Is(err, utils.ErrFileNotFound) {
+			utils.NotFound(c, "文件不存在")
+		} else {
+			utils.Error(c, "读取文件失败")
+		}
+		return
+	}
+	defer file.Close()
+
+	contentType := "application/octet-stream"
+	for mime, ext := range allowedImageTypes {
+		if strings.HasSuffix(key, ext) {
+			contentType = mime
+			break
+		}
+	}
+	c.Header("Cache-Control", "private, max-age=300")
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.DataFromReader(http.StatusOK, -1, contentType, file, nil)
+}
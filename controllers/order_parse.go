@@ -0,0 +1,510 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"tangsong-esports/database"
+	"tangsong-esports/middleware"
+	"tangsong-esports/models"
+	"tangsong-esports/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 候选项最多返回的数量
+const parseCandidateLimit = 5
+
+// orderParser 一次报单识别的上下文
+type orderParser struct {
+	reporterID uint
+	now        time.Time
+	raw        map[string]models.ParsedText
+	result     models.OrderParseResult
+}
+
+// field 记录字段识别情况
+func (p *orderParser) field(field string, resolved bool, confidence float64, source, message string) *models.OrderParseField {
+	raw := p.raw[field]
+	p.result.Fields = append(p.result.Fields, models.OrderParseField{
+		Field:      field,
+		Raw:        raw.Value,
+		Resolved:   resolved,
+		Confidence: confidence,
+		Source:     source,
+		RuleID:     raw.RuleID,
+		Message:    message,
+	})
+	return &p.result.Fields[len(p.result.Fields)-1]
+}
+
+// ruleSource 规则提取的字段的来源说明
+func ruleSource(raw models.ParsedText) string {
+	return fmt.Sprintf("rule:%d", raw.RuleID)
+}
+
+// resolveCustomer 按账号、手机号、名称依次匹配客户
+func (p *orderParser) resolveCustomer() {
+	raw, ok := p.raw[models.ParseFieldCustomer]
+	if !ok {
+		p.field(models.ParseFieldCustomer, false, 0, "", "未找到老板信息")
+		return
+	}
+	value := strings.TrimPrefix(raw.Value, "@")
+
+	var customers []models.Customer
+	database.DB.Where("account = ? OR phone_number = ?", value, value).Limit(parseCandidateLimit).Find(&customers)
+	confidence := 1.0
+	if len(customers) == 0 {
+		database.DB.Where("customer_name = ?", value).Limit(parseCandidateLimit).Find(&customers)
+		confidence = 0.9
+	}
+	if len(customers) == 0 {
+		database.DB.Where("customer_name LIKE ? OR account LIKE ?", "%"+value+"%", "%"+value+"%").
+			Limit(parseCandidateLimit).Find(&customers)
+		confidence = 0.6
+	}
+
+	switch len(customers) {
+	case 0:
+		p.field(models.ParseFieldCustomer, false, 0, ruleSource(raw), "未找到匹配的客户")
+	case 1:
+		p.result.Order.CustomerID = &customers[0].CustomerID
+		p.field(models.ParseFieldCustomer, true, confidence, ruleSource(raw), customers[0].CustomerName)
+	default:
+		field := p.field(models.ParseFieldCustomer, false, confidence/2, ruleSource(raw), "匹配到多个客户，请手动选择")
+		for _, customer := range customers {
+			field.Candidates = append(field.Candidates, models.OrderParseCandidate{
+				ID:    customer.CustomerID,
+				Label: fmt.Sprintf("%s（%s）", customer.CustomerName, customer.Account),
+			})
+		}
+	}
+}
+
+// resolveCategory 按名称、别名、包含关系依次匹配启用的订单类别
+func (p *orderParser) resolveCategory() {
+	raw, ok := p.raw[models.ParseFieldCategory]
+	if !ok {
+		p.field(models.ParseFieldCategory, false, 0, "", "未找到游戏品类")
+		return
+	}
+	value := strings.ToLower(strings.TrimSpace(raw.Value))
+
+	var categories []models.OrderCategory
+	database.DB.Where("is_active = ?", true).Order("sort_order ASC, category_id ASC").Find(&categories)
+
+	var exact, alias, partial []models.OrderCategory
+	for _, category := range categories {
+		name := strings.ToLower(category.CategoryName)
+		switch {
+		case name == value:
+			exact = append(exact, category)
+		case containsFold(category.AliasList(), value):
+			alias = append(alias, category)
+		case strings.Contains(name, value) || strings.Contains(value, name):
+			partial = append(partial, category)
+		}
+	}
+
+	for _, group := range []struct {
+		matches    []models.OrderCategory
+		confidence float64
+	}{{exact, 1.0}, {alias, 0.9}, {partial, 0.6}} {
+		switch len(group.matches) {
+		case 0:
+			continue
+		case 1:
+			p.result.Order.OrderCategoryID = &group.matches[0].CategoryID
+			p.field(models.ParseFieldCategory, true, group.confidence, ruleSource(raw), group.matches[0].CategoryName)
+		default:
+			field := p.field(models.ParseFieldCategory, false, group.confidence/2, ruleSource(raw), "匹配到多个订单类别，请手动选择")
+			for i, category := range group.matches {
+				if i == parseCandidateLimit {
+					break
+				}
+				field.Candidates = append(field.Candidates, models.OrderParseCandidate{ID: category.CategoryID, Label: category.CategoryName})
+			}
+		}
+		return
+	}
+	p.field(models.ParseFieldCategory, false, 0, ruleSource(raw), "未找到匹配的订单类别")
+}
+
+// containsFold 忽略大小写检查列表中是否包含 value
+func containsFold(list []string, value string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveTimes 识别开始时间、结束时间和时长，三者缺一时由另外两个推算
+func (p *orderParser) resolveTimes(text string) {
+	var start, end *time.Time
+	var startConfidence, endConfidence float64
+	var startSource, endSource string
+	confidenceOf := func(exact bool) float64 {
+		if exact {
+			return 1.0
+		}
+		return 0.8 // 日期按当天推断
+	}
+
+	if raw, ok := p.raw[models.ParseFieldTimeRange]; ok {
+		if s, e, exact, ok := models.ParseTimeRangeText(raw.Value, p.now); ok {
+			start, end = &s, &e
+			startConfidence, endConfidence = confidenceOf(exact), confidenceOf(exact)
+			startSource, endSource = ruleSource(raw), ruleSource(raw)
+		} else {
+			p.result.Warnings = append(p.result.Warnings, "无法识别时间段："+raw.Value)
+		}
+	}
+	if raw, ok := p.raw[models.ParseFieldStartTime]; ok {
+		if t, exact, ok := models.ParseTimeText(raw.Value, p.now); ok {
+			start, startConfidence, startSource = &t, confidenceOf(exact), ruleSource(raw)
+		} else {
+			p.result.Warnings = append(p.result.Warnings, "无法识别开始时间："+raw.Value)
+		}
+	}
+	if raw, ok := p.raw[models.ParseFieldEndTime]; ok {
+		ref := p.now
+		if start != nil {
+			ref = *start
+		}
+		if t, exact, ok := models.ParseTimeText(raw.Value, ref); ok {
+			if !exact && start != nil && t.Before(*start) {
+				t = t.AddDate(0, 0, 1)
+			}
+			end, endConfidence, endSource = &t, confidenceOf(exact), ruleSource(raw)
+		} else {
+			p.result.Warnings = append(p.result.Warnings, "无法识别结束时间："+raw.Value)
+		}
+	}
+
+	// 时长：优先取时长规则，其次由起止时间计算，最后在项目分类和全文中查找“X小时”
+	var duration *models.Decimal
+	var durationConfidence float64
+	var durationSource string
+	if raw, ok := p.raw[models.ParseFieldDuration]; ok {
+		if hours, ok := models.ParseDurationText(raw.Value); ok {
+			duration, durationConfidence, durationSource = &hours, 1.0, ruleSource(raw)
+		} else {
+			p.result.Warnings = append(p.result.Warnings, "无法识别时长："+raw.Value)
+		}
+	}
+	if duration == nil && start != nil && end != nil && end.After(*start) {
+		hours := models.Decimal(end.Sub(*start).Minutes() * 100 / 60)
+		duration, durationConfidence, durationSource = &hours, min(startConfidence, endConfidence), "derived"
+	}
+	if duration == nil {
+		for _, candidate := range []string{p.raw[models.ParseFieldProjectCategory].Value, text} {
+			if hours, ok := models.ParseDurationText(candidate); ok && candidate != "" {
+				duration, durationConfidence, durationSource = &hours, 0.6, "fallback"
+				break
+			}
+		}
+	}
+
+	if duration != nil {
+		span := time.Duration(duration.Float64() * float64(time.Hour))
+		switch {
+		case start != nil && end == nil:
+			t := start.Add(span)
+			end, endConfidence, endSource = &t, startConfidence*0.8, "derived"
+		case start == nil && end != nil:
+			t := end.Add(-span)
+			start, startConfidence, startSource = &t, endConfidence*0.8, "derived"
+		case start != nil && end != nil && durationSource != "derived":
+			// 时长精确到0.01小时，与提交订单时的校验一样按允许的误差比较
+			diff := end.Sub(*start) - span
+			if diff < 0 {
+				diff = -diff
+			}
+			if diff > orderTimeRules().DurationTolerance {
+				p.result.Warnings = append(p.result.Warnings,
+					fmt.Sprintf("时长 %s 小时与起止时间不一致", duration.String()))
+				durationConfidence = min(durationConfidence, 0.5)
+			}
+		}
+	}
+
+	for _, item := range []struct {
+		field      string
+		value      *time.Time
+		target     **time.Time
+		confidence float64
+		source     string
+	}{
+		{models.ParseFieldStartTime, start, &p.result.Order.StartTime, startConfidence, startSource},
+		{models.ParseFieldEndTime, end, &p.result.Order.EndTime, endConfidence, endSource},
+	} {
+		if item.value == nil {
+			p.field(item.field, false, 0, item.source, "未找到时间信息")
+			continue
+		}
+		*item.target = item.value
+		p.field(item.field, true, item.confidence, item.source, item.value.Format("2006-01-02 15:04"))
+	}
+
+	if duration == nil {
+		p.field(models.ParseFieldDuration, false, 0, "", "未找到时长")
+		return
+	}
+	p.result.Order.DurationHours = duration
+	p.field(models.ParseFieldDuration, true, durationConfidence, durationSource, duration.String()+"小时")
+}
+
+// resolveUnitPrice 识别单价，文本中没有时取报单人为该客户同类别订单最近一次的单价
+func (p *orderParser) resolveUnitPrice() {
+	if raw, ok := p.raw[models.ParseFieldUnitPrice]; ok {
+		if price, ok := models.ParsePriceText(raw.Value); ok {
+			p.result.Order.UnitPrice = &price
+			p.field(models.ParseFieldUnitPrice, true, 1.0, ruleSource(raw), price.String())
+			return
+		}
+		p.result.Warnings = append(p.result.Warnings, "无法识别单价："+raw.Value)
+	}
+
+	if p.result.Order.CustomerID != nil && p.result.Order.OrderCategoryID != nil {
+		var pricing models.OrderPricing
+		err := database.DB.Joins("JOIN playmate_orders ON playmate_orders.order_id = order_pricing.order_id").
+			Where("playmate_orders.reporter_id = ? AND playmate_orders.customer_id = ? AND playmate_orders.order_category_id = ?",
+				p.reporterID, *p.result.Order.CustomerID, *p.result.Order.OrderCategoryID).
+			Order("playmate_orders.report_time DESC").First(&pricing).Error
+		if err == nil {
+			p.result.Order.UnitPrice = &pricing.UnitPrice
+			p.field(models.ParseFieldUnitPrice, true, 0.5, "history", "沿用最近一次同客户同类别订单的单价")
+			return
+		}
+	}
+	p.field(models.ParseFieldUnitPrice, false, 0, "", "未找到单价")
+}
+
+// resolveTexts 直接填充的文本字段
+func (p *orderParser) resolveTexts() {
+	for _, item := range []struct {
+		field  string
+		target *string
+	}{
+		{models.ParseFieldProjectCategory, &p.result.Order.ProjectCategory},
+		{models.ParseFieldServiceInfo, &p.result.Order.ServiceAdditionalInfo},
+		{models.ParseFieldOrderNotes, &p.result.Order.OrderNotes},
+	} {
+		if raw, ok := p.raw[item.field]; ok {
+			*item.target = raw.Value
+			p.field(item.field, true, 1.0, ruleSource(raw), "")
+		}
+	}
+}
+
+// ParseOrderText 智能识别报单内容
+// @Summary 智能识别报单内容
+// @Description 按报单设置中的识别规则从粘贴的文本中识别客户、订单类别、时长、单价和起止时间，返回可用于创建报单的内容、各字段置信度和未识别的字段
+// @Tags 订单管理
+// @Accept json
+// @Produce json
+// @Param data body models.OrderParseRequest true "报单文本"
+// @Success 200 {object} models.Response{data=models.OrderParseResult}
+// @Router /api/v1/orders/parse [post]
+func ParseOrderText(c *gin.Context) {
+	var req models.OrderParseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.Error(c, "请求参数错误")
+		return
+	}
+
+	var rules []models.OrderParseRule
+	if err := database.DB.Where("is_active = ?", true).Order("priority ASC, rule_id ASC").Find(&rules).Error; err != nil {
+		utils.Error(c, "查询识别规则失败")
+		return
+	}
+
+	reporterID, _ := middleware.CurrentMemberID(c)
+	raw, invalid := models.ExtractParseFields(req.Text, rules)
+	parser := &orderParser{reporterID: reporterID, now: time.Now(), raw: raw}
+	for _, ruleID := range invalid {
+		parser.result.Warnings = append(parser.result.Warnings, fmt.Sprintf("识别规则%d的正则表达式无效，已跳过", ruleID))
+	}
+
+	parser.resolveCustomer()
+	parser.resolveCategory()
+	parser.resolveTimes(req.Text)
+	parser.resolveUnitPrice()
+	parser.resolveTexts()
+
+	parser.result.Unresolved = []string{}
+	for _, field := range parser.result.Fields {
+		if !field.Resolved {
+			parser.result.Unresolved = append(parser.result.Unresolved, field.Field)
+		}
+	}
+
+	utils.Success(c, parser.result)
+}
+
+// validateParseRule 校验识别规则的字段和正则表达式
+func validateParseRule(req *models.OrderParseRuleRequest) string {
+	if !models.IsValidParseField(req.Field) {
+		return "无效的识别字段"
+	}
+	if _, err := regexp.Compile(req.Pattern); err != nil {
+		return "正则表达式无效：" + err.Error()
+	}
+	return ""
+}
+
+// GetOrderParseRules 获取报单识别规则
+// @Summary 获取报单识别规则
+// @Description 获取报单设置中的全部识别规则，按字段和优先级排序
+// @Tags 报单设置
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.Response{data=[]models.OrderParseRule}
+// @Router /api/v1/order-parse-rules [get]
+func GetOrderParseRules(c *gin.Context) {
+	var rules []models.OrderParseRule
+	if err := database.DB.Order("field ASC, priority ASC, rule_id ASC").Find(&rules).Error; err != nil {
+		utils.Error(c, "查询失败")
+		return
+	}
+	utils.Success(c, rules)
+}
+
+// CreateOrderParseRule 创建报单识别规则
+// @Summary 创建报单识别规则
+// @Description 新增一条识别规则，pattern 为正则表达式，取第一个非空分组作为字段内容
+// @Tags 报单设置
+// @Accept json
+// @Produce json
+// @Param data body models.OrderParseRuleRequest true "识别规则"
+// @Success 200 {object} models.Response{data=models.OrderParseRule}
+// @Router /api/v1/order-parse-rules [post]
+func CreateOrderParseRule(c *gin.Context) {
+	var req models.OrderParseRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.Error(c, "请求参数错误")
+		return
+	}
+	if message := validateParseRule(&req); message != "" {
+		utils.Error(c, message)
+		return
+	}
+
+	rule := models.OrderParseRule{
+		Field:       req.Field,
+		Pattern:     req.Pattern,
+		Priority:    req.Priority,
+		IsActive:    req.IsActive == nil || *req.IsActive,
+		Description: req.Description,
+	}
+	if err := database.DB.Create(&rule).Error; err != nil {
+		utils.Error(c, "创建识别规则失败")
+		return
+	}
+	// is_active 有默认值，创建时的 false 会被忽略，需要单独更新
+	if !rule.IsActive {
+		database.DB.Model(&rule).Update("is_active", false)
+	}
+
+	operatorID, _ := middleware.CurrentMemberID(c)
+	logOperation(operatorID, "创建", "报单设置", fmt.Sprintf("创建%s识别规则：%s", rule.Field, rule.Description),
+		strconv.FormatUint(uint64(rule.RuleID), 10), "识别规则", c.ClientIP(), c.GetHeader("User-Agent"))
+
+	utils.SuccessWithMessage(c, "创建识别规则成功", rule)
+}
+
+// UpdateOrderParseRule 更新报单识别规则
+// @Summary 更新报单识别规则
+// @Description 修改识别规则的字段、正则表达式、优先级或启用状态
+// @Tags 报单设置
+// @Accept json
+// @Produce json
+// @Param id path int true "规则ID"
+// @Param data body models.OrderParseRuleRequest true "识别规则"
+// @Success 200 {object} models.Response{data=models.OrderParseRule}
+// @Router /api/v1/order-parse-rules/{id} [put]
+func UpdateOrderParseRule(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.Error(c, "无效的规则ID")
+		return
+	}
+
+	var req models.OrderParseRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.Error(c, "请求参数错误")
+		return
+	}
+	if message := validateParseRule(&req); message != "" {
+		utils.Error(c, message)
+		return
+	}
+
+	var rule models.OrderParseRule
+	if err := database.DB.First(&rule, uint(id)).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.NotFound(c, "识别规则不存在")
+		} else {
+			utils.Error(c, "查询失败")
+		}
+		return
+	}
+
+	rule.Field = req.Field
+	rule.Pattern = req.Pattern
+	rule.Priority = req.Priority
+	if req.IsActive != nil {
+		rule.IsActive = *req.IsActive
+	}
+	rule.Description = req.Description
+	if err := database.DB.Save(&rule).Error; err != nil {
+		utils.Error(c, "更新识别规则失败")
+		return
+	}
+
+	operatorID, _ := middleware.CurrentMemberID(c)
+	logOperation(operatorID, "更新", "报单设置", fmt.Sprintf("更新%s识别规则：%s", rule.Field, rule.Description),
+		strconv.FormatUint(uint64(rule.RuleID), 10), "识别规则", c.ClientIP(), c.GetHeader("User-Agent"))
+
+	utils.SuccessWithMessage(c, "更新识别规则成功", rule)
+}
+
+// DeleteOrderParseRule 删除报单识别规则
+// @Summary 删除报单识别规则
+// @Description 删除一条识别规则
+// @Tags 报单设置
+// @Accept json
+// @Produce json
+// @Param id path int true "规则ID"
+// @Success 200 {object} models.Response
+// @Router /api/v1/order-parse-rules/{id} [delete]
+func DeleteOrderParseRule(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.Error(c, "无效的规则ID")
+		return
+	}
+
+	result := database.DB.Delete(&models.OrderParseRule{}, uint(id))
+	if result.Error != nil {
+		utils.Error(c, "删除识别规则失败")
+		return
+	}
+	if result.RowsAffected == 0 {
+		utils.NotFound(c, "识别规则不存在")
+		return
+	}
+
+	operatorID, _ := middleware.CurrentMemberID(c)
+	logOperation(operatorID, "删除", "报单设置", fmt.Sprintf("删除识别规则%d", id),
+		strconv.FormatUint(id, 10), "识别规则", c.ClientIP(), c.GetHeader("User-Agent"))
+
+	utils.SuccessWithMessage(c, "删除识别规则成功", nil)
+}
@@ -0,0 +1,376 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"tangsong-esports/database"
+	"tangsong-esports/middleware"
+	"tangsong-esports/models"
+	"tangsong-esports/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// applyPricingRequest 按请求设置订单的计价参数：单价来源、是否使用专属折扣和手动折扣
+// 修改手动折扣或取消专属折扣需要订单手动折扣权限；请求未传时保留原有设置
+func applyPricingRequest(c *gin.Context, tx *gorm.DB, order *models.PlaymateOrder, pricing *models.OrderPricing, req *models.OrderCreateRequest) (models.ValidationErrors, error) {
+	var errs models.ValidationErrors
+
+	// 单价：指定价目 > 手动录入 > 类别默认价目
+	switch {
+	case req.PriceID != nil:
+		var price models.CategoryPrice
+		err := tx.Where("price_id = ? AND order_category_id = ? AND is_active = ?", *req.PriceID, order.OrderCategoryID, true).
+			First(&price).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			errs.Add("price_id", models.ValidationInvalidAmount, "价目不存在或已停用")
+		} else if err != nil {
+			return nil, err
+		} else {
+			pricing.PriceID = &price.PriceID
+			pricing.PriceSource = models.PriceSourcePriceList
+			pricing.UnitPrice = price.UnitPrice
+		}
+	case req.UnitPrice.IsPositive():
+		pricing.PriceID = nil
+		pricing.PriceSource = models.PriceSourceManual
+		pricing.UnitPrice = req.UnitPrice
+	default:
+		var price models.CategoryPrice
+		err := tx.Where("order_category_id = ? AND is_default = ? AND is_active = ?", order.OrderCategoryID, true, true).
+			First(&price).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			errs.Add("unit_price", models.ValidationInvalidAmount, "单价必须大于0")
+		} else if err != nil {
+			return nil, err
+		} else {
+			pricing.PriceID = &price.PriceID
+			pricing.PriceSource = models.PriceSourcePriceList
+			pricing.UnitPrice = price.UnitPrice
+		}
+	}
+
+	// 不使用客户专属折扣会提高订单价格，与手动折扣一样需要订单手动折扣权限；请求未传时保持原设置
+	if req.ExclusiveDiscount != nil {
+		skip := !*req.ExclusiveDiscount
+		if skip != pricing.SkipExclusive && !middleware.HasPermission(c, models.PermOrderDiscount) {
+			return nil, newOrderStateError(models.StatusForbidden, "没有调整客户专属折扣的权限")
+		}
+		pricing.SkipExclusive = skip
+	}
+
+	if req.ManualDiscount != nil {
+		amount := *req.ManualDiscount
+		reason := strings.TrimSpace(req.ManualDiscountReason)
+		if amount != pricing.ManualDiscount || (amount > 0 && reason != pricing.ManualReason) {
+			if !middleware.HasPermission(c, models.PermOrderDiscount) {
+				return nil, newOrderStateError(models.StatusForbidden, "没有设置手动折扣的权限")
+			}
+			switch {
+			case amount.IsNegative():
+				errs.Add("manual_discount", models.ValidationInvalidAmount, "手动折扣金额不能为负数")
+			case amount > 0 && reason == "":
+				errs.Add("manual_discount_reason", models.ValidationRequired, "设置手动折扣需要填写原因")
+			case amount > 0:
+				operatorID, _ := middleware.CurrentMemberID(c)
+				pricing.ManualDiscount = amount
+				pricing.ManualReason = reason
+				pricing.ManualOperatorID = &operatorID
+			default:
+				pricing.ManualDiscount = 0
+				pricing.ManualReason = ""
+				pricing.ManualOperatorID = nil
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errs, nil
+	}
+
+	breakdown, err := priceOrder(tx, order, pricing)
+	if err != nil {
+		return nil, err
+	}
+	if breakdown.ManualDiscount < pricing.ManualDiscount {
+		errs.Add("manual_discount", models.ValidationInvalidAmount, "手动折扣不能超过折后金额%s元", breakdown.ManualDiscount+breakdown.FinalPrice)
+	}
+	return errs, nil
+}
+
+// priceOrder 按订单的计价参数重新计算价格，保存价格信息并重写折扣明细
+// 创建、修改和审批订单都通过该函数计价
+func priceOrder(tx *gorm.DB, order *models.PlaymateOrder, pricing *models.OrderPricing) (models.PriceBreakdown, error) {
+	unitPrice, breakdown, err := quoteOrder(tx, order, pricing)
+	if err != nil {
+		return breakdown, err
+	}
+	pricing.UnitPrice = unitPrice
+	pricing.OrderID = order.OrderID
+	pricing.TotalPrice = breakdown.ListPrice
+	pricing.DiscountAmount = breakdown.DiscountAmount
+	pricing.FinalPrice = breakdown.FinalPrice
+	if err := tx.Omit("Discounts").Save(pricing).Error; err != nil {
+		return breakdown, err
+	}
+
+	if err := tx.Where("order_id = ?", order.OrderID).Delete(&models.OrderPriceDiscount{}).Error; err != nil {
+		return breakdown, err
+	}
+	for i := range breakdown.Lines {
+		line := &breakdown.Lines[i]
+		line.OrderID = order.OrderID
+		if line.DiscountType == models.DiscountTypeManual {
+			line.Reason = pricing.ManualReason
+			line.OperatorID = pricing.ManualOperatorID
+		}
+		if err := tx.Create(line).Error; err != nil {
+			return breakdown, err
+		}
+	}
+	pricing.Discounts = breakdown.Lines
+	return breakdown, nil
+}
+
+// quoteOrder 按订单的计价参数计算价格，不保存，返回计价使用的单价和计价结果
+// 单价取自价目表的订单使用价目的当前单价，价目已停用时沿用原单价；客户专属折扣使用客户当前的偏好设置
+// 批量审批的余额预检查与审批扣款都按该结果计算，二者金额一致
+func quoteOrder(tx *gorm.DB, order *models.PlaymateOrder, pricing *models.OrderPricing) (models.Money, models.PriceBreakdown, error) {
+	unitPrice := pricing.UnitPrice
+	if pricing.PriceID != nil {
+		var price models.CategoryPrice
+		err := tx.Where("price_id = ? AND is_active = ?", *pricing.PriceID, true).First(&price).Error
+		if err == nil {
+			unitPrice = price.UnitPrice
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return unitPrice, models.PriceBreakdown{}, err
+		}
+	}
+
+	quote := models.PriceQuote{
+		UnitPrice:      unitPrice,
+		DurationHours:  order.DurationHours,
+		ManualDiscount: pricing.ManualDiscount,
+	}
+	if !pricing.SkipExclusive {
+		var preferences models.CustomerPreferences
+		err := tx.Where("customer_id = ?", order.CustomerID).First(&preferences).Error
+		if err == nil {
+			quote.ExclusiveDiscountType = preferences.ExclusiveDiscountType
+			quote.ExclusiveDiscountValue = preferences.ExclusiveDiscountValue
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return unitPrice, models.PriceBreakdown{}, err
+		}
+	}
+
+	return unitPrice, models.CalculateOrderPrice(quote, moneyRounding()), nil
+}
+
+// findCategory 根据路径参数查找订单类别，不存在时返回错误响应
+func findCategory(c *gin.Context) (*models.OrderCategory, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.Error(c, "无效的类别ID")
+		return nil, false
+	}
+	var category models.OrderCategory
+	if err := database.DB.First(&category, uint(id)).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.NotFound(c, "订单类别不存在")
+		} else {
+			utils.Error(c, "查询失败")
+		}
+		return nil, false
+	}
+	return &category, true
+}
+
+// saveCategoryPrice 保存类别价目，设为默认时取消同类别其他价目的默认标记
+func saveCategoryPrice(price *models.CategoryPrice) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if price.IsDefault {
+			query := tx.Model(&models.CategoryPrice{}).
+				Where("order_category_id = ? AND is_default = ?", price.OrderCategoryID, true)
+			if price.PriceID != 0 {
+				query = query.Where("price_id <> ?", price.PriceID)
+			}
+			if err := query.Update("is_default", false).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Save(price).Error; err != nil {
+			return err
+		}
+		// is_active 有默认值，创建时的 false 会被忽略，需要单独更新
+		if !price.IsActive {
+			return tx.Model(price).Update("is_active", false).Error
+		}
+		return nil
+	})
+}
+
+// GetCategoryPrices 获取类别价目表
+// @Summary 获取类别价目表
+// @Description 获取订单类别下的全部价目
+// @Tags 订单类别管理
+// @Accept json
+// @Produce json
+// @Param id path int true "类别ID"
+// @Success 200 {object} models.Response{data=[]models.CategoryPrice}
+// @Router /api/v1/order-categories/{id}/prices [get]
+func GetCategoryPrices(c *gin.Context) {
+	category, ok := findCategory(c)
+	if !ok {
+		return
+	}
+
+	var prices []models.CategoryPrice
+	if err := database.DB.Where("order_category_id = ?", category.CategoryID).
+		Order("sort_order ASC, price_id ASC").Find(&prices).Error; err != nil {
+		utils.Error(c, "查询失败")
+		return
+	}
+
+	utils.Success(c, prices)
+}
+
+// CreateCategoryPrice 创建类别价目
+// @Summary 创建类别价目
+// @Description 为订单类别新增一个价目，报单时可选择价目作为单价
+// @Tags 订单类别管理
+// @Accept json
+// @Produce json
+// @Param id path int true "类别ID"
+// @Param data body models.CategoryPriceRequest true "价目信息"
+// @Success 200 {object} models.Response{data=models.CategoryPrice}
+// @Router /api/v1/order-categories/{id}/prices [post]
+func CreateCategoryPrice(c *gin.Context) {
+	category, ok := findCategory(c)
+	if !ok {
+		return
+	}
+
+	var req models.CategoryPriceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.Error(c, "请求参数错误")
+		return
+	}
+	if !req.UnitPrice.IsPositive() {
+		utils.Error(c, "单价必须大于0")
+		return
+	}
+
+	price := models.CategoryPrice{
+		OrderCategoryID: category.CategoryID,
+		PriceName:       req.PriceName,
+		UnitPrice:       req.UnitPrice,
+		IsDefault:       req.IsDefault,
+		IsActive:        req.IsActive == nil || *req.IsActive,
+		SortOrder:       req.SortOrder,
+		Notes:           req.Notes,
+	}
+	if err := saveCategoryPrice(&price); err != nil {
+		utils.Error(c, "创建价目失败")
+		return
+	}
+
+	operatorID, _ := middleware.CurrentMemberID(c)
+	logOperation(operatorID, "创建", "订单类别", fmt.Sprintf("为类别%s创建价目：%s，单价%s元", category.CategoryName, price.PriceName, price.UnitPrice),
+		strconv.FormatUint(uint64(price.PriceID), 10), "类别价目", c.ClientIP(), c.GetHeader("User-Agent"))
+
+	utils.SuccessWithMessage(c, "创建价目成功", price)
+}
+
+// UpdateCategoryPrice 更新类别价目
+// @Summary 更新类别价目
+// @Description 修改价目的名称、单价、默认标记或启用状态，待审批的订单审批时按新单价计价
+// @Tags 订单类别管理
+// @Accept json
+// @Produce json
+// @Param id path int true "类别ID"
+// @Param price_id path int true "价目ID"
+// @Param data body models.CategoryPriceRequest true "价目信息"
+// @Success 200 {object} models.Response{data=models.CategoryPrice}
+// @Router /api/v1/order-categories/{id}/prices/{price_id} [put]
+func UpdateCategoryPrice(c *gin.Context) {
+	category, ok := findCategory(c)
+	if !ok {
+		return
+	}
+
+	var req models.CategoryPriceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.Error(c, "请求参数错误")
+		return
+	}
+	if !req.UnitPrice.IsPositive() {
+		utils.Error(c, "单价必须大于0")
+		return
+	}
+
+	var price models.CategoryPrice
+	if err := database.DB.Where("price_id = ? AND order_category_id = ?", c.Param("price_id"), category.CategoryID).
+		First(&price).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.NotFound(c, "价目不存在")
+		} else {
+			utils.Error(c, "查询失败")
+		}
+		return
+	}
+
+	price.PriceName = req.PriceName
+	price.UnitPrice = req.UnitPrice
+	price.IsDefault = req.IsDefault
+	if req.IsActive != nil {
+		price.IsActive = *req.IsActive
+	}
+	price.SortOrder = req.SortOrder
+	price.Notes = req.Notes
+	if err := saveCategoryPrice(&price); err != nil {
+		utils.Error(c, "更新价目失败")
+		return
+	}
+
+	operatorID, _ := middleware.CurrentMemberID(c)
+	logOperation(operatorID, "更新", "订单类别", fmt.Sprintf("更新类别%s的价目：%s，单价%s元", category.CategoryName, price.PriceName, price.UnitPrice),
+		strconv.FormatUint(uint64(price.PriceID), 10), "类别价目", c.ClientIP(), c.GetHeader("User-Agent"))
+
+	utils.SuccessWithMessage(c, "更新价目成功", price)
+}
+
+// DeleteCategoryPrice 删除类别价目
+// @Summary 删除类别价目
+// @Description 删除价目，已使用该价目的订单沿用原单价
+// @Tags 订单类别管理
+// @Accept json
+// @Produce json
+// @Param id path int true "类别ID"
+// @Param price_id path int true "价目ID"
+// @Success 200 {object} models.Response
+// @Router /api/v1/order-categories/{id}/prices/{price_id} [delete]
+func DeleteCategoryPrice(c *gin.Context) {
+	category, ok := findCategory(c)
+	if !ok {
+		return
+	}
+
+	result := database.DB.Where("price_id = ? AND order_category_id = ?", c.Param("price_id"), category.CategoryID).
+		Delete(&models.CategoryPrice{})
+	if result.Error != nil {
+		utils.Error(c, "删除价目失败")
+		return
+	}
+	if result.RowsAffected == 0 {
+		utils.NotFound(c, "价目不存在")
+		return
+	}
+
+	operatorID, _ := middleware.CurrentMemberID(c)
+	logOperation(operatorID, "删除", "订单类别", fmt.Sprintf("删除类别%s的价目%s", category.CategoryName, c.Param("price_id")),
+		c.Param("price_id"), "类别价目", c.ClientIP(), c.GetHeader("User-Agent"))
+
+	utils.SuccessWithMessage(c, "删除价目成功", nil)
+}
@@ -0,0 +1,453 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"tangsong-esports/database"
+	"tangsong-esports/models"
+	"tangsong-esports/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// orderStateError 订单状态流转失败，Code 决定响应状态码
+type orderStateError struct {
+	Code    int
+	Message string
+}
+
+func (e *orderStateError) Error() string {
+	return e.Message
+}
+
+func newOrderStateError(code int, format string, args ...interface{}) error {
+	return &orderStateError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// orderTransitionInput 订单状态流转参数
+type orderTransitionInput struct {
+	OrderID  uint
+	ToStatus string
+	Operator *models.InternalMember
+	Reason   string
+	Notes    string
+
+	// 退回时使用：退款金额为空表示全额退款；直接支付的订单需提供外部退款流水号
+	RefundAmount    *models.Money
+	RefundReference string
+}
+
+// orderTransitionResult 订单状态流转结果
+type orderTransitionResult struct {
+	Workflow   models.OrderWorkflow
+	FromStatus string
+	Message    string // 副作用说明，如扣款金额
+	Refund     *models.OrderRefund
+}
+
+// transitionOrder 在事务中执行订单状态流转：校验流转规则和前置条件，执行副作用并写入审批历史
+// 所有修改订单状态的接口都必须通过该函数
+func transitionOrder(tx *gorm.DB, in orderTransitionInput) (*orderTransitionResult, error) {
+	if !models.IsValidOrderStatus(in.ToStatus) {
+		return nil, newOrderStateError(models.StatusError, "无效的订单状态：%s", in.ToStatus)
+	}
+
+	// 锁定工作流行，同一订单的并发流转排队执行，后到的请求看到的是已变更的状态
+	workflow, err := lockOrderWorkflow(tx, in.OrderID)
+	if err != nil {
+		return nil, err
+	}
+
+	transition, ok := models.FindOrderTransition(workflow.OrderStatus, in.ToStatus)
+	if !ok {
+		return nil, newOrderStateError(models.StatusConflict, "订单当前状态为%s，不能变更为%s", workflow.OrderStatus, in.ToStatus)
+	}
+	reason := strings.TrimSpace(in.Reason)
+	if transition.RequireReason && reason == "" {
+		return nil, newOrderStateError(models.StatusError, "变更为%s需要填写原因", in.ToStatus)
+	}
+
+	var order models.PlaymateOrder
+	if err := tx.Preload("Pricing").First(&order, in.OrderID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, newOrderStateError(models.StatusNotFound, "订单不存在")
+		}
+		return nil, err
+	}
+
+	result := &orderTransitionResult{FromStatus: workflow.OrderStatus}
+	now := time.Now()
+
+	switch transition.Action {
+	case models.OrderActionApprove:
+		// 审批时按当前的价目和客户专属折扣重新计价，再按新金额扣款
+		if order.Pricing != nil {
+			if _, err := priceOrder(tx, &order, order.Pricing); err != nil {
+				return nil, err
+			}
+		}
+		message, err := captureOrderPayment(tx, &order, in.Operator.MemberID, now)
+		if err != nil {
+			return nil, err
+		}
+		result.Message = message
+		workflow.ApproverID = &in.Operator.MemberID
+		workflow.ApprovalTime = &now
+	case models.OrderActionReject:
+		if err := releaseOrderHold(tx, &order, now); err != nil {
+			return nil, err
+		}
+		workflow.RejectionReason = reason
+		workflow.ApproverID = &in.Operator.MemberID
+		workflow.ApprovalTime = &now
+	case models.OrderActionResubmit:
+		if order.Pricing == nil {
+			return nil, newOrderStateError(models.StatusError, "订单价格信息不存在")
+		}
+		if err := freezeOrderBalance(tx, &order, order.Pricing.FinalPrice); err != nil {
+			return nil, err
+		}
+		workflow.RejectionReason = ""
+		workflow.ApproverID = nil
+		workflow.ApprovalTime = nil
+	case models.OrderActionSettle:
+		var paymentInfo models.OrderPaymentInfo
+		if err := tx.Where("order_id = ?", order.OrderID).First(&paymentInfo).Error; err != nil || paymentInfo.PaymentStatus != "已付款" {
+			return nil, newOrderStateError(models.StatusError, "订单尚未付款，不能结算")
+		}
+		workflow.SettlementTime = &now
+	case models.OrderActionComplete:
+		workflow.CompletionTime = &now
+	case models.OrderActionReturn:
+		workflow.ReturnReason = reason
+		workflow.ReturnTime = &now
+	}
+
+	workflow.OrderStatus = in.ToStatus
+	if err := saveOrderWorkflow(tx, workflow); err != nil {
+		return nil, err
+	}
+
+	history := models.OrderApprovalHistory{
+		OrderID:      order.OrderID,
+		OperatorID:   in.Operator.MemberID,
+		OperatorName: in.Operator.Name,
+		Action:       transition.Action,
+		FromStatus:   result.FromStatus,
+		ToStatus:     in.ToStatus,
+		Reason:       reason,
+		Notes:        in.Notes,
+	}
+	if err := tx.Create(&history).Error; err != nil {
+		return nil, err
+	}
+
+	// 退款记录关联到本次操作历史
+	if transition.Action == models.OrderActionReturn {
+		refund, err := refundOrderPayment(tx, &order, in, history.ActionID, now)
+		if err != nil {
+			return nil, err
+		}
+		result.Refund = refund
+		if refund != nil {
+			result.Message = fmt.Sprintf("订单已退回，退款金额：%s元", refund.Amount)
+		}
+	}
+
+	result.Workflow = *workflow
+	return result, nil
+}
+
+// captureOrderPayment 审批通过时收款：余额支付的订单从客户余额扣款，其余订单记为直接支付
+func captureOrderPayment(tx *gorm.DB, order *models.PlaymateOrder, operatorID uint, now time.Time) (string, error) {
+	if order.Pricing == nil {
+		return "", newOrderStateError(models.StatusError, "订单价格信息不存在")
+	}
+
+	var paymentInfo models.OrderPaymentInfo
+	if err := tx.Where("order_id = ?", order.OrderID).First(&paymentInfo).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", newOrderStateError(models.StatusError, "订单支付信息不存在")
+		}
+		return "", err
+	}
+
+	paymentInfo.PaymentAmount = order.Pricing.FinalPrice
+	if !order.UseBalancePayment {
+		paymentInfo.PaymentStatus = "已付款"
+		paymentInfo.PaymentMethod = "直接支付"
+		paymentInfo.PaymentTime = &now
+		if err := tx.Save(&paymentInfo).Error; err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("订单审批成功,未走余额支付流程，订单ID: %d", order.OrderID), nil
+	}
+
+	customerFinancial, err := lockCustomerFinancial(tx, order.CustomerID)
+	if err != nil {
+		return "", err
+	}
+
+	// 先解除本订单的冻结，再从可用余额中扣款；提交时未冻结的历史订单直接校验可用余额
+	if err := closeOrderHold(tx, customerFinancial, order.OrderID, models.HoldStatusCaptured, now); err != nil {
+		return "", err
+	}
+	amount := order.Pricing.FinalPrice
+	if available := customerFinancial.AvailableBalance(); available < amount {
+		return "", newOrderStateError(models.StatusError, "客户余额不足，可用余额：%s，订单金额：%s", available, amount)
+	}
+
+	// 按配置的扣款顺序拆分实充和赠送部分
+	giftPart := models.SplitWalletDebit(amount, customerFinancial.RealBalance, customerFinancial.GiftBalance,
+		balanceDeductionOrder(), moneyRounding())
+	if _, err := postWalletEntry(tx, customerFinancial, walletPosting{
+		EntryType:     models.LedgerEntryOrderCharge,
+		Amount:        amount,
+		GiftAmount:    giftPart,
+		ReferenceType: models.LedgerRefOrder,
+		ReferenceID:   order.OrderID,
+		OperatorID:    operatorID,
+		Notes:         "订单审批扣款",
+	}); err != nil {
+		return "", err
+	}
+	customerFinancial.TotalConsumption += amount
+	if err := saveCustomerFinancial(tx, customerFinancial); err != nil {
+		return "", err
+	}
+
+	paymentInfo.PaymentStatus = "已付款"
+	paymentInfo.PaymentMethod = "余额支付"
+	paymentInfo.PaymentTime = &now
+	paymentInfo.GiftPaidAmount = giftPart
+	if err := tx.Save(&paymentInfo).Error; err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("订单审批成功！扣款金额：%s元（实充%s元，赠送%s元）", amount, amount-giftPart, giftPart), nil
+}
+
+// precheckBatchBalance 批量审批前按客户汇总待审批的余额支付订单重新计价后的金额，已冻结的部分不再重复计算
+// 可用余额不足的客户其本批次订单全部判为失败
+// 返回订单ID到失败原因的映射
+func precheckBatchBalance(orderIDs []uint) (map[uint]string, error) {
+	failures := make(map[uint]string)
+	if len(orderIDs) == 0 {
+		return failures, nil
+	}
+
+	var orders []models.PlaymateOrder
+	if err := database.DB.Preload("Pricing").Preload("Workflow").
+		Where("order_id IN ? AND use_balance_payment = ?", orderIDs, true).
+		Find(&orders).Error; err != nil {
+		return nil, err
+	}
+
+	var holds []models.BalanceHold
+	if err := database.DB.Where("order_id IN ? AND status = ?", orderIDs, models.HoldStatusActive).
+		Find(&holds).Error; err != nil {
+		return nil, err
+	}
+	held := make(map[uint]models.Money)
+	for _, hold := range holds {
+		held[hold.OrderID] = hold.Amount
+	}
+
+	totals := make(map[uint]models.Money)
+	customerOrders := make(map[uint][]uint)
+	for i := range orders {
+		order := &orders[i]
+		if order.Pricing == nil || order.Workflow == nil || order.Workflow.OrderStatus != models.OrderStatusPending {
+			continue
+		}
+		// 审批时会按当前价目和专属折扣重新计价，预检查使用同样的金额
+		_, breakdown, err := quoteOrder(database.DB, order, order.Pricing)
+		if err != nil {
+			return nil, err
+		}
+		totals[order.CustomerID] += breakdown.FinalPrice - held[order.OrderID]
+		customerOrders[order.CustomerID] = append(customerOrders[order.CustomerID], order.OrderID)
+	}
+	if len(totals) == 0 {
+		return failures, nil
+	}
+
+	customerIDs := make([]uint, 0, len(totals))
+	for customerID := range totals {
+		customerIDs = append(customerIDs, customerID)
+	}
+	var financials []models.CustomerFinancialInfo
+	if err := database.DB.Where("customer_id IN ?", customerIDs).Find(&financials).Error; err != nil {
+		return nil, err
+	}
+	balances := make(map[uint]models.Money)
+	for _, financial := range financials {
+		balances[financial.CustomerID] = financial.AvailableBalance()
+	}
+
+	for customerID, total := range totals {
+		balance := balances[customerID]
+		if balance >= total {
+			continue
+		}
+		message := fmt.Sprintf("客户可用余额不足以支付本批次订单，尚需：%s，可用余额：%s", total, balance)
+		for _, orderID := range customerOrders[customerID] {
+			failures[orderID] = message
+		}
+	}
+	return failures, nil
+}
+
+// refundOrderPayment 订单退回时退款：余额支付的按原扣款比例退回实充和赠送余额并冲减消费总额，直接支付的记录外部退款流水号
+// 退款金额为 0 时不退款，返回 nil
+func refundOrderPayment(tx *gorm.DB, order *models.PlaymateOrder, in orderTransitionInput, actionID uint, now time.Time) (*models.OrderRefund, error) {
+	var paymentInfo models.OrderPaymentInfo
+	if err := tx.Where("order_id = ?", order.OrderID).First(&paymentInfo).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, newOrderStateError(models.StatusError, "订单支付信息不存在")
+		}
+		return nil, err
+	}
+
+	refundable := paymentInfo.PaymentAmount - paymentInfo.RefundedAmount
+	amount := refundable
+	if in.RefundAmount != nil {
+		amount = *in.RefundAmount
+	}
+	if amount < 0 {
+		return nil, newOrderStateError(models.StatusError, "退款金额不能为负数")
+	}
+	if amount == 0 {
+		return nil, nil
+	}
+	if paymentInfo.PaymentStatus != "已付款" && paymentInfo.PaymentStatus != "部分退款" {
+		return nil, newOrderStateError(models.StatusError, "订单未付款，无法退款")
+	}
+	if amount > refundable {
+		return nil, newOrderStateError(models.StatusError, "退款金额超过可退金额：%s", refundable)
+	}
+
+	refund := models.OrderRefund{
+		OrderID:    order.OrderID,
+		CustomerID: order.CustomerID,
+		ActionID:   actionID,
+		Amount:     amount,
+		Reason:     strings.TrimSpace(in.Reason),
+		OperatorID: in.Operator.MemberID,
+		RefundedAt: now,
+	}
+
+	if paymentInfo.PaymentMethod == "余额支付" {
+		customerFinancial, err := lockCustomerFinancial(tx, order.CustomerID)
+		if err != nil {
+			return nil, err
+		}
+		// 尚未退回的赠送部分 = 原扣款的赠送部分 - 历次退回的赠送部分
+		var refunded struct{ GiftAmount models.Money }
+		if err := tx.Model(&models.OrderRefund{}).Where("order_id = ?", order.OrderID).
+			Select("COALESCE(SUM(gift_amount), 0) AS gift_amount").Scan(&refunded).Error; err != nil {
+			return nil, err
+		}
+		giftRemaining := paymentInfo.GiftPaidAmount - refunded.GiftAmount
+		refund.GiftAmount = models.SplitWalletDebit(amount, refundable-giftRemaining, giftRemaining,
+			models.DeductProportional, moneyRounding())
+
+		entry, err := postWalletEntry(tx, customerFinancial, walletPosting{
+			EntryType:     models.LedgerEntryRefund,
+			Amount:        amount,
+			GiftAmount:    refund.GiftAmount,
+			In:            true,
+			ReferenceType: models.LedgerRefOrder,
+			ReferenceID:   order.OrderID,
+			OperatorID:    in.Operator.MemberID,
+			Notes:         refund.Reason,
+		})
+		if err != nil {
+			return nil, err
+		}
+		customerFinancial.TotalConsumption -= amount
+		if customerFinancial.TotalConsumption < 0 {
+			customerFinancial.TotalConsumption = 0
+		}
+		if err := saveCustomerFinancial(tx, customerFinancial); err != nil {
+			return nil, err
+		}
+		refund.RefundMethod = models.RefundMethodBalance
+		refund.BalanceAfter = &customerFinancial.CurrentBalance
+		refund.LedgerEntryID = &entry.EntryID
+	} else {
+		reference := strings.TrimSpace(in.RefundReference)
+		if reference == "" {
+			return nil, newOrderStateError(models.StatusError, "直接支付的订单退款需填写退款流水号")
+		}
+		refund.RefundMethod = models.RefundMethodExternal
+		refund.ExternalReference = reference
+	}
+
+	if err := tx.Create(&refund).Error; err != nil {
+		return nil, err
+	}
+
+	paymentInfo.RefundedAmount += amount
+	if paymentInfo.RefundedAmount >= paymentInfo.PaymentAmount {
+		paymentInfo.PaymentStatus = "已退款"
+	} else {
+		paymentInfo.PaymentStatus = "部分退款"
+	}
+	if err := tx.Save(&paymentInfo).Error; err != nil {
+		return nil, err
+	}
+	return &refund, nil
+}
+
+// orderStateErrorMessage 提取流转失败原因，非业务错误返回 fallback
+func orderStateErrorMessage(err error, fallback string) string {
+	var stateErr *orderStateError
+	if errors.As(err, &stateErr) {
+		return stateErr.Message
+	}
+	if errors.Is(err, errVersionConflict) {
+		return err.Error()
+	}
+	log.Printf("[Order] 订单状态流转失败: %v", err)
+	return fallback
+}
+
+// respondOrderStateError 按错误类型返回订单状态流转失败的响应
+func respondOrderStateError(c *gin.Context, err error, fallback string) {
+	var stateErr *orderStateError
+	if errors.Is(err, errVersionConflict) {
+		utils.Conflict(c, err.Error())
+		return
+	}
+	if !errors.As(err, &stateErr) {
+		utils.Error(c, orderStateErrorMessage(err, fallback))
+		return
+	}
+
+	switch stateErr.Code {
+	case models.StatusNotFound:
+		utils.NotFound(c, stateErr.Message)
+	case models.StatusForbidden:
+		utils.Forbidden(c, stateErr.Message)
+	case models.StatusConflict:
+		utils.Conflict(c, stateErr.Message)
+	default:
+		utils.Error(c, stateErr.Message)
+	}
+}
+
+// GetOrderTransitions 获取订单状态流转规则
+// @Summary 获取订单状态流转规则
+// @Description 获取订单允许的全部状态流转，用于前端展示可执行的操作
+// @Tags 订单审批
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.Response{data=[]models.OrderTransition}
+// @Router /api/v1/order-approval/transitions [get]
+func GetOrderTransitions(c *gin.Context) {
+	utils.Success(c, models.OrderTransitions)
+}
@@ -0,0 +1,76 @@
+package controllers
+
+import (
+	"errors"
+	"strconv"
+	"tangsong-esports/database"
+	"tangsong-esports/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// orderTimeRules 从系统配置读取订单时间校验规则
+func orderTimeRules() models.OrderTimeRules {
+	rules := models.OrderTimeRules{
+		MaxHours:          models.Decimal(2400),
+		DurationTolerance: 15 * time.Minute,
+		FutureSkew:        10 * time.Minute,
+	}
+
+	var configs []models.SystemConfig
+	database.DB.Where("config_key IN ? AND is_active = ?",
+		[]string{"max_order_hours", "order_duration_tolerance_minutes", "order_future_skew_minutes"}, true).Find(&configs)
+	for _, cfg := range configs {
+		switch cfg.ConfigKey {
+		case "max_order_hours":
+			if hours, err := models.ParseDecimal(cfg.ConfigValue); err == nil && hours >= 0 {
+				rules.MaxHours = hours
+			}
+		case "order_duration_tolerance_minutes":
+			if minutes, err := strconv.Atoi(cfg.ConfigValue); err == nil && minutes >= 0 {
+				rules.DurationTolerance = time.Duration(minutes) * time.Minute
+			}
+		case "order_future_skew_minutes":
+			if minutes, err := strconv.Atoi(cfg.ConfigValue); err == nil && minutes >= 0 {
+				rules.FutureSkew = time.Duration(minutes) * time.Minute
+			}
+		}
+	}
+	return rules
+}
+
+// validateOrderRequest 校验订单的时间和时长，并检查报单人是否有时间重叠的订单；单价在计价时校验
+// excludeOrderID 为修改中的订单ID，新建时为 0；需在事务内调用，报单人行锁保证同一报单人的校验和保存串行执行
+func validateOrderRequest(tx *gorm.DB, reporterID uint, req *models.OrderCreateRequest, excludeOrderID uint) (models.ValidationErrors, error) {
+	errs := models.ValidateOrderTimes(req.StartTime, req.EndTime, req.DurationHours, time.Now(), orderTimeRules())
+	if len(errs) > 0 {
+		return errs, nil
+	}
+
+	var reporter models.InternalMember
+	if err := forUpdate(tx).First(&reporter, reporterID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, newOrderStateError(models.StatusNotFound, "报单人不存在")
+		}
+		return nil, err
+	}
+
+	// 被驳回和已退回的订单不再占用时间
+	var overlapping []models.PlaymateOrder
+	query := tx.Joins("JOIN order_workflow ON playmate_orders.order_id = order_workflow.order_id").
+		Where("playmate_orders.reporter_id = ?", reporterID).
+		Where("order_workflow.order_status NOT IN ?", []string{models.OrderStatusRejected, models.OrderStatusReturned}).
+		Where("playmate_orders.start_time < ? AND playmate_orders.end_time > ?", req.EndTime, req.StartTime)
+	if excludeOrderID != 0 {
+		query = query.Where("playmate_orders.order_id <> ?", excludeOrderID)
+	}
+	if err := query.Order("playmate_orders.start_time").Limit(5).Find(&overlapping).Error; err != nil {
+		return nil, err
+	}
+	for _, other := range overlapping {
+		errs.Add("start_time", models.ValidationOverlap, "与订单%d（%s 至 %s，客户：%s）时间重叠",
+			other.OrderID, other.StartTime.Format("2006-01-02 15:04"), other.EndTime.Format("2006-01-02 15:04"), other.CustomerName)
+	}
+	return errs, nil
+}
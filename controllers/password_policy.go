@@ -0,0 +1,193 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"tangsong-esports/database"
+	"tangsong-esports/models"
+	"tangsong-esports/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var errPasswordReused = errors.New("不能使用最近用过的密码")
+
+// loadPasswordPolicy 从系统配置读取密码策略，缺省时使用内置默认值
+func loadPasswordPolicy() utils.PasswordPolicy {
+	values := map[string]string{}
+	var configs []models.SystemConfig
+	database.DB.Where("config_key LIKE ? AND is_active = ?", "password_%", true).Find(&configs)
+	for _, cfg := range configs {
+		values[cfg.ConfigKey] = cfg.ConfigValue
+	}
+
+	intValue := func(key string, def int) int {
+		if v, err := strconv.Atoi(values[key]); err == nil && v >= 0 {
+			return v
+		}
+		return def
+	}
+	boolValue := func(key string, def bool) bool {
+		if v, err := strconv.ParseBool(values[key]); err == nil {
+			return v
+		}
+		return def
+	}
+
+	policy := utils.PasswordPolicy{
+		MinLength:     intValue("password_min_length", 8),
+		RequireUpper:  boolValue("password_require_upper", false),
+		RequireLower:  boolValue("password_require_lower", true),
+		RequireDigit:  boolValue("password_require_digit", true),
+		RequireSymbol: boolValue("password_require_symbol", false),
+		HistoryCount:  intValue("password_history_count", 5),
+	}
+	if blacklist := values["password_blacklist"]; blacklist != "" {
+		policy.Blacklist = strings.Split(blacklist, ",")
+	}
+	return policy
+}
+
+// checkNewPassword 校验新密码是否满足策略，且未在最近几次中使用过；subjectID 为 0 表示新建账户
+func checkNewPassword(subjectType string, subjectID uint, account, password, currentHash string) error {
+	policy := loadPasswordPolicy()
+	if err := policy.Validate(password, account); err != nil {
+		return err
+	}
+	if subjectID == 0 || policy.HistoryCount == 0 {
+		return nil
+	}
+
+	if currentHash != "" && utils.CheckPassword(password, currentHash) {
+		return errPasswordReused
+	}
+
+	var histories []models.PasswordHistory
+	database.DB.Where("subject_type = ? AND subject_id = ?", subjectType, subjectID).
+		Order("history_id DESC").Limit(policy.HistoryCount).Find(&histories)
+	for _, history := range histories {
+		if utils.CheckPassword(password, history.PasswordHash) {
+			return errPasswordReused
+		}
+	}
+	return nil
+}
+
+// recordPasswordHistory 记录新密码哈希，只保留策略要求的条数
+func recordPasswordHistory(tx *gorm.DB, subjectType string, subjectID uint, passwordHash string) error {
+	history := models.PasswordHistory{
+		SubjectType:  subjectType,
+		SubjectID:    subjectID,
+		PasswordHash: passwordHash,
+	}
+	if err := tx.Create(&history).Error; err != nil {
+		return err
+	}
+
+	keep := loadPasswordPolicy().HistoryCount
+	if keep < 1 {
+		keep = 1
+	}
+	var staleIDs []uint
+	tx.Model(&models.PasswordHistory{}).
+		Where("subject_type = ? AND subject_id = ?", subjectType, subjectID).
+		Order("history_id DESC").Offset(keep).Pluck("history_id", &staleIDs)
+	if len(staleIDs) > 0 {
+		return tx.Where("history_id IN ?", staleIDs).Delete(&models.PasswordHistory{}).Error
+	}
+	return nil
+}
+
+// GetPasswordPolicy 获取密码策略
+// @Summary 获取密码策略
+// @Description 获取当前密码策略，用于前端提示
+// @Tags 认证
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.Response{data=models.PasswordPolicyResponse}
+// @Router /api/v1/password-policy [get]
+func GetPasswordPolicy(c *gin.Context) {
+	policy := loadPasswordPolicy()
+	utils.Success(c, models.PasswordPolicyResponse{
+		MinLength:     policy.MinLength,
+		RequireUpper:  policy.RequireUpper,
+		RequireLower:  policy.RequireLower,
+		RequireDigit:  policy.RequireDigit,
+		RequireSymbol: policy.RequireSymbol,
+		HistoryCount:  policy.HistoryCount,
+	})
+}
+
+// respondPasswordChangeChallenge 密码验证通过但必须先修改密码时返回登录挑战
+func respondPasswordChangeChallenge(c *gin.Context, member *models.InternalMember) {
+	token, err := utils.GenerateChallengeToken(utils.TokenTypePasswordChange, utils.SubjectStaff, member.MemberID, member.Account, member.UserRole)
+	if err != nil {
+		log.Printf("[Login] 生成改密挑战失败: %v", err)
+		utils.Error(c, "生成令牌失败")
+		return
+	}
+
+	utils.SuccessWithMessage(c, "请先修改密码", models.PasswordChangeChallengeResponse{
+		PasswordChangeRequired: true,
+		ChallengeToken:         token,
+		ExpiresIn:              int64(utils.ChallengeTokenTTL.Seconds()),
+	})
+}
+
+// LoginChangePassword 登录时强制修改密码
+// @Summary 登录时强制修改密码
+// @Description 使用默认密码或被要求改密的成员，凭登录挑战令牌设置新密码后继续登录
+// @Tags 认证
+// @Accept json
+// @Produce json
+// @Param data body models.LoginChangePasswordRequest true "新密码"
+// @Success 200 {object} models.Response{data=models.AuthTokenResponse}
+// @Router /api/v1/login/change-password [post]
+func LoginChangePassword(c *gin.Context) {
+	var req models.LoginChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.Error(c, "请求参数错误")
+		return
+	}
+
+	member, ok := challengeMember(c, req.ChallengeToken, utils.TokenTypePasswordChange)
+	if !ok {
+		return
+	}
+	if !member.MustChangePassword {
+		utils.Error(c, "无需修改密码")
+		return
+	}
+
+	if err := checkNewPassword(utils.SubjectStaff, member.MemberID, member.Account, req.NewPassword, member.PasswordHash); err != nil {
+		utils.Error(c, err.Error())
+		return
+	}
+
+	hashedPassword, err := utils.HashPassword(req.NewPassword)
+	if err != nil {
+		utils.Error(c, "密码加密失败")
+		return
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		updates := map[string]interface{}{
+			"password_hash":        hashedPassword,
+			"must_change_password": false,
+		}
+		if err := tx.Model(member).Updates(updates).Error; err != nil {
+			return err
+		}
+		return recordPasswordHistory(tx, utils.SubjectStaff, member.MemberID, hashedPassword)
+	})
+	if err != nil {
+		utils.Error(c, "修改密码失败")
+		return
+	}
+
+	log.Printf("[Login] 成员已修改初始密码: %s (ID: %d)", member.Account, member.MemberID)
+	continueStaffLogin(c, member)
+}
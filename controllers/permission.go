@@ -0,0 +1,152 @@
+package controllers
+
+import (
+	"sort"
+	"tangsong-esports/database"
+	"tangsong-esports/middleware"
+	"tangsong-esports/models"
+	"tangsong-esports/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetPermissionCatalog 获取权限列表
+// @Summary 获取权限列表
+// @Description 获取系统支持的全部权限代码及说明
+// @Tags 权限管理
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.Response{data=[]models.PermissionDefinition}
+// @Router /api/v1/permissions [get]
+func GetPermissionCatalog(c *gin.Context) {
+	utils.Success(c, models.PermissionCatalog)
+}
+
+// GetRolePermissions 获取角色权限
+// @Summary 获取角色权限
+// @Description 获取所有角色及其拥有的权限
+// @Tags 权限管理
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.Response{data=[]models.RolePermissionsResponse}
+// @Router /api/v1/permissions/roles [get]
+func GetRolePermissions(c *gin.Context) {
+	var rows []models.RolePermission
+	if err := database.DB.Order("role_name ASC, permission_code ASC").Find(&rows).Error; err != nil {
+		utils.Error(c, "查询角色权限失败")
+		return
+	}
+
+	grouped := make(map[string][]string)
+	var roles []string
+	for _, row := range rows {
+		if _, exists := grouped[row.RoleName]; !exists {
+			roles = append(roles, row.RoleName)
+		}
+		grouped[row.RoleName] = append(grouped[row.RoleName], row.PermissionCode)
+	}
+
+	response := make([]models.RolePermissionsResponse, 0, len(roles))
+	for _, role := range roles {
+		response = append(response, models.RolePermissionsResponse{
+			RoleName:    role,
+			Permissions: grouped[role],
+		})
+	}
+
+	utils.Success(c, response)
+}
+
+// UpdateRolePermissions 更新角色权限
+// @Summary 更新角色权限
+// @Description 以覆盖方式设置指定角色的权限
+// @Tags 权限管理
+// @Accept json
+// @Produce json
+// @Param role path string true "角色名称"
+// @Param permissions body models.RolePermissionsUpdateRequest true "权限列表"
+// @Success 200 {object} models.Response{data=models.RolePermissionsResponse}
+// @Router /api/v1/permissions/roles/{role} [put]
+func UpdateRolePermissions(c *gin.Context) {
+	role := c.Param("role")
+	if role == "" {
+		utils.Error(c, "角色名称不能为空")
+		return
+	}
+	if role == models.RoleSuperAdmin {
+		utils.Error(c, "超级管理员拥有全部权限，无需设置")
+		return
+	}
+
+	var req models.RolePermissionsUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.Error(c, "请求参数错误")
+		return
+	}
+
+	// 校验并去重权限代码
+	permSet := make(map[string]bool)
+	for _, perm := range req.Permissions {
+		if !models.IsValidPermission(perm) {
+			utils.Error(c, "无效的权限代码: "+perm)
+			return
+		}
+		permSet[perm] = true
+	}
+	perms := make([]string, 0, len(permSet))
+	for perm := range permSet {
+		perms = append(perms, perm)
+	}
+	sort.Strings(perms)
+
+	// 开启事务
+	tx := database.DB.Begin()
+
+	if err := tx.Where("role_name = ?", role).Delete(&models.RolePermission{}).Error; err != nil {
+		tx.Rollback()
+		utils.Error(c, "更新角色权限失败")
+		return
+	}
+
+	for _, perm := range perms {
+		row := models.RolePermission{RoleName: role, PermissionCode: perm}
+		if err := tx.Create(&row).Error; err != nil {
+			tx.Rollback()
+			utils.Error(c, "更新角色权限失败")
+			return
+		}
+	}
+
+	tx.Commit()
+	middleware.InvalidatePermissionCache()
+
+	// 记录操作日志
+	operatorID, _ := middleware.CurrentMemberID(c)
+	logOperation(operatorID, "更新", "权限管理", "更新角色权限："+role, role, "角色", c.ClientIP(), c.GetHeader("User-Agent"))
+
+	utils.SuccessWithMessage(c, "更新角色权限成功", models.RolePermissionsResponse{
+		RoleName:    role,
+		Permissions: perms,
+	})
+}
+
+// GetMyPermissions 获取当前用户权限
+// @Summary 获取当前用户权限
+// @Description 获取当前登录用户拥有的权限代码
+// @Tags 权限管理
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.Response{data=models.RolePermissionsResponse}
+// @Router /api/v1/permissions/me [get]
+func GetMyPermissions(c *gin.Context) {
+	perms := make([]string, 0)
+	for perm := range middleware.GetPermissions(c) {
+		perms = append(perms, perm)
+	}
+	sort.Strings(perms)
+
+	utils.Success(c, models.RolePermissionsResponse{
+		RoleName:    middleware.CurrentRole(c),
+		Permissions: perms,
+	})
+}
@@ -0,0 +1,355 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"tangsong-esports/database"
+	"tangsong-esports/middleware"
+	"tangsong-esports/models"
+	"tangsong-esports/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 单个验证码允许的最大校验失败次数
+const smsCodeMaxAttempts = 5
+
+var (
+	errSMSTooFrequent  = errors.New("发送过于频繁，请稍后再试")
+	errSMSDailyLimit   = errors.New("今日发送次数已达上限")
+	errSMSCodeInvalid  = errors.New("验证码错误或已过期")
+	errSMSSendFailed   = errors.New("验证码发送失败")
+	errSMSPhoneMissing = errors.New("未绑定手机号")
+	errPhoneTaken      = errors.New("该手机号已被其他账户验证")
+)
+
+// smsSettings 短信验证码相关配置
+type smsSettings struct {
+	TTL           time.Duration
+	Interval      time.Duration
+	DailyPerPhone int64
+	HourlyPerIP   int64
+}
+
+// loadSMSSettings 从系统配置读取短信验证码设置，缺省时使用内置默认值
+func loadSMSSettings() smsSettings {
+	values := map[string]string{}
+	var configs []models.SystemConfig
+	database.DB.Where("config_key LIKE ? AND is_active = ?", "sms_%", true).Find(&configs)
+	for _, cfg := range configs {
+		values[cfg.ConfigKey] = cfg.ConfigValue
+	}
+
+	intValue := func(key string, def int) int {
+		if v, err := strconv.Atoi(values[key]); err == nil && v > 0 {
+			return v
+		}
+		return def
+	}
+
+	return smsSettings{
+		TTL:           time.Duration(intValue("sms_code_ttl_minutes", 5)) * time.Minute,
+		Interval:      time.Duration(intValue("sms_send_interval_seconds", 60)) * time.Second,
+		DailyPerPhone: int64(intValue("sms_daily_limit_per_phone", 10)),
+		HourlyPerIP:   int64(intValue("sms_hourly_limit_per_ip", 20)),
+	}
+}
+
+// sendSMSCode 检查发送频率后生成验证码并发送，同一用途的旧验证码随即失效
+func sendSMSCode(c *gin.Context, customer *models.Customer, purpose string, settings smsSettings) error {
+	phone := customer.PhoneNumber
+	if phone == "" {
+		return errSMSPhoneMissing
+	}
+	now := time.Now()
+	ip := c.ClientIP()
+
+	code, err := utils.RandomDigits(6)
+	if err != nil {
+		return err
+	}
+
+	// 按手机号和IP加锁，频率检查和写入发送记录串行执行，并发请求不能同时通过检查
+	var record models.SMSVerificationCode
+	err = withNamedLocks([]string{"sms_phone:" + phone, "sms_ip:" + ip}, func(tx *gorm.DB) error {
+		var last models.SMSVerificationCode
+		if err := tx.Where("phone_number = ?", phone).Order("created_at DESC").First(&last).Error; err == nil {
+			if now.Sub(last.CreatedAt) < settings.Interval {
+				return errSMSTooFrequent
+			}
+		}
+
+		var count int64
+		tx.Model(&models.SMSVerificationCode{}).
+			Where("phone_number = ? AND created_at > ?", phone, now.Add(-24*time.Hour)).Count(&count)
+		if count >= settings.DailyPerPhone {
+			return errSMSDailyLimit
+		}
+		tx.Model(&models.SMSVerificationCode{}).
+			Where("send_ip = ? AND created_at > ?", ip, now.Add(-time.Hour)).Count(&count)
+		if count >= settings.HourlyPerIP {
+			return errSMSTooFrequent
+		}
+
+		if err := tx.Model(&models.SMSVerificationCode{}).
+			Where("phone_number = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?", phone, purpose, now).
+			Update("expires_at", now).Error; err != nil {
+			return err
+		}
+
+		record = models.SMSVerificationCode{
+			PhoneNumber: phone,
+			Purpose:     purpose,
+			CustomerID:  customer.CustomerID,
+			CodeHash:    utils.HashOneTimeCode(code),
+			ExpiresAt:   now.Add(settings.TTL),
+			SendIP:      ip,
+		}
+		return tx.Create(&record).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	message := fmt.Sprintf("【唐宋电竞】您的验证码为%s，%d分钟内有效，请勿泄露给他人。", code, int(settings.TTL.Minutes()))
+	if err := utils.DefaultSMSSender().Send(phone, message); err != nil {
+		log.Printf("[SMS] 发送验证码失败: %s, 错误: %v", phone, err)
+		database.DB.Delete(&record)
+		return errSMSSendFailed
+	}
+	return nil
+}
+
+// checkSMSCode 校验验证码，失败次数过多的验证码直接作废
+func checkSMSCode(phone, purpose, code string) (*models.SMSVerificationCode, error) {
+	var record models.SMSVerificationCode
+	err := database.DB.Where("phone_number = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?", phone, purpose, time.Now()).
+		Order("created_at DESC").First(&record).Error
+	if err != nil {
+		return nil, errSMSCodeInvalid
+	}
+
+	// 先原子地占用一次校验次数再比对，并发请求不能绕过次数上限
+	result := database.DB.Model(&models.SMSVerificationCode{}).
+		Where("verification_id = ? AND attempts < ?", record.VerificationID, smsCodeMaxAttempts).
+		UpdateColumn("attempts", gorm.Expr("attempts + 1"))
+	if result.Error != nil || result.RowsAffected != 1 {
+		return nil, errSMSCodeInvalid
+	}
+	if record.CodeHash != utils.HashOneTimeCode(code) {
+		return nil, errSMSCodeInvalid
+	}
+
+	result = database.DB.Model(&models.SMSVerificationCode{}).
+		Where("verification_id = ? AND used_at IS NULL", record.VerificationID).
+		Update("used_at", time.Now())
+	if result.Error != nil || result.RowsAffected != 1 {
+		return nil, errSMSCodeInvalid
+	}
+	return &record, nil
+}
+
+// respondSMSError 将发送错误转换为响应
+func respondSMSError(c *gin.Context, err error) {
+	switch err {
+	case errSMSTooFrequent, errSMSDailyLimit:
+		utils.TooManyRequests(c, err.Error())
+	case errSMSPhoneMissing, errSMSSendFailed, errNamedLockTimeout:
+		utils.Error(c, err.Error())
+	default:
+		utils.Error(c, "验证码发送失败")
+	}
+}
+
+// SendPhoneVerificationCode 发送手机号验证码
+// @Summary 发送手机号验证码
+// @Description 向当前客户绑定的手机号发送验证码
+// @Tags 客户认证
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.Response{data=models.SMSSendResponse}
+// @Router /api/v1/customer/phone/send-code [post]
+func SendPhoneVerificationCode(c *gin.Context) {
+	customerID, exists := middleware.CurrentCustomerID(c)
+	if !exists {
+		utils.Error(c, "未找到客户信息")
+		return
+	}
+
+	var customer models.Customer
+	if err := database.DB.First(&customer, customerID).Error; err != nil {
+		utils.NotFound(c, "客户不存在")
+		return
+	}
+	if customer.IsPhoneVerified {
+		utils.Error(c, "手机号已验证")
+		return
+	}
+
+	settings := loadSMSSettings()
+	if err := sendSMSCode(c, &customer, models.SMSPurposeVerifyPhone, settings); err != nil {
+		respondSMSError(c, err)
+		return
+	}
+
+	utils.SuccessWithMessage(c, "验证码已发送", models.SMSSendResponse{
+		ExpiresIn: int64(settings.TTL.Seconds()),
+		Interval:  int64(settings.Interval.Seconds()),
+	})
+}
+
+// VerifyPhone 验证手机号
+// @Summary 验证手机号
+// @Description 提交短信验证码完成手机号验证，验证后可使用手机号验证码登录
+// @Tags 客户认证
+// @Accept json
+// @Produce json
+// @Param data body models.VerifyPhoneRequest true "验证码"
+// @Success 200 {object} models.Response{data=models.StandardResponse}
+// @Router /api/v1/customer/phone/verify [post]
+func VerifyPhone(c *gin.Context) {
+	var req models.VerifyPhoneRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.Error(c, "请求参数错误")
+		return
+	}
+
+	customerID, exists := middleware.CurrentCustomerID(c)
+	if !exists {
+		utils.Error(c, "未找到客户信息")
+		return
+	}
+
+	var customer models.Customer
+	if err := database.DB.First(&customer, customerID).Error; err != nil {
+		utils.NotFound(c, "客户不存在")
+		return
+	}
+	if customer.PhoneNumber == "" {
+		utils.Error(c, "未绑定手机号")
+		return
+	}
+
+	record, err := checkSMSCode(customer.PhoneNumber, models.SMSPurposeVerifyPhone, req.Code)
+	if err != nil || record.CustomerID != customer.CustomerID {
+		utils.Error(c, errSMSCodeInvalid.Error())
+		return
+	}
+
+	// 同一手机号只能被一个客户验证，避免验证码登录时无法确定账户；按手机号加锁，并发验证时检查和更新串行执行
+	err = withNamedLocks([]string{"phone_verify:" + customer.PhoneNumber}, func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&models.Customer{}).
+			Where("phone_number = ? AND is_phone_verified = ? AND customer_id != ?", customer.PhoneNumber, true, customer.CustomerID).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return errPhoneTaken
+		}
+		return tx.Model(&customer).Update("is_phone_verified", true).Error
+	})
+	if err != nil {
+		if errors.Is(err, errPhoneTaken) {
+			utils.Error(c, err.Error())
+		} else {
+			utils.Error(c, "验证手机号失败")
+		}
+		return
+	}
+
+	utils.SuccessWithMessage(c, "手机号验证成功", models.StandardResponse{
+		Success: true,
+		Message: "手机号验证成功",
+	})
+}
+
+// SendLoginSMS 发送登录验证码
+// @Summary 发送登录验证码
+// @Description 向已验证的手机号发送登录验证码；手机号未注册、未验证或触发发送频率限制时同样返回成功，避免泄露账户信息
+// @Tags 客户认证
+// @Accept json
+// @Produce json
+// @Param data body models.SendLoginSMSRequest true "手机号"
+// @Success 200 {object} models.Response{data=models.SMSSendResponse}
+// @Router /api/v1/customer/login/sms/send [post]
+func SendLoginSMS(c *gin.Context) {
+	var req models.SendLoginSMSRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.Error(c, "请求参数错误")
+		return
+	}
+
+	settings := loadSMSSettings()
+	response := models.SMSSendResponse{
+		ExpiresIn: int64(settings.TTL.Seconds()),
+		Interval:  int64(settings.Interval.Seconds()),
+	}
+
+	var customer models.Customer
+	err := database.DB.Where("phone_number = ? AND is_phone_verified = ? AND status = ?", req.PhoneNumber, true, "正常").
+		First(&customer).Error
+	if err != nil {
+		log.Printf("[SendLoginSMS] 手机号未验证或不存在: %s (IP: %s)", req.PhoneNumber, c.ClientIP())
+		utils.SuccessWithMessage(c, "验证码已发送", response)
+		return
+	}
+
+	// 频率限制等错误同样返回成功，否则连续发送两次即可判断手机号是否属于某个客户
+	if err := sendSMSCode(c, &customer, models.SMSPurposeLogin, settings); err != nil {
+		log.Printf("[SendLoginSMS] 发送登录验证码失败: %s (IP: %s), 错误: %v", req.PhoneNumber, c.ClientIP(), err)
+	}
+
+	utils.SuccessWithMessage(c, "验证码已发送", response)
+}
+
+// CustomerSMSLogin 手机号验证码登录
+// @Summary 手机号验证码登录
+// @Description 使用已验证的手机号和短信验证码登录
+// @Tags 客户认证
+// @Accept json
+// @Produce json
+// @Param data body models.SMSLoginRequest true "登录信息"
+// @Success 200 {object} models.Response{data=models.AuthTokenResponse}
+// @Router /api/v1/customer/login/sms [post]
+func CustomerSMSLogin(c *gin.Context) {
+	var req models.SMSLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.Error(c, "请求参数错误")
+		return
+	}
+
+	// 以手机号作为锁定键，与账号密码登录共用失败锁定策略
+	ip := c.ClientIP()
+	if remaining := loginLockedFor(utils.SubjectCustomer, req.PhoneNumber, ip); remaining > 0 {
+		utils.TooManyRequests(c, loginLockedMessage(remaining))
+		return
+	}
+
+	var customer models.Customer
+	err := database.DB.Where("phone_number = ? AND is_phone_verified = ?", req.PhoneNumber, true).First(&customer).Error
+	if err != nil {
+		loginFailed(c, utils.SubjectCustomer, req.PhoneNumber, errSMSCodeInvalid.Error())
+		return
+	}
+
+	record, err := checkSMSCode(req.PhoneNumber, models.SMSPurposeLogin, req.Code)
+	if err != nil || record.CustomerID != customer.CustomerID {
+		recordCustomerLogin(c, customer.CustomerID, models.LoginStatusFailed, models.LoginFailSMSCode)
+		loginFailed(c, utils.SubjectCustomer, req.PhoneNumber, errSMSCodeInvalid.Error())
+		return
+	}
+
+	if customer.Status != "正常" {
+		recordCustomerLogin(c, customer.CustomerID, models.LoginStatusFailed, models.LoginFailDisabled)
+		utils.Error(c, "账户已被禁用")
+		return
+	}
+
+	resetLoginFailures(utils.SubjectCustomer, req.PhoneNumber)
+	completeCustomerLogin(c, &customer, "登录成功")
+}
@@ -0,0 +1,91 @@
+package controllers
+
+import (
+	"database/sql"
+	"errors"
+	"tangsong-esports/database"
+	"tangsong-esports/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// errVersionConflict 乐观锁校验失败，记录在读取后已被其他请求修改
+var errVersionConflict = errors.New("数据已被其他操作修改，请刷新后重试")
+
+// errNamedLockTimeout 等待命名锁超时
+var errNamedLockTimeout = errors.New("系统繁忙，请稍后再试")
+
+// 等待命名锁的最长时间（秒）
+const namedLockTimeoutSeconds = 5
+
+// forUpdate 为查询加 SELECT ... FOR UPDATE 行锁，锁在事务结束时释放
+func forUpdate(tx *gorm.DB) *gorm.DB {
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"})
+}
+
+// lockCustomerFinancial 加行锁读取客户财务信息，同一客户的充值、冻结、扣款和退款在事务内串行执行
+func lockCustomerFinancial(tx *gorm.DB, customerID uint) (*models.CustomerFinancialInfo, error) {
+	var financial models.CustomerFinancialInfo
+	if err := forUpdate(tx).Where("customer_id = ?", customerID).First(&financial).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, newOrderStateError(models.StatusError, "客户财务信息不存在，请先为客户充值")
+		}
+		return nil, err
+	}
+	return &financial, nil
+}
+
+// lockOrderWorkflow 加行锁读取订单工作流，同一订单的状态流转串行执行
+func lockOrderWorkflow(tx *gorm.DB, orderID uint) (*models.OrderWorkflow, error) {
+	var workflow models.OrderWorkflow
+	if err := forUpdate(tx).Where("order_id = ?", orderID).First(&workflow).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, newOrderStateError(models.StatusNotFound, "订单不存在")
+		}
+		return nil, err
+	}
+	return &workflow, nil
+}
+
+// updateVersioned 按读取时的版本号更新整行并递增版本号，版本不一致时返回 errVersionConflict
+func updateVersioned(tx *gorm.DB, value interface{}, version *uint) error {
+	current := *version
+	*version = current + 1
+	result := tx.Model(value).Where("version = ?", current).Select("*").Omit("created_at").Updates(value)
+	if result.Error == nil && result.RowsAffected == 0 {
+		result.Error = errVersionConflict
+	}
+	if result.Error != nil {
+		*version = current
+	}
+	return result.Error
+}
+
+// saveCustomerFinancial 保存客户财务信息，带版本校验
+func saveCustomerFinancial(tx *gorm.DB, financial *models.CustomerFinancialInfo) error {
+	return updateVersioned(tx, financial, &financial.Version)
+}
+
+// saveOrderWorkflow 保存订单工作流，带版本校验
+func saveOrderWorkflow(tx *gorm.DB, workflow *models.OrderWorkflow) error {
+	return updateVersioned(tx, workflow, &workflow.Version)
+}
+
+// withNamedLocks 在同一数据库连接上依次获取 MySQL 命名锁，再在该连接上开启事务执行 fn，事务提交后才释放锁；
+// 用于没有现成的行可以加锁的“先统计后写入”检查，如按手机号和IP统计的发送次数。多个锁需按固定顺序传入
+func withNamedLocks(names []string, fn func(tx *gorm.DB) error) error {
+	return database.DB.Connection(func(conn *gorm.DB) error {
+		for _, name := range names {
+			var acquired sql.NullInt64
+			if err := conn.Raw("SELECT GET_LOCK(?, ?)", name, namedLockTimeoutSeconds).Scan(&acquired).Error; err != nil {
+				return err
+			}
+			if acquired.Int64 != 1 {
+				return errNamedLockTimeout
+			}
+			defer conn.Exec("SELECT RELEASE_LOCK(?)", name)
+		}
+		return conn.Transaction(fn)
+	})
+}
@@ -0,0 +1,301 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"tangsong-esports/database"
+	"tangsong-esports/middleware"
+	"tangsong-esports/models"
+	"tangsong-esports/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var (
+	errSessionInvalid     = errors.New("会话已失效")
+	errRefreshTokenReused = errors.New("刷新令牌已被使用")
+)
+
+// createSession 登录成功后创建服务端会话
+func createSession(c *gin.Context, subjectType string, subjectID uint) (*models.UserSession, error) {
+	tokenID, err := utils.GenerateTokenID()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	session := models.UserSession{
+		TokenID:      tokenID,
+		SubjectType:  subjectType,
+		SubjectID:    subjectID,
+		LoginIP:      c.ClientIP(),
+		UserAgent:    c.GetHeader("User-Agent"),
+		LastActiveAt: now,
+		ExpiresAt:    now.Add(utils.RefreshTokenTTL()),
+	}
+	if err := database.DB.Create(&session).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// issueSessionTokens 为会话签发访问令牌和新的刷新令牌，旧刷新令牌随即失效
+// 轮换按会话当前的刷新令牌ID做条件更新，并发刷新时只有一个请求能成功，其余视为重放并注销会话
+func issueSessionTokens(session *models.UserSession, account, userRole string) (string, string, error) {
+	accessToken, err := utils.GenerateToken(session.SubjectType, session.SubjectID, account, userRole, session.TokenID)
+	if err != nil {
+		return "", "", err
+	}
+
+	refreshTokenID, err := utils.GenerateTokenID()
+	if err != nil {
+		return "", "", err
+	}
+	refreshToken, err := utils.GenerateRefreshToken(session.SubjectType, session.SubjectID, account, userRole, session.TokenID, refreshTokenID)
+	if err != nil {
+		return "", "", err
+	}
+
+	updates := map[string]interface{}{
+		"refresh_token_id": refreshTokenID,
+		"expires_at":       time.Now().Add(utils.RefreshTokenTTL()),
+	}
+	result := database.DB.Model(&models.UserSession{}).
+		Where("session_id = ? AND refresh_token_id = ? AND revoked_at IS NULL", session.SessionID, session.RefreshTokenID).
+		Updates(updates)
+	if result.Error != nil {
+		return "", "", result.Error
+	}
+	if result.RowsAffected == 0 {
+		log.Printf("[Session] 刷新令牌已被并发使用，注销会话: %d", session.SessionID)
+		revokeSession(session, models.SessionRevokeRefreshReuse)
+		return "", "", errRefreshTokenReused
+	}
+	session.RefreshTokenID = refreshTokenID
+
+	return accessToken, refreshToken, nil
+}
+
+// newAuthTokenResponse 组装登录和刷新令牌的统一响应
+func newAuthTokenResponse(session *models.UserSession, accessToken, refreshToken string, user interface{}) models.AuthTokenResponse {
+	return models.AuthTokenResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(utils.AccessTokenTTL().Seconds()),
+		SubjectType:  session.SubjectType,
+		User:         user,
+	}
+}
+
+// consumeRefreshToken 校验刷新令牌对应的会话，若令牌已被轮换过则视为重放并注销整个会话
+func consumeRefreshToken(claims *utils.Claims) (*models.UserSession, error) {
+	var session models.UserSession
+	if err := database.DB.Where("token_id = ?", claims.SessionID).First(&session).Error; err != nil {
+		return nil, errSessionInvalid
+	}
+
+	if session.SubjectType != claims.SubjectType || session.SubjectID != claims.SubjectID {
+		return nil, errSessionInvalid
+	}
+	if !session.IsActive(time.Now()) {
+		return nil, errSessionInvalid
+	}
+
+	if session.RefreshTokenID != claims.ID {
+		log.Printf("[Session] 检测到刷新令牌重复使用，注销会话: %d", session.SessionID)
+		revokeSession(&session, models.SessionRevokeRefreshReuse)
+		return nil, errRefreshTokenReused
+	}
+
+	return &session, nil
+}
+
+// revokeSession 注销单个会话
+func revokeSession(session *models.UserSession, reason string) error {
+	now := time.Now()
+	return database.DB.Model(&models.UserSession{}).
+		Where("session_id = ? AND revoked_at IS NULL", session.SessionID).
+		Updates(map[string]interface{}{"revoked_at": now, "revoke_reason": reason}).Error
+}
+
+// revokeSubjectSessions 注销指定用户的全部有效会话
+func revokeSubjectSessions(subjectType string, subjectID uint, reason string) error {
+	now := time.Now()
+	return database.DB.Model(&models.UserSession{}).
+		Where("subject_type = ? AND subject_id = ? AND revoked_at IS NULL", subjectType, subjectID).
+		Updates(map[string]interface{}{"revoked_at": now, "revoke_reason": reason}).Error
+}
+
+// currentSession 获取当前请求所属的会话
+func currentSession(c *gin.Context) (*models.UserSession, error) {
+	var session models.UserSession
+	if err := database.DB.Where("token_id = ?", middleware.CurrentSessionID(c)).First(&session).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// Logout 登出当前会话
+// @Summary 登出
+// @Description 注销当前会话，访问令牌和刷新令牌立即失效
+// @Tags 认证
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.Response{data=models.StandardResponse}
+// @Router /api/v1/logout [post]
+func Logout(c *gin.Context) {
+	session, err := currentSession(c)
+	if err != nil {
+		utils.Error(c, "会话不存在")
+		return
+	}
+
+	if err := revokeSession(session, models.SessionRevokeLogout); err != nil {
+		utils.Error(c, "登出失败")
+		return
+	}
+
+	utils.SuccessWithMessage(c, "登出成功", models.StandardResponse{
+		Success: true,
+		Message: "登出成功",
+	})
+}
+
+// LogoutAll 登出全部会话
+// @Summary 登出全部设备
+// @Description 注销当前用户的全部会话
+// @Tags 认证
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.Response{data=models.StandardResponse}
+// @Router /api/v1/logout-all [post]
+func LogoutAll(c *gin.Context) {
+	session, err := currentSession(c)
+	if err != nil {
+		utils.Error(c, "会话不存在")
+		return
+	}
+
+	if err := revokeSubjectSessions(session.SubjectType, session.SubjectID, models.SessionRevokeLogoutAll); err != nil {
+		utils.Error(c, "登出失败")
+		return
+	}
+
+	utils.SuccessWithMessage(c, "已登出全部设备", models.StandardResponse{
+		Success: true,
+		Message: "已登出全部设备",
+	})
+}
+
+// GetSessions 获取用户会话列表
+// @Summary 获取用户会话列表
+// @Description 管理员查看指定内部成员或客户的有效会话
+// @Tags 会话管理
+// @Accept json
+// @Produce json
+// @Param subject_type query string true "主体类型(staff/customer)"
+// @Param subject_id query int true "主体ID"
+// @Success 200 {object} models.Response{data=[]models.UserSession}
+// @Router /api/v1/sessions [get]
+func GetSessions(c *gin.Context) {
+	var req models.SessionListRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		utils.Error(c, "请求参数错误")
+		return
+	}
+
+	var sessions []models.UserSession
+	err := database.DB.
+		Where("subject_type = ? AND subject_id = ? AND revoked_at IS NULL AND expires_at > ?", req.SubjectType, req.SubjectID, time.Now()).
+		Order("last_active_at DESC").Find(&sessions).Error
+	if err != nil {
+		utils.Error(c, "查询会话失败")
+		return
+	}
+
+	utils.Success(c, sessions)
+}
+
+// RevokeSessionByID 注销指定会话
+// @Summary 注销指定会话
+// @Description 管理员强制注销某个会话
+// @Tags 会话管理
+// @Accept json
+// @Produce json
+// @Param id path int true "会话ID"
+// @Success 200 {object} models.Response{data=models.StandardResponse}
+// @Router /api/v1/sessions/{id}/revoke [post]
+func RevokeSessionByID(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		utils.Error(c, "无效的会话ID")
+		return
+	}
+
+	var session models.UserSession
+	if err := database.DB.First(&session, uint(id)).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.NotFound(c, "会话不存在")
+		} else {
+			utils.Error(c, "查询会话失败")
+		}
+		return
+	}
+
+	if err := revokeSession(&session, models.SessionRevokeAdmin); err != nil {
+		utils.Error(c, "注销会话失败")
+		return
+	}
+
+	operatorID, _ := middleware.CurrentMemberID(c)
+	logOperation(operatorID, "注销", "会话管理",
+		fmt.Sprintf("注销会话：%s/%d", session.SubjectType, session.SubjectID),
+		idStr, "会话", c.ClientIP(), c.GetHeader("User-Agent"))
+
+	utils.SuccessWithMessage(c, "注销会话成功", models.StandardResponse{
+		Success: true,
+		Message: "注销会话成功",
+	})
+}
+
+// RevokeSubjectSessions 注销指定用户的全部会话
+// @Summary 注销用户全部会话
+// @Description 管理员强制注销指定内部成员或客户的全部会话
+// @Tags 会话管理
+// @Accept json
+// @Produce json
+// @Param data body models.RevokeSubjectSessionsRequest true "用户信息"
+// @Success 200 {object} models.Response{data=models.StandardResponse}
+// @Router /api/v1/sessions/revoke-all [post]
+func RevokeSubjectSessions(c *gin.Context) {
+	var req models.RevokeSubjectSessionsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.Error(c, "请求参数错误")
+		return
+	}
+	if req.SubjectType != utils.SubjectStaff && req.SubjectType != utils.SubjectCustomer {
+		utils.Error(c, "无效的主体类型")
+		return
+	}
+
+	if err := revokeSubjectSessions(req.SubjectType, req.SubjectID, models.SessionRevokeAdmin); err != nil {
+		utils.Error(c, "注销会话失败")
+		return
+	}
+
+	operatorID, _ := middleware.CurrentMemberID(c)
+	logOperation(operatorID, "注销", "会话管理",
+		fmt.Sprintf("注销全部会话：%s/%d", req.SubjectType, req.SubjectID),
+		strconv.FormatUint(uint64(req.SubjectID), 10), req.SubjectType, c.ClientIP(), c.GetHeader("User-Agent"))
+
+	utils.SuccessWithMessage(c, "注销会话成功", models.StandardResponse{
+		Success: true,
+		Message: "注销会话成功",
+	})
+}
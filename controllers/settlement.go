@@ -0,0 +1,663 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"tangsong-esports/database"
+	"tangsong-esports/middleware"
+	"tangsong-esports/models"
+	"tangsong-esports/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// commissionRates 计算某个成员订单提成比例所需的配置
+type commissionRates struct {
+	precedence  []string
+	defaultRate *models.Decimal
+	memberRate  *models.Decimal
+	overrides   map[uint]models.Decimal // 订单类别ID -> 单独设置的比例
+}
+
+// loadCommissionRates 读取提成比例取值顺序、默认比例、成员比例和成员的单独设置
+func loadCommissionRates(tx *gorm.DB, memberID uint) (*commissionRates, error) {
+	rates := &commissionRates{overrides: make(map[uint]models.Decimal)}
+
+	values := map[string]string{}
+	var configs []models.SystemConfig
+	tx.Where("config_key IN ? AND is_active = ?", []string{"commission_rate_precedence", "default_commission_rate"}, true).Find(&configs)
+	for _, cfg := range configs {
+		values[cfg.ConfigKey] = cfg.ConfigValue
+	}
+	rates.precedence = models.ParseCommissionPrecedence(values["commission_rate_precedence"])
+	if rate, err := models.ParseDecimal(values["default_commission_rate"]); err == nil && values["default_commission_rate"] != "" {
+		rates.defaultRate = &rate
+	}
+
+	var settings models.MemberFinancialSettings
+	if err := tx.Where("member_id = ?", memberID).First(&settings).Error; err == nil {
+		if settings.CommissionRate.IsPositive() {
+			rates.memberRate = &settings.CommissionRate
+		}
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	var overrides []models.CommissionOverride
+	if err := tx.Where("member_id = ?", memberID).Find(&overrides).Error; err != nil {
+		return nil, err
+	}
+	for _, override := range overrides {
+		rates.overrides[override.OrderCategoryID] = override.CommissionRate
+	}
+	return rates, nil
+}
+
+// resolve 按取值顺序得到订单的提成比例和来源，类别比例为 0 视为未设置
+func (r *commissionRates) resolve(order *models.PlaymateOrder) (models.Decimal, string, bool) {
+	candidates := make(map[string]models.Decimal)
+	if rate, ok := r.overrides[order.OrderCategoryID]; ok {
+		candidates[models.CommissionSourceOverride] = rate
+	}
+	if r.memberRate != nil {
+		candidates[models.CommissionSourceMember] = *r.memberRate
+	}
+	if order.Category != nil && order.Category.CommissionRate.IsPositive() {
+		candidates[models.CommissionSourceCategory] = order.Category.CommissionRate
+	}
+	if r.defaultRate != nil {
+		candidates[models.CommissionSourceDefault] = *r.defaultRate
+	}
+	return models.ResolveCommissionRate(r.precedence, candidates)
+}
+
+// commissionLine 统计佣金时每个订单需要的字段
+type commissionLine struct {
+	OrderID         uint
+	ReporterID      uint
+	OrderCategoryID uint
+	FinalPrice      models.Money
+}
+
+// sumOrderCommission 逐单计算订单提成合计，已结算的订单取结算明细中的提成金额
+func sumOrderCommission(db *gorm.DB, lines []commissionLine) (models.Money, error) {
+	if len(lines) == 0 {
+		return 0, nil
+	}
+
+	orderIDs := make([]uint, 0, len(lines))
+	for _, line := range lines {
+		orderIDs = append(orderIDs, line.OrderID)
+	}
+	settled := make(map[uint]models.Money)
+	var items []models.SettlementItem
+	if err := db.Where("order_id IN ?", orderIDs).Find(&items).Error; err != nil {
+		return 0, err
+	}
+	for _, item := range items {
+		settled[item.OrderID] = item.CommissionAmount
+	}
+
+	categories := make(map[uint]*models.OrderCategory)
+	var categoryList []models.OrderCategory
+	if err := db.Find(&categoryList).Error; err != nil {
+		return 0, err
+	}
+	for i := range categoryList {
+		categories[categoryList[i].CategoryID] = &categoryList[i]
+	}
+
+	rounding := moneyRounding()
+	memberRates := make(map[uint]*commissionRates)
+	var total models.Money
+	for _, line := range lines {
+		if amount, ok := settled[line.OrderID]; ok {
+			total += amount
+			continue
+		}
+		rates, ok := memberRates[line.ReporterID]
+		if !ok {
+			var err error
+			if rates, err = loadCommissionRates(db, line.ReporterID); err != nil {
+				return 0, err
+			}
+			memberRates[line.ReporterID] = rates
+		}
+		order := models.PlaymateOrder{OrderCategoryID: line.OrderCategoryID, Category: categories[line.OrderCategoryID]}
+		if rate, _, ok := rates.resolve(&order); ok {
+			total += line.FinalPrice.Mul(rate, rounding)
+		}
+	}
+	return total, nil
+}
+
+// lockSettlementBatch 加行锁读取结算单
+func lockSettlementBatch(tx *gorm.DB, batchID uint) (*models.SettlementBatch, error) {
+	var batch models.SettlementBatch
+	if err := forUpdate(tx).First(&batch, batchID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, newOrderStateError(models.StatusNotFound, "结算单不存在")
+		}
+		return nil, err
+	}
+	return &batch, nil
+}
+
+// parseSettlementDate 解析 YYYY-MM-DD 格式的结算日期
+func parseSettlementDate(value string) (time.Time, error) {
+	return time.ParseInLocation("2006-01-02", value, time.Local)
+}
+
+// loadSettlementStatement 查询完整的结算单
+func loadSettlementStatement(batchID uint) (*models.SettlementBatch, error) {
+	var batch models.SettlementBatch
+	err := database.DB.Preload("Member").Preload("Creator").
+		Preload("Items", func(db *gorm.DB) *gorm.DB { return db.Order("order_id") }).
+		Preload("Items.Order.Category").
+		Preload("Adjustments.Operator").
+		First(&batch, batchID).Error
+	return &batch, err
+}
+
+// CreateSettlement 创建提成结算单
+// @Summary 创建提成结算单
+// @Description 汇总成员在结算周期内审批通过的已确认订单，按提成比例取值顺序计算提成，并将订单变更为已结算
+// @Tags 提成结算
+// @Accept json
+// @Produce json
+// @Param data body models.SettlementCreateRequest true "结算信息"
+// @Success 200 {object} models.Response{data=models.SettlementBatch}
+// @Router /api/v1/settlements [post]
+func CreateSettlement(c *gin.Context) {
+	var req models.SettlementCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.Error(c, "请求参数错误")
+		return
+	}
+	periodStart, err := parseSettlementDate(req.PeriodStart)
+	if err != nil {
+		utils.Error(c, "无效的结算开始日期")
+		return
+	}
+	periodEnd, err := parseSettlementDate(req.PeriodEnd)
+	if err != nil || periodEnd.Before(periodStart) {
+		utils.Error(c, "无效的结算结束日期")
+		return
+	}
+
+	var member models.InternalMember
+	if err := database.DB.First(&member, req.MemberID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.NotFound(c, "成员不存在")
+		} else {
+			utils.Error(c, "查询成员失败")
+		}
+		return
+	}
+
+	operator, ok := currentMember(c)
+	if !ok {
+		return
+	}
+
+	batch := models.SettlementBatch{
+		MemberID:    member.MemberID,
+		PeriodStart: periodStart,
+		PeriodEnd:   periodEnd,
+		Status:      models.SettlementStatusUnpaid,
+		CreatorID:   operator.MemberID,
+		Notes:       req.Notes,
+	}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var orders []models.PlaymateOrder
+		if err := tx.Joins("JOIN order_workflow ON playmate_orders.order_id = order_workflow.order_id").
+			Where("playmate_orders.reporter_id = ? AND order_workflow.order_status = ?", member.MemberID, models.OrderStatusConfirmed).
+			Where("DATE(order_workflow.approval_time) BETWEEN ? AND ?", req.PeriodStart, req.PeriodEnd).
+			Preload("Pricing").Preload("Category").
+			Order("playmate_orders.order_id").Find(&orders).Error; err != nil {
+			return err
+		}
+		if len(orders) == 0 {
+			return newOrderStateError(models.StatusError, "该结算周期内没有可结算的订单")
+		}
+
+		rates, err := loadCommissionRates(tx, member.MemberID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Create(&batch).Error; err != nil {
+			return err
+		}
+
+		rounding := moneyRounding()
+		for i := range orders {
+			order := &orders[i]
+			if order.Pricing == nil {
+				return newOrderStateError(models.StatusError, "订单%d价格信息不存在", order.OrderID)
+			}
+			rate, source, ok := rates.resolve(order)
+			if !ok {
+				return newOrderStateError(models.StatusError, "订单%d未设置提成比例", order.OrderID)
+			}
+
+			if _, err := transitionOrder(tx, orderTransitionInput{
+				OrderID:  order.OrderID,
+				ToStatus: models.OrderStatusSettled,
+				Operator: operator,
+				Notes:    fmt.Sprintf("提成结算单%d", batch.BatchID),
+			}); err != nil {
+				return err
+			}
+
+			item := models.SettlementItem{
+				BatchID:          batch.BatchID,
+				OrderID:          order.OrderID,
+				OrderAmount:      order.Pricing.FinalPrice,
+				CommissionRate:   rate,
+				RateSource:       source,
+				CommissionAmount: order.Pricing.FinalPrice.Mul(rate, rounding),
+			}
+			if err := tx.Create(&item).Error; err != nil {
+				return err
+			}
+			batch.OrderCount++
+			batch.TotalOrderAmount += item.OrderAmount
+			batch.TotalCommission += item.CommissionAmount
+		}
+
+		batch.PayableAmount = batch.TotalCommission + batch.AdjustmentAmount
+		return tx.Save(&batch).Error
+	})
+	if err != nil {
+		respondOrderStateError(c, err, "创建结算单失败")
+		return
+	}
+
+	logOperation(operator.MemberID, "创建", "提成结算",
+		fmt.Sprintf("创建结算单%d：成员%s，%s至%s，%d个订单，提成%s元", batch.BatchID, member.Name,
+			req.PeriodStart, req.PeriodEnd, batch.OrderCount, batch.TotalCommission),
+		strconv.FormatUint(uint64(batch.BatchID), 10), "结算单", c.ClientIP(), c.GetHeader("User-Agent"))
+
+	statement, _ := loadSettlementStatement(batch.BatchID)
+	utils.SuccessWithMessage(c, "创建结算单成功", statement)
+}
+
+// querySettlements 分页查询结算单，memberID 不为 0 时只查该成员
+func querySettlements(c *gin.Context, memberID uint) {
+	var req models.SettlementFilterRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		utils.Error(c, "请求参数错误")
+		return
+	}
+
+	// 设置默认值
+	if req.Page <= 0 {
+		req.Page = 1
+	}
+	if req.PageSize <= 0 {
+		req.PageSize = 10
+	}
+	if memberID != 0 {
+		req.MemberID = memberID
+	}
+
+	query := database.DB.Model(&models.SettlementBatch{})
+	if req.MemberID > 0 {
+		query = query.Where("member_id = ?", req.MemberID)
+	}
+	if req.Status != "" {
+		query = query.Where("status = ?", req.Status)
+	}
+
+	// 计算总数
+	var total int64
+	query.Count(&total)
+
+	// 分页查询
+	var batches []models.SettlementBatch
+	offset := (req.Page - 1) * req.PageSize
+	if err := query.Preload("Member").Order("batch_id DESC").
+		Offset(offset).Limit(req.PageSize).Find(&batches).Error; err != nil {
+		utils.Error(c, "查询失败")
+		return
+	}
+
+	utils.Success(c, models.PageResponse{
+		List:     batches,
+		Total:    total,
+		Page:     req.Page,
+		PageSize: req.PageSize,
+	})
+}
+
+// GetSettlements 获取结算单列表
+// @Summary 获取结算单列表
+// @Description 分页获取提成结算单，可按成员和支付状态筛选
+// @Tags 提成结算
+// @Accept json
+// @Produce json
+// @Param page query int false "页码" default(1)
+// @Param page_size query int false "每页数量" default(10)
+// @Param member_id query int false "成员ID"
+// @Param status query string false "支付状态" Enums(未支付,已支付)
+// @Success 200 {object} models.Response{data=models.PageResponse}
+// @Router /api/v1/settlements [get]
+func GetSettlements(c *gin.Context) {
+	querySettlements(c, 0)
+}
+
+// GetMySettlements 获取当前成员的结算单
+// @Summary 获取我的结算单
+// @Description 分页获取当前登录成员的提成结算单
+// @Tags 提成结算
+// @Accept json
+// @Produce json
+// @Param page query int false "页码" default(1)
+// @Param page_size query int false "每页数量" default(10)
+// @Param status query string false "支付状态" Enums(未支付,已支付)
+// @Success 200 {object} models.Response{data=models.PageResponse}
+// @Router /api/v1/settlements/mine [get]
+func GetMySettlements(c *gin.Context) {
+	memberID, exists := middleware.CurrentMemberID(c)
+	if !exists {
+		utils.Error(c, "未找到用户信息")
+		return
+	}
+	querySettlements(c, memberID)
+}
+
+// GetSettlementByID 获取结算单详情
+// @Summary 获取结算单详情
+// @Description 获取结算单及其订单明细和调整项；成员可以查看自己的结算单
+// @Tags 提成结算
+// @Accept json
+// @Produce json
+// @Param id path int true "结算单ID"
+// @Success 200 {object} models.Response{data=models.SettlementBatch}
+// @Router /api/v1/settlements/{id} [get]
+func GetSettlementByID(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.Error(c, "无效的结算单ID")
+		return
+	}
+
+	statement, err := loadSettlementStatement(uint(id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.NotFound(c, "结算单不存在")
+		} else {
+			utils.Error(c, "查询失败")
+		}
+		return
+	}
+
+	memberID, _ := middleware.CurrentMemberID(c)
+	if statement.MemberID != memberID && !middleware.HasPermission(c, models.PermSettlementManage) {
+		utils.Forbidden(c, "无权查看该结算单")
+		return
+	}
+
+	utils.Success(c, statement)
+}
+
+// AddSettlementAdjustment 添加结算单调整项
+// @Summary 添加结算单调整项
+// @Description 为未支付的结算单添加补发（正数）或扣款（负数），应付金额随之变化
+// @Tags 提成结算
+// @Accept json
+// @Produce json
+// @Param id path int true "结算单ID"
+// @Param data body models.SettlementAdjustmentRequest true "调整信息"
+// @Success 200 {object} models.Response{data=models.SettlementBatch}
+// @Router /api/v1/settlements/{id}/adjustments [post]
+func AddSettlementAdjustment(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.Error(c, "无效的结算单ID")
+		return
+	}
+
+	var req models.SettlementAdjustmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.Error(c, "请求参数错误")
+		return
+	}
+
+	operatorID, exists := middleware.CurrentMemberID(c)
+	if !exists {
+		utils.Error(c, "未找到操作员信息")
+		return
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		batch, err := lockSettlementBatch(tx, uint(id))
+		if err != nil {
+			return err
+		}
+		if batch.Status != models.SettlementStatusUnpaid {
+			return newOrderStateError(models.StatusConflict, "结算单已支付，不能调整")
+		}
+		if batch.PayableAmount+req.Amount < 0 {
+			return newOrderStateError(models.StatusError, "扣款后应付金额不能为负数")
+		}
+
+		adjustment := models.SettlementAdjustment{
+			BatchID:    batch.BatchID,
+			Amount:     req.Amount,
+			Reason:     req.Reason,
+			OperatorID: operatorID,
+		}
+		if err := tx.Create(&adjustment).Error; err != nil {
+			return err
+		}
+		batch.AdjustmentAmount += req.Amount
+		batch.PayableAmount = batch.TotalCommission + batch.AdjustmentAmount
+		return tx.Save(batch).Error
+	})
+	if err != nil {
+		respondOrderStateError(c, err, "添加调整项失败")
+		return
+	}
+
+	logOperation(operatorID, "调整", "提成结算", fmt.Sprintf("结算单%d调整%s元，原因：%s", id, req.Amount, req.Reason),
+		strconv.FormatUint(id, 10), "结算单", c.ClientIP(), c.GetHeader("User-Agent"))
+
+	statement, _ := loadSettlementStatement(uint(id))
+	utils.SuccessWithMessage(c, "添加调整项成功", statement)
+}
+
+// PaySettlement 结算单付款
+// @Summary 结算单付款
+// @Description 登记结算单的付款流水号并标记为已支付，结算单中的订单变更为已完成
+// @Tags 提成结算
+// @Accept json
+// @Produce json
+// @Param id path int true "结算单ID"
+// @Param data body models.SettlementPayRequest true "付款信息"
+// @Success 200 {object} models.Response{data=models.SettlementBatch}
+// @Router /api/v1/settlements/{id}/pay [post]
+func PaySettlement(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.Error(c, "无效的结算单ID")
+		return
+	}
+
+	var req models.SettlementPayRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.Error(c, "请求参数错误")
+		return
+	}
+
+	operator, ok := currentMember(c)
+	if !ok {
+		return
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		batch, err := lockSettlementBatch(tx, uint(id))
+		if err != nil {
+			return err
+		}
+		if batch.Status != models.SettlementStatusUnpaid {
+			return newOrderStateError(models.StatusConflict, "结算单已支付")
+		}
+
+		var items []models.SettlementItem
+		if err := tx.Where("batch_id = ?", batch.BatchID).Order("order_id").Find(&items).Error; err != nil {
+			return err
+		}
+		for _, item := range items {
+			if _, err := transitionOrder(tx, orderTransitionInput{
+				OrderID:  item.OrderID,
+				ToStatus: models.OrderStatusCompleted,
+				Operator: operator,
+				Notes:    fmt.Sprintf("提成结算单%d已付款", batch.BatchID),
+			}); err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+		batch.Status = models.SettlementStatusPaid
+		batch.PaymentReference = req.PaymentReference
+		batch.PaidAt = &now
+		batch.PaidBy = &operator.MemberID
+		if req.Notes != "" {
+			batch.Notes = req.Notes
+		}
+		return tx.Save(batch).Error
+	})
+	if err != nil {
+		respondOrderStateError(c, err, "结算单付款失败")
+		return
+	}
+
+	logOperation(operator.MemberID, "付款", "提成结算", fmt.Sprintf("结算单%d已付款，流水号：%s", id, req.PaymentReference),
+		strconv.FormatUint(id, 10), "结算单", c.ClientIP(), c.GetHeader("User-Agent"))
+
+	statement, _ := loadSettlementStatement(uint(id))
+	utils.SuccessWithMessage(c, "付款登记成功", statement)
+}
+
+// GetCommissionOverrides 获取提成比例单独设置
+// @Summary 获取提成比例单独设置
+// @Description 获取成员在订单类别上单独设置的提成比例
+// @Tags 提成结算
+// @Accept json
+// @Produce json
+// @Param member_id query int false "成员ID"
+// @Success 200 {object} models.Response{data=[]models.CommissionOverride}
+// @Router /api/v1/settlements/commission-overrides [get]
+func GetCommissionOverrides(c *gin.Context) {
+	query := database.DB.Model(&models.CommissionOverride{})
+	if memberID := c.Query("member_id"); memberID != "" {
+		query = query.Where("member_id = ?", memberID)
+	}
+
+	var overrides []models.CommissionOverride
+	if err := query.Preload("Member").Preload("Category").Order("member_id, order_category_id").Find(&overrides).Error; err != nil {
+		utils.Error(c, "查询失败")
+		return
+	}
+	utils.Success(c, overrides)
+}
+
+// SaveCommissionOverride 设置成员在订单类别上的提成比例
+// @Summary 设置提成比例
+// @Description 设置成员在某个订单类别上的提成比例，已存在时覆盖
+// @Tags 提成结算
+// @Accept json
+// @Produce json
+// @Param data body models.CommissionOverrideRequest true "提成比例"
+// @Success 200 {object} models.Response{data=models.CommissionOverride}
+// @Failure 404 {object} models.Response "成员或订单类别不存在或未启用"
+// @Router /api/v1/settlements/commission-overrides [post]
+func SaveCommissionOverride(c *gin.Context) {
+	var req models.CommissionOverrideRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.Error(c, "请求参数错误")
+		return
+	}
+	if req.CommissionRate < 0 || req.CommissionRate > models.DecimalFromFloat(1) {
+		utils.Error(c, "提成比例必须在0到1之间")
+		return
+	}
+
+	// 成员和类别必须存在且处于启用状态，避免保存永远匹配不到的设置
+	var member models.InternalMember
+	if err := database.DB.Where("status = ? AND is_enabled = ?", "正常", true).First(&member, req.MemberID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.NotFound(c, "成员不存在或未启用")
+		} else {
+			utils.Error(c, "查询失败")
+		}
+		return
+	}
+	var category models.OrderCategory
+	if err := database.DB.Where("is_active = ?", true).First(&category, req.OrderCategoryID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.NotFound(c, "订单类别不存在或未启用")
+		} else {
+			utils.Error(c, "查询失败")
+		}
+		return
+	}
+
+	var override models.CommissionOverride
+	err := database.DB.Unscoped().
+		Where("member_id = ? AND order_category_id = ?", req.MemberID, req.OrderCategoryID).
+		First(&override).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		utils.Error(c, "查询失败")
+		return
+	}
+	override.MemberID = req.MemberID
+	override.OrderCategoryID = req.OrderCategoryID
+	override.CommissionRate = req.CommissionRate
+	override.Notes = req.Notes
+	override.DeletedAt = gorm.DeletedAt{}
+	if err := database.DB.Unscoped().Save(&override).Error; err != nil {
+		utils.Error(c, "保存失败")
+		return
+	}
+
+	operatorID, _ := middleware.CurrentMemberID(c)
+	logOperation(operatorID, "更新", "提成结算",
+		fmt.Sprintf("设置成员%d在类别%d的提成比例为%s", req.MemberID, req.OrderCategoryID, req.CommissionRate),
+		strconv.FormatUint(uint64(override.OverrideID), 10), "提成比例", c.ClientIP(), c.GetHeader("User-Agent"))
+
+	utils.SuccessWithMessage(c, "保存成功", override)
+}
+
+// DeleteCommissionOverride 删除提成比例单独设置
+// @Summary 删除提成比例单独设置
+// @Description 删除后该成员在此类别上按其余规则取提成比例
+// @Tags 提成结算
+// @Accept json
+// @Produce json
+// @Param id path int true "设置ID"
+// @Success 200 {object} models.Response
+// @Router /api/v1/settlements/commission-overrides/{id} [delete]
+func DeleteCommissionOverride(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.Error(c, "无效的设置ID")
+		return
+	}
+
+	result := database.DB.Delete(&models.CommissionOverride{}, uint(id))
+	if result.Error != nil {
+		utils.Error(c, "删除失败")
+		return
+	}
+	if result.RowsAffected == 0 {
+		utils.NotFound(c, "设置不存在")
+		return
+	}
+	utils.SuccessWithMessage(c, "删除成功", nil)
+}
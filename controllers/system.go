@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"tangsong-esports/database"
+	"tangsong-esports/middleware"
 	"tangsong-esports/models"
 	"tangsong-esports/utils"
 
@@ -99,8 +100,8 @@ func UpdateConfig(c *gin.Context) {
 	}
 
 	// 记录操作日志
-	operatorID, _ := c.Get("member_id")
-	logOperation(operatorID.(uint), "更新", "系统配置", "更新系统配置："+configKey, configKey, "系统配置", c.ClientIP(), c.GetHeader("User-Agent"))
+	operatorID, _ := middleware.CurrentMemberID(c)
+	logOperation(operatorID, "更新", "系统配置", "更新系统配置："+configKey, configKey, "系统配置", c.ClientIP(), c.GetHeader("User-Agent"))
 
 	utils.SuccessWithMessage(c, "更新配置成功", config)
 }
@@ -0,0 +1,522 @@
+package controllers
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"tangsong-esports/database"
+	"tangsong-esports/middleware"
+	"tangsong-esports/models"
+	"tangsong-esports/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 身份验证器中显示的发行方名称
+const totpIssuer = "唐宋电竞"
+
+// 每次生成的恢复码数量
+const recoveryCodeCount = 10
+
+// twoFactorRequired 检查角色是否被要求启用两步验证
+func twoFactorRequired(role string) bool {
+	var cfg models.SystemConfig
+	if err := database.DB.Where("config_key = ? AND is_active = ?", "two_factor_required_roles", true).First(&cfg).Error; err != nil {
+		return false
+	}
+	for _, item := range strings.Split(cfg.ConfigValue, ",") {
+		if strings.TrimSpace(item) == role {
+			return true
+		}
+	}
+	return false
+}
+
+// respondTwoFactorChallenge 密码验证通过后返回两步验证登录挑战
+func respondTwoFactorChallenge(c *gin.Context, member *models.InternalMember) {
+	token, err := utils.GenerateChallengeToken(utils.TokenTypeChallenge, utils.SubjectStaff, member.MemberID, member.Account, member.UserRole)
+	if err != nil {
+		log.Printf("[Login] 生成登录挑战失败: %v", err)
+		utils.Error(c, "生成令牌失败")
+		return
+	}
+
+	utils.SuccessWithMessage(c, "请完成两步验证", models.TwoFactorChallengeResponse{
+		TwoFactorRequired: true,
+		SetupRequired:     !member.TOTPEnabled,
+		ChallengeToken:    token,
+		ExpiresIn:         int64(utils.ChallengeTokenTTL.Seconds()),
+	})
+}
+
+// challengeMember 解析登录挑战令牌并加载成员，失败时已写入响应
+func challengeMember(c *gin.Context, challengeToken, tokenType string) (*models.InternalMember, bool) {
+	claims, err := utils.ParseChallengeToken(challengeToken, tokenType)
+	if err != nil || claims.SubjectType != utils.SubjectStaff {
+		utils.Unauthorized(c, "登录挑战无效或已过期，请重新登录")
+		return nil, false
+	}
+
+	var member models.InternalMember
+	if err := database.DB.First(&member, claims.SubjectID).Error; err != nil {
+		utils.Unauthorized(c, "用户不存在")
+		return nil, false
+	}
+	if member.Status != "正常" || !member.IsEnabled {
+		utils.Unauthorized(c, "账户已被禁用")
+		return nil, false
+	}
+	return &member, true
+}
+
+// verifyTOTP 校验验证码并推进计数器，同一验证码只能使用一次
+func verifyTOTP(member *models.InternalMember, code string) bool {
+	counter, ok := utils.ValidateTOTP(member.TOTPSecret, strings.TrimSpace(code), time.Now(), member.TOTPLastCounter)
+	if !ok {
+		return false
+	}
+
+	// 条件更新防止并发请求重复使用同一验证码
+	result := database.DB.Model(&models.InternalMember{}).
+		Where("member_id = ? AND totp_last_counter < ?", member.MemberID, counter).
+		Update("totp_last_counter", counter)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false
+	}
+	member.TOTPLastCounter = counter
+	return true
+}
+
+// consumeRecoveryCode 使用一个恢复码
+func consumeRecoveryCode(memberID uint, code string) bool {
+	result := database.DB.Model(&models.MemberRecoveryCode{}).
+		Where("member_id = ? AND code_hash = ? AND used_at IS NULL", memberID, utils.HashOneTimeCode(code)).
+		Update("used_at", time.Now())
+	return result.Error == nil && result.RowsAffected == 1
+}
+
+// replaceRecoveryCodes 作废旧恢复码并生成新的一组
+func replaceRecoveryCodes(tx *gorm.DB, memberID uint) ([]string, error) {
+	codes, err := utils.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Where("member_id = ?", memberID).Delete(&models.MemberRecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	records := make([]models.MemberRecoveryCode, 0, len(codes))
+	for _, code := range codes {
+		records = append(records, models.MemberRecoveryCode{
+			MemberID: memberID,
+			CodeHash: utils.HashOneTimeCode(code),
+		})
+	}
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// enableTwoFactor 启用两步验证并生成恢复码
+func enableTwoFactor(member *models.InternalMember) ([]string, error) {
+	var codes []string
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(member).Update("totp_enabled", true).Error; err != nil {
+			return err
+		}
+		var err error
+		codes, err = replaceRecoveryCodes(tx, member.MemberID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	member.TOTPEnabled = true
+	return codes, nil
+}
+
+// clearTwoFactor 清除两步验证配置和恢复码
+func clearTwoFactor(memberID uint) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		updates := map[string]interface{}{
+			"totp_secret":       "",
+			"totp_enabled":      false,
+			"totp_last_counter": 0,
+		}
+		if err := tx.Model(&models.InternalMember{}).Where("member_id = ?", memberID).Updates(updates).Error; err != nil {
+			return err
+		}
+		return tx.Where("member_id = ?", memberID).Delete(&models.MemberRecoveryCode{}).Error
+	})
+}
+
+// newTOTPSecret 为成员生成待确认的密钥
+func newTOTPSecret(member *models.InternalMember) (*models.TwoFactorSetupResponse, error) {
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	updates := map[string]interface{}{
+		"totp_secret":       secret,
+		"totp_last_counter": 0,
+	}
+	if err := database.DB.Model(member).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+
+	return &models.TwoFactorSetupResponse{
+		Secret:          secret,
+		ProvisioningURI: utils.TOTPProvisioningURI(totpIssuer, member.Account, secret),
+	}, nil
+}
+
+// LoginTwoFactorSetup 登录时绑定两步验证
+// @Summary 登录时绑定两步验证
+// @Description 角色要求两步验证但尚未绑定时，使用登录挑战令牌获取绑定密钥
+// @Tags 认证
+// @Accept json
+// @Produce json
+// @Param data body models.TwoFactorChallengeRequest true "登录挑战"
+// @Success 200 {object} models.Response{data=models.TwoFactorSetupResponse}
+// @Router /api/v1/login/2fa/setup [post]
+func LoginTwoFactorSetup(c *gin.Context) {
+	var req models.TwoFactorChallengeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.Error(c, "请求参数错误")
+		return
+	}
+
+	member, ok := challengeMember(c, req.ChallengeToken, utils.TokenTypeChallenge)
+	if !ok {
+		return
+	}
+	if member.TOTPEnabled {
+		utils.Error(c, "已启用两步验证")
+		return
+	}
+
+	setup, err := newTOTPSecret(member)
+	if err != nil {
+		utils.Error(c, "生成密钥失败")
+		return
+	}
+
+	utils.Success(c, setup)
+}
+
+// LoginTwoFactor 两步验证登录
+// @Summary 两步验证登录
+// @Description 使用登录挑战令牌和验证码（或恢复码）完成登录；首次绑定时同时启用两步验证并返回恢复码
+// @Tags 认证
+// @Accept json
+// @Produce json
+// @Param data body models.TwoFactorLoginRequest true "两步验证信息"
+// @Success 200 {object} models.Response{data=models.AuthTokenResponse}
+// @Router /api/v1/login/2fa [post]
+func LoginTwoFactor(c *gin.Context) {
+	var req models.TwoFactorLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.Error(c, "请求参数错误")
+		return
+	}
+	if req.Code == "" && req.RecoveryCode == "" {
+		utils.Error(c, "请输入验证码或恢复码")
+		return
+	}
+
+	member, ok := challengeMember(c, req.ChallengeToken, utils.TokenTypeChallenge)
+	if !ok {
+		return
+	}
+
+	if remaining := loginLockedFor(utils.SubjectStaff, member.Account, c.ClientIP()); remaining > 0 {
+		utils.TooManyRequests(c, loginLockedMessage(remaining))
+		return
+	}
+
+	if member.TOTPSecret == "" {
+		utils.Error(c, "请先绑定两步验证")
+		return
+	}
+
+	var verified bool
+	if req.Code != "" {
+		verified = verifyTOTP(member, req.Code)
+	} else if member.TOTPEnabled {
+		verified = consumeRecoveryCode(member.MemberID, req.RecoveryCode)
+	}
+	if !verified {
+		recordMemberLogin(c, member.MemberID, models.LoginStatusFailed, models.LoginFailTwoFactor)
+		loginFailed(c, utils.SubjectStaff, member.Account, "验证码错误")
+		return
+	}
+
+	// 首次绑定，验证通过后启用
+	var recoveryCodes []string
+	if !member.TOTPEnabled {
+		codes, err := enableTwoFactor(member)
+		if err != nil {
+			log.Printf("[LoginTwoFactor] 启用两步验证失败: %v", err)
+			utils.Error(c, "启用两步验证失败")
+			return
+		}
+		recoveryCodes = codes
+	}
+
+	completeStaffLogin(c, member, recoveryCodes)
+}
+
+// currentMember 加载当前登录的内部成员
+func currentMember(c *gin.Context) (*models.InternalMember, bool) {
+	memberID, exists := middleware.CurrentMemberID(c)
+	if !exists {
+		utils.Unauthorized(c, "未找到用户信息")
+		return nil, false
+	}
+
+	var member models.InternalMember
+	if err := database.DB.First(&member, memberID).Error; err != nil {
+		utils.NotFound(c, "用户不存在")
+		return nil, false
+	}
+	return &member, true
+}
+
+// GetTwoFactorStatus 获取两步验证状态
+// @Summary 获取两步验证状态
+// @Description 获取当前成员的两步验证启用情况和剩余恢复码数量
+// @Tags 两步验证
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.Response{data=models.TwoFactorStatusResponse}
+// @Router /api/v1/2fa [get]
+func GetTwoFactorStatus(c *gin.Context) {
+	member, ok := currentMember(c)
+	if !ok {
+		return
+	}
+
+	var remaining int64
+	database.DB.Model(&models.MemberRecoveryCode{}).
+		Where("member_id = ? AND used_at IS NULL", member.MemberID).Count(&remaining)
+
+	utils.Success(c, models.TwoFactorStatusResponse{
+		Enabled:                member.TOTPEnabled,
+		Required:               twoFactorRequired(member.UserRole),
+		RecoveryCodesRemaining: remaining,
+	})
+}
+
+// SetupTwoFactor 生成两步验证密钥
+// @Summary 生成两步验证密钥
+// @Description 生成新的TOTP密钥和二维码URI，需调用启用接口确认后生效
+// @Tags 两步验证
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.Response{data=models.TwoFactorSetupResponse}
+// @Router /api/v1/2fa/setup [post]
+func SetupTwoFactor(c *gin.Context) {
+	member, ok := currentMember(c)
+	if !ok {
+		return
+	}
+	if member.TOTPEnabled {
+		utils.Error(c, "已启用两步验证，如需更换请先关闭")
+		return
+	}
+
+	setup, err := newTOTPSecret(member)
+	if err != nil {
+		utils.Error(c, "生成密钥失败")
+		return
+	}
+
+	utils.Success(c, setup)
+}
+
+// EnableTwoFactor 启用两步验证
+// @Summary 启用两步验证
+// @Description 提交身份验证器上的验证码确认绑定，成功后返回恢复码（仅显示一次）
+// @Tags 两步验证
+// @Accept json
+// @Produce json
+// @Param data body models.TwoFactorCodeRequest true "验证码"
+// @Success 200 {object} models.Response{data=models.RecoveryCodesResponse}
+// @Router /api/v1/2fa/enable [post]
+func EnableTwoFactor(c *gin.Context) {
+	var req models.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.Error(c, "请求参数错误")
+		return
+	}
+
+	member, ok := currentMember(c)
+	if !ok {
+		return
+	}
+	if member.TOTPEnabled {
+		utils.Error(c, "已启用两步验证")
+		return
+	}
+	if member.TOTPSecret == "" {
+		utils.Error(c, "请先生成两步验证密钥")
+		return
+	}
+	if !verifyTOTP(member, req.Code) {
+		utils.Error(c, "验证码错误")
+		return
+	}
+
+	codes, err := enableTwoFactor(member)
+	if err != nil {
+		utils.Error(c, "启用两步验证失败")
+		return
+	}
+
+	logOperation(member.MemberID, "启用", "两步验证", "启用两步验证："+member.Account,
+		strconv.FormatUint(uint64(member.MemberID), 10), "内部成员", c.ClientIP(), c.GetHeader("User-Agent"))
+
+	utils.SuccessWithMessage(c, "两步验证已启用", models.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// DisableTwoFactor 关闭两步验证
+// @Summary 关闭两步验证
+// @Description 验证密码和验证码后关闭两步验证，角色要求两步验证时不可关闭
+// @Tags 两步验证
+// @Accept json
+// @Produce json
+// @Param data body models.TwoFactorDisableRequest true "验证信息"
+// @Success 200 {object} models.Response{data=models.StandardResponse}
+// @Router /api/v1/2fa/disable [post]
+func DisableTwoFactor(c *gin.Context) {
+	var req models.TwoFactorDisableRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.Error(c, "请求参数错误")
+		return
+	}
+
+	member, ok := currentMember(c)
+	if !ok {
+		return
+	}
+	if !member.TOTPEnabled {
+		utils.Error(c, "未启用两步验证")
+		return
+	}
+	if twoFactorRequired(member.UserRole) {
+		utils.Forbidden(c, "当前角色必须启用两步验证")
+		return
+	}
+	if !utils.CheckPassword(req.Password, member.PasswordHash) {
+		utils.Error(c, "密码错误")
+		return
+	}
+	if !verifyTOTP(member, req.Code) {
+		utils.Error(c, "验证码错误")
+		return
+	}
+
+	if err := clearTwoFactor(member.MemberID); err != nil {
+		utils.Error(c, "关闭两步验证失败")
+		return
+	}
+
+	logOperation(member.MemberID, "关闭", "两步验证", "关闭两步验证："+member.Account,
+		strconv.FormatUint(uint64(member.MemberID), 10), "内部成员", c.ClientIP(), c.GetHeader("User-Agent"))
+
+	utils.SuccessWithMessage(c, "两步验证已关闭", models.StandardResponse{
+		Success: true,
+		Message: "两步验证已关闭",
+	})
+}
+
+// RegenerateRecoveryCodes 重新生成恢复码
+// @Summary 重新生成恢复码
+// @Description 验证验证码后生成新的恢复码，旧恢复码全部作废
+// @Tags 两步验证
+// @Accept json
+// @Produce json
+// @Param data body models.TwoFactorCodeRequest true "验证码"
+// @Success 200 {object} models.Response{data=models.RecoveryCodesResponse}
+// @Router /api/v1/2fa/recovery-codes [post]
+func RegenerateRecoveryCodes(c *gin.Context) {
+	var req models.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.Error(c, "请求参数错误")
+		return
+	}
+
+	member, ok := currentMember(c)
+	if !ok {
+		return
+	}
+	if !member.TOTPEnabled {
+		utils.Error(c, "未启用两步验证")
+		return
+	}
+	if !verifyTOTP(member, req.Code) {
+		utils.Error(c, "验证码错误")
+		return
+	}
+
+	var codes []string
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = replaceRecoveryCodes(tx, member.MemberID)
+		return err
+	})
+	if err != nil {
+		utils.Error(c, "生成恢复码失败")
+		return
+	}
+
+	utils.SuccessWithMessage(c, "恢复码已重新生成", models.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// ResetMemberTwoFactor 重置成员两步验证
+// @Summary 重置成员两步验证
+// @Description 成员丢失身份验证器和恢复码时，由管理员清除其两步验证配置并注销全部会话
+// @Tags 内部成员管理
+// @Accept json
+// @Produce json
+// @Param id path int true "成员ID"
+// @Success 200 {object} models.Response{data=models.StandardResponse}
+// @Router /api/v1/members/{id}/2fa/reset [post]
+func ResetMemberTwoFactor(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		utils.Error(c, "无效的成员ID")
+		return
+	}
+
+	var member models.InternalMember
+	if err := database.DB.First(&member, uint(id)).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.NotFound(c, "成员不存在")
+		} else {
+			utils.Error(c, "查询成员失败")
+		}
+		return
+	}
+
+	if err := clearTwoFactor(member.MemberID); err != nil {
+		utils.Error(c, "重置两步验证失败")
+		return
+	}
+	revokeSubjectSessions(utils.SubjectStaff, member.MemberID, models.SessionRevokeAdmin)
+
+	operatorID, _ := middleware.CurrentMemberID(c)
+	logOperation(operatorID, "重置", "两步验证", fmt.Sprintf("重置两步验证：%s", member.Account),
+		idStr, "内部成员", c.ClientIP(), c.GetHeader("User-Agent"))
+
+	utils.SuccessWithMessage(c, "重置两步验证成功", models.StandardResponse{
+		Success: true,
+		Message: "重置两步验证成功",
+	})
+}
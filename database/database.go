@@ -3,6 +3,7 @@ package database
 import (
 	"fmt"
 	"log"
+	"strings"
 	"tangsong-esports/config"
 	"tangsong-esports/models"
 	"tangsong-esports/utils"
@@ -29,6 +30,7 @@ func InitDB() {
 	DB, err = gorm.Open(mysql.Open(dsn), &gorm.Config{
 		Logger:                                   logger.Default.LogMode(logger.Info),
 		DisableForeignKeyConstraintWhenMigrating: true, // 禁用外键约束
+		TranslateError:                           true, // 将唯一索引冲突等数据库错误转换为 gorm 错误
 	})
 
 	if err != nil {
@@ -46,21 +48,33 @@ func InitDB() {
 		&models.Customer{},
 		&models.OrderCategory{},
 		&models.SystemConfig{},
+		&models.RolePermission{},
+		&models.UserSession{},
+		&models.PasswordHistory{},
+		&models.IdempotencyRecord{},
 	)
 	if err != nil {
 		log.Fatal("基础表迁移失败:", err)
 	}
 
+	// 收款单号改为唯一索引前清理历史数据，避免建索引失败导致服务无法启动
+	cleanRechargeTransactionIDs()
+
 	// 第二步：创建依赖表
 	err = DB.AutoMigrate(
 		&models.MemberPermissions{},
 		&models.MemberFinancialSettings{},
 		&models.MemberRelationships{},
 		&models.MemberLoginLogs{},
+		&models.MemberRecoveryCode{},
 		&models.Customer{},
 		&models.CustomerFinancialInfo{},
 		&models.CustomerPreferences{},
 		&models.CustomerRechargeHistory{},
+		&models.WalletLedgerEntry{},
+		&models.CustomerLoginLogs{},
+		&models.CustomerActivationCode{},
+		&models.SMSVerificationCode{},
 		&models.PlaymateOrder{},
 		&models.OperationLog{},
 	)
@@ -71,10 +85,20 @@ func InitDB() {
 	// 第三步：创建订单相关表
 	err = DB.AutoMigrate(
 		&models.OrderPricing{},
+		&models.OrderPriceDiscount{},
+		&models.CategoryPrice{},
 		&models.OrderWorkflow{},
 		&models.OrderPaymentInfo{},
 		&models.OrderImages{},
+		&models.OrderImageDuplicate{},
+		&models.OrderParseRule{},
 		&models.OrderApprovalHistory{},
+		&models.OrderRefund{},
+		&models.BalanceHold{},
+		&models.CommissionOverride{},
+		&models.SettlementBatch{},
+		&models.SettlementItem{},
+		&models.SettlementAdjustment{},
 	)
 	if err != nil {
 		log.Fatal("订单表迁移失败:", err)
@@ -86,6 +110,60 @@ func InitDB() {
 	initBaseData()
 }
 
+// 收款单号字段长度，与 CustomerRechargeHistory.TransactionID 一致
+const transactionIDMaxLength = 100
+
+// cleanRechargeTransactionIDs 清理历史充值记录的收款单号：未填写的空字符串置为 NULL；
+// 超长的单号和重复单号（每组保留最早的一条）改写为截断后加 "#充值记录ID" 的新单号，原单号追加到备注中
+func cleanRechargeTransactionIDs() {
+	if !DB.Migrator().HasTable(&models.CustomerRechargeHistory{}) {
+		return
+	}
+	if err := DB.Exec("UPDATE customer_recharge_history SET transaction_id = NULL WHERE TRIM(transaction_id) = ''").Error; err != nil {
+		log.Println("清理空收款单号失败:", err)
+	}
+
+	type rechargeRow struct {
+		RechargeID    uint
+		TransactionID string
+		Notes         string
+	}
+	var overlong, duplicates []rechargeRow
+	if err := DB.Raw("SELECT recharge_id, transaction_id, COALESCE(notes, '') AS notes FROM customer_recharge_history WHERE CHAR_LENGTH(transaction_id) > ?",
+		transactionIDMaxLength).Scan(&overlong).Error; err != nil {
+		log.Println("查询超长收款单号失败:", err)
+	}
+	// 分组和比较使用列的排序规则，与唯一索引判断重复的规则一致
+	if err := DB.Raw(`SELECT h.recharge_id, h.transaction_id, COALESCE(h.notes, '') AS notes FROM customer_recharge_history h
+		JOIN (SELECT transaction_id, MIN(recharge_id) AS keep_id FROM customer_recharge_history
+			WHERE transaction_id IS NOT NULL GROUP BY transaction_id HAVING COUNT(*) > 1) d
+		ON h.transaction_id = d.transaction_id AND h.recharge_id <> d.keep_id`).Scan(&duplicates).Error; err != nil {
+		log.Println("查询重复收款单号失败:", err)
+	}
+
+	rewritten := make(map[uint]bool)
+	for _, row := range append(overlong, duplicates...) {
+		if rewritten[row.RechargeID] {
+			continue
+		}
+		rewritten[row.RechargeID] = true
+
+		suffix := fmt.Sprintf("#%d", row.RechargeID)
+		prefix := []rune(strings.TrimSpace(row.TransactionID))
+		if keep := transactionIDMaxLength - len(suffix); len(prefix) > keep {
+			prefix = prefix[:keep]
+		}
+		newID := string(prefix) + suffix
+		notes := strings.TrimSpace(row.Notes + "\n迁移时因收款单号重复或超长改写，原收款单号：" + row.TransactionID)
+		if err := DB.Exec("UPDATE customer_recharge_history SET transaction_id = ?, notes = ? WHERE recharge_id = ?",
+			newID, notes, row.RechargeID).Error; err != nil {
+			log.Printf("改写充值记录 %d 的收款单号失败: %v", row.RechargeID, err)
+			continue
+		}
+		log.Printf("充值记录 %d 的收款单号重复或超长，已改写为 %s", row.RechargeID, newID)
+	}
+}
+
 func GetDB() *gorm.DB {
 	return DB
 }
@@ -102,9 +180,36 @@ func initBaseData() {
 	configs := []models.SystemConfig{
 		{ConfigKey: "default_commission_rate", ConfigValue: "0.15", ConfigDescription: "默认提成比例"},
 		{ConfigKey: "max_order_hours", ConfigValue: "24", ConfigDescription: "单次订单最大时长（小时）"},
+		{ConfigKey: "order_duration_tolerance_minutes", ConfigValue: "15", ConfigDescription: "陪玩时长与起止时间差允许的误差（分钟）"},
+		{ConfigKey: "order_future_skew_minutes", ConfigValue: "10", ConfigDescription: "订单结束时间允许晚于当前时间的幅度（分钟），用于容忍客户端时钟偏差"},
 		{ConfigKey: "auto_settlement_enabled", ConfigValue: "false", ConfigDescription: "是否启用自动结算"},
 		{ConfigKey: "order_image_max_size", ConfigValue: "5242880", ConfigDescription: "订单图片最大尺寸（字节）"},
+		{ConfigKey: "order_image_max_files", ConfigValue: "9", ConfigDescription: "单次最多上传的订单图片数量"},
+		{ConfigKey: "image_similarity_threshold", ConfigValue: "6", ConfigDescription: "重复图片检测的感知哈希最大汉明距离（0-64），0 表示只检测完全相同的图片"},
 		{ConfigKey: "platform_name", ConfigValue: "唐宋电竞陪玩平台", ConfigDescription: "平台名称"},
+		{ConfigKey: "login_max_failures_per_account", ConfigValue: "5", ConfigDescription: "单个账号在统计窗口内允许的登录失败次数"},
+		{ConfigKey: "login_max_failures_per_ip", ConfigValue: "20", ConfigDescription: "单个IP在统计窗口内允许的登录失败次数"},
+		{ConfigKey: "login_failure_window_minutes", ConfigValue: "15", ConfigDescription: "登录失败次数统计窗口（分钟）"},
+		{ConfigKey: "login_lock_minutes", ConfigValue: "15", ConfigDescription: "首次锁定时长（分钟），再次锁定时翻倍"},
+		{ConfigKey: "login_lock_max_minutes", ConfigValue: "1440", ConfigDescription: "最长锁定时长（分钟）"},
+		{ConfigKey: "customer_activation_code_hours", ConfigValue: "72", ConfigDescription: "客户激活码/重置码有效期（小时）"},
+		{ConfigKey: "customer_activation_url", ConfigValue: "", ConfigDescription: "客户设置密码页面地址，用于生成激活链接"},
+		{ConfigKey: "sms_code_ttl_minutes", ConfigValue: "5", ConfigDescription: "短信验证码有效期（分钟）"},
+		{ConfigKey: "sms_send_interval_seconds", ConfigValue: "60", ConfigDescription: "同一手机号发送验证码的最短间隔（秒）"},
+		{ConfigKey: "sms_daily_limit_per_phone", ConfigValue: "10", ConfigDescription: "同一手机号每天最多发送验证码次数"},
+		{ConfigKey: "sms_hourly_limit_per_ip", ConfigValue: "20", ConfigDescription: "同一IP每小时最多发送验证码次数"},
+		{ConfigKey: "two_factor_required_roles", ConfigValue: "", ConfigDescription: "强制启用两步验证的角色，多个用英文逗号分隔"},
+		{ConfigKey: "password_min_length", ConfigValue: "8", ConfigDescription: "密码最小长度"},
+		{ConfigKey: "password_require_upper", ConfigValue: "false", ConfigDescription: "密码是否必须包含大写字母"},
+		{ConfigKey: "password_require_lower", ConfigValue: "true", ConfigDescription: "密码是否必须包含小写字母"},
+		{ConfigKey: "password_require_digit", ConfigValue: "true", ConfigDescription: "密码是否必须包含数字"},
+		{ConfigKey: "password_require_symbol", ConfigValue: "false", ConfigDescription: "密码是否必须包含特殊字符"},
+		{ConfigKey: "password_history_count", ConfigValue: "5", ConfigDescription: "不允许重复使用最近几次的密码，0 表示不检查"},
+		{ConfigKey: "password_blacklist", ConfigValue: "", ConfigDescription: "额外禁用的密码，多个用英文逗号分隔"},
+		{ConfigKey: "money_rounding_mode", ConfigValue: "half_up", ConfigDescription: "金额舍入规则，逐行舍入到分：half_up 四舍五入，half_even 银行家舍入"},
+		{ConfigKey: "idempotency_retention_hours", ConfigValue: "24", ConfigDescription: "Idempotency-Key 幂等记录保留时长（小时），过期后同一个键可再次使用"},
+		{ConfigKey: "balance_deduction_order", ConfigValue: "gift_first", ConfigDescription: "余额支付扣款顺序：gift_first 先扣赠送余额，real_first 先扣实充余额，proportional 按比例扣减"},
+		{ConfigKey: "commission_rate_precedence", ConfigValue: "override,member,category,default", ConfigDescription: "提成比例取值顺序，逗号分隔：override 成员类别单独设置，member 成员提成比例，category 订单类别抽成比例，default 默认提成比例"},
 	}
 
 	for _, config := range configs {
@@ -118,11 +223,11 @@ func initBaseData() {
 	// 插入默认订单类别
 	if DB.Migrator().HasTable(&models.OrderCategory{}) {
 		categories := []models.OrderCategory{
-			{CategoryName: "英雄联盟", SortOrder: 10, CommissionRate: 0.20, UsageScenario: "排位赛、匹配、大乱斗"},
-			{CategoryName: "三角洲行动", SortOrder: 20, CommissionRate: 0.18, UsageScenario: "PVP、PVE模式"},
-			{CategoryName: "瓦罗兰特", SortOrder: 30, CommissionRate: 0.22, UsageScenario: "竞技模式"},
-			{CategoryName: "明星陪", SortOrder: 40, CommissionRate: 0.25, UsageScenario: "高端陪玩服务"},
-			{CategoryName: "拍卖单", SortOrder: 50, CommissionRate: 0.15, UsageScenario: "特殊拍卖服务"},
+			{CategoryName: "英雄联盟", SortOrder: 10, CommissionRate: models.DecimalFromFloat(0.20), UsageScenario: "排位赛、匹配、大乱斗"},
+			{CategoryName: "三角洲行动", SortOrder: 20, CommissionRate: models.DecimalFromFloat(0.18), UsageScenario: "PVP、PVE模式"},
+			{CategoryName: "瓦罗兰特", SortOrder: 30, CommissionRate: models.DecimalFromFloat(0.22), UsageScenario: "竞技模式"},
+			{CategoryName: "明星陪", SortOrder: 40, CommissionRate: models.DecimalFromFloat(0.25), UsageScenario: "高端陪玩服务"},
+			{CategoryName: "拍卖单", SortOrder: 50, CommissionRate: models.DecimalFromFloat(0.15), UsageScenario: "特殊拍卖服务"},
 		}
 
 		for _, category := range categories {
@@ -134,11 +239,106 @@ func initBaseData() {
 		}
 	}
 
+	// 插入默认角色权限（仅在角色尚未配置任何权限时初始化）
+	if DB.Migrator().HasTable(&models.RolePermission{}) {
+		for role, perms := range models.DefaultRolePermissions {
+			var count int64
+			DB.Model(&models.RolePermission{}).Where("role_name = ?", role).Count(&count)
+			if count > 0 {
+				continue
+			}
+			for _, perm := range perms {
+				DB.Create(&models.RolePermission{RoleName: role, PermissionCode: perm})
+			}
+		}
+	}
+
+	// 插入默认报单识别规则（仅在尚未配置任何规则时初始化）
+	if DB.Migrator().HasTable(&models.OrderParseRule{}) {
+		var count int64
+		DB.Model(&models.OrderParseRule{}).Count(&count)
+		if count == 0 {
+			for _, rule := range models.DefaultOrderParseRules {
+				rule.IsActive = true
+				DB.Create(&rule)
+			}
+		}
+	}
+
+	// 为启用钱包流水前已有余额的客户补记期初余额，保证流水汇总与余额一致
+	if DB.Migrator().HasTable(&models.WalletLedgerEntry{}) {
+		var financials []models.CustomerFinancialInfo
+		DB.Where("current_balance <> 0 AND customer_id NOT IN (?)",
+			DB.Model(&models.WalletLedgerEntry{}).Select("customer_id")).Find(&financials)
+		for _, financial := range financials {
+			entry := models.WalletLedgerEntry{
+				CustomerID:    financial.CustomerID,
+				EntryType:     models.LedgerEntryAdjustment,
+				DebitAccount:  models.LedgerAccountAdjustment,
+				CreditAccount: models.LedgerAccountCustomerWallet,
+				Amount:        financial.CurrentBalance,
+				BalanceAfter:  financial.CurrentBalance,
+				ReferenceType: models.LedgerRefOpening,
+				ReferenceID:   financial.FinancialID,
+				Notes:         "期初余额",
+			}
+			if financial.CurrentBalance < 0 {
+				entry.DebitAccount, entry.CreditAccount = entry.CreditAccount, entry.DebitAccount
+				entry.Amount = -financial.CurrentBalance
+			}
+			DB.Create(&entry)
+		}
+		if len(financials) > 0 {
+			log.Printf("已为 %d 个客户补记期初余额流水", len(financials))
+		}
+	}
+
+	// 拆分实充/赠送余额前的数据：赠送流水及其冲正计入赠送部分，客户余额按流水拆分，赠送部分不超过当前余额
+	if DB.Migrator().HasTable(&models.WalletLedgerEntry{}) {
+		DB.Model(&models.WalletLedgerEntry{}).
+			Where("entry_type = ? AND gift_amount = 0", models.LedgerEntryGift).
+			Update("gift_amount", gorm.Expr("amount"))
+		DB.Exec(`UPDATE wallet_ledger_entries r JOIN wallet_ledger_entries o ON r.reversal_of_id = o.entry_id
+			SET r.gift_amount = o.amount WHERE o.entry_type = ? AND r.gift_amount = 0`, models.LedgerEntryGift)
+
+		var financials []models.CustomerFinancialInfo
+		DB.Where("current_balance <> 0 AND real_balance = 0 AND gift_balance = 0").Find(&financials)
+		for _, financial := range financials {
+			var result struct{ GiftBalance models.Money }
+			DB.Model(&models.WalletLedgerEntry{}).
+				Select("COALESCE(SUM(CASE WHEN credit_account = ? THEN gift_amount ELSE -gift_amount END), 0) AS gift_balance",
+					models.LedgerAccountCustomerWallet).
+				Where("customer_id = ?", financial.CustomerID).Scan(&result)
+			gift := result.GiftBalance
+			if gift > financial.CurrentBalance {
+				gift = financial.CurrentBalance
+			}
+			if gift < 0 {
+				gift = 0
+			}
+			DB.Model(&financial).Updates(map[string]interface{}{
+				"real_balance": financial.CurrentBalance - gift,
+				"gift_balance": gift,
+			})
+		}
+		if len(financials) > 0 {
+			log.Printf("已为 %d 个客户拆分实充与赠送余额", len(financials))
+		}
+	}
+
 	// 创建默认管理员账户（如果表存在且不存在管理员）
 	if DB.Migrator().HasTable(&models.InternalMember{}) {
 		var count int64
 		DB.Model(&models.InternalMember{}).Where("account = ?", "admin").Count(&count)
-		if count == 0 {
+		if count > 0 {
+			// 仍在使用默认密码的管理员，下次登录时强制修改
+			var admin models.InternalMember
+			if err := DB.Where("account = ?", "admin").First(&admin).Error; err == nil &&
+				!admin.MustChangePassword && utils.CheckPassword("123456", admin.PasswordHash) {
+				DB.Model(&admin).Update("must_change_password", true)
+				log.Println("默认管理员仍在使用初始密码，已要求登录时修改")
+			}
+		} else {
 			// 生成密码哈希
 			hashedPassword, err := utils.HashPassword("123456")
 			if err != nil {
@@ -148,13 +348,14 @@ func initBaseData() {
 
 			// 创建默认管理员
 			admin := models.InternalMember{
-				Account:      "admin",
-				PasswordHash: hashedPassword,
-				Name:         "系统管理员",
-				UserRole:     "超级管理员",
-				Status:       "正常",
-				IsEnabled:    true,
-				Notes:        "默认管理员账户",
+				Account:            "admin",
+				PasswordHash:       hashedPassword,
+				Name:               "系统管理员",
+				UserRole:           "超级管理员",
+				Status:             "正常",
+				IsEnabled:          true,
+				Notes:              "默认管理员账户",
+				MustChangePassword: true,
 			}
 			DB.Create(&admin)
 			log.Println("创建默认管理员账户: admin / 123456")
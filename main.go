@@ -20,6 +20,12 @@ func main() {
 	// 加载配置
 	config.LoadConfig()
 
+	// 初始化令牌服务
+	utils.InitTokenService()
+
+	// 初始化短信发送器
+	utils.InitSMSSender()
+
 	// 初始化数据库
 	database.InitDB()
 
@@ -2,13 +2,26 @@ package middleware
 
 import (
 	"strings"
+	"tangsong-esports/database"
+	"tangsong-esports/models"
 	"tangsong-esports/utils"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-// AuthMiddleware JWT认证中间件
-func AuthMiddleware() gin.HandlerFunc {
+// StaffAuthMiddleware 内部成员JWT认证中间件，只接受内部成员令牌
+func StaffAuthMiddleware() gin.HandlerFunc {
+	return authMiddleware(utils.SubjectStaff)
+}
+
+// CustomerAuthMiddleware 客户JWT认证中间件，只接受客户令牌
+func CustomerAuthMiddleware() gin.HandlerFunc {
+	return authMiddleware(utils.SubjectCustomer)
+}
+
+// authMiddleware 校验令牌并确认令牌主体类型
+func authMiddleware(subjectType string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		token := c.GetHeader("Authorization")
 
@@ -30,11 +43,50 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		if claims.SubjectType != subjectType {
+			utils.Forbidden(c, "令牌类型不匹配")
+			c.Abort()
+			return
+		}
+
+		// 校验服务端会话，已登出或被注销的会话立即失效
+		if !checkSession(claims) {
+			utils.ErrorWithCode(c, 401, "会话已失效，请重新登录")
+			c.Abort()
+			return
+		}
+
 		// 将用户信息存储到上下文中
-		c.Set("member_id", claims.MemberID)
-		c.Set("account", claims.Account)
-		c.Set("user_role", claims.UserRole)
+		setSubject(c, claims)
 
 		c.Next()
 	}
 }
+
+// 会话活跃时间的更新间隔，避免每个请求都写库
+const sessionTouchInterval = time.Minute
+
+// checkSession 检查令牌对应的会话是否有效
+func checkSession(claims *utils.Claims) bool {
+	if claims.SessionID == "" {
+		return false
+	}
+
+	var session models.UserSession
+	if err := database.DB.Where("token_id = ?", claims.SessionID).First(&session).Error; err != nil {
+		return false
+	}
+	if session.SubjectType != claims.SubjectType || session.SubjectID != claims.SubjectID {
+		return false
+	}
+
+	now := time.Now()
+	if !session.IsActive(now) {
+		return false
+	}
+
+	if now.Sub(session.LastActiveAt) > sessionTouchInterval {
+		database.DB.Model(&session).UpdateColumn("last_active_at", now)
+	}
+	return true
+}
@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"tangsong-esports/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 上下文键，仅在本包内写入，外部通过下方的访问函数读取
+const (
+	ctxSubjectType = "subject_type"
+	ctxMemberID    = "member_id"
+	ctxCustomerID  = "customer_id"
+	ctxAccount     = "account"
+	ctxUserRole    = "user_role"
+	ctxSessionID   = "session_id"
+)
+
+// setSubject 根据令牌主体类型写入上下文，内部成员与客户的ID使用不同的键
+func setSubject(c *gin.Context, claims *utils.Claims) {
+	c.Set(ctxSubjectType, claims.SubjectType)
+	c.Set(ctxAccount, claims.Account)
+	c.Set(ctxUserRole, claims.UserRole)
+	c.Set(ctxSessionID, claims.SessionID)
+
+	switch claims.SubjectType {
+	case utils.SubjectStaff:
+		c.Set(ctxMemberID, claims.SubjectID)
+	case utils.SubjectCustomer:
+		c.Set(ctxCustomerID, claims.SubjectID)
+	}
+}
+
+// CurrentMemberID 获取当前登录内部成员ID，客户令牌返回 false
+func CurrentMemberID(c *gin.Context) (uint, bool) {
+	value, exists := c.Get(ctxMemberID)
+	if !exists {
+		return 0, false
+	}
+	id, ok := value.(uint)
+	return id, ok
+}
+
+// CurrentCustomerID 获取当前登录客户ID，内部成员令牌返回 false
+func CurrentCustomerID(c *gin.Context) (uint, bool) {
+	value, exists := c.Get(ctxCustomerID)
+	if !exists {
+		return 0, false
+	}
+	id, ok := value.(uint)
+	return id, ok
+}
+
+// CurrentSubjectType 获取当前令牌主体类型
+func CurrentSubjectType(c *gin.Context) string {
+	return c.GetString(ctxSubjectType)
+}
+
+// CurrentAccount 获取当前登录账号
+func CurrentAccount(c *gin.Context) string {
+	return c.GetString(ctxAccount)
+}
+
+// CurrentUserRole 获取当前用户角色
+func CurrentUserRole(c *gin.Context) string {
+	return c.GetString(ctxUserRole)
+}
+
+// CurrentSessionID 获取当前请求所属会话的令牌ID
+func CurrentSessionID(c *gin.Context) string {
+	return c.GetString(ctxSessionID)
+}
@@ -0,0 +1,138 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"tangsong-esports/database"
+	"tangsong-esports/models"
+	"tangsong-esports/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// IdempotencyKeyHeader 客户端为一次业务操作生成的唯一键，重试时携带相同的值
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// 幂等键最长长度
+const idempotencyKeyMaxLength = 100
+
+// idempotencyRetention 从系统配置读取幂等记录保留时长，缺省 24 小时
+func idempotencyRetention() time.Duration {
+	var config models.SystemConfig
+	database.DB.Where("config_key = ? AND is_active = ?", "idempotency_retention_hours", true).First(&config)
+	if hours, err := strconv.Atoi(config.ConfigValue); err == nil && hours > 0 {
+		return time.Duration(hours) * time.Hour
+	}
+	return 24 * time.Hour
+}
+
+// idempotencyWriter 在写出响应的同时保留一份响应内容
+type idempotencyWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *idempotencyWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *idempotencyWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Idempotency 幂等请求中间件，需放在认证中间件之后
+// 携带 Idempotency-Key 的请求：首次执行并保存成功响应，相同键和相同请求体的重试直接返回保存的响应，
+// 相同键但请求体不同的返回 422，首次请求尚未完成时的重试返回 409；失败的请求不保存，可用同一个键重试
+func Idempotency() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > idempotencyKeyMaxLength {
+			utils.Error(c, "Idempotency-Key 过长")
+			c.Abort()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			utils.Error(c, "读取请求失败")
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		// 同一个键只在同一主体、同一接口内有效
+		subject := "member"
+		subjectID, ok := CurrentMemberID(c)
+		if !ok {
+			subject = "customer"
+			subjectID, _ = CurrentCustomerID(c)
+		}
+		scope := fmt.Sprintf("%s:%d %s %s", subject, subjectID, c.Request.Method, c.Request.URL.Path)
+		sum := sha256.Sum256(body)
+		hash := hex.EncodeToString(sum[:])
+
+		now := time.Now()
+		database.DB.Where("expires_at < ?", now).Delete(&models.IdempotencyRecord{})
+
+		record := models.IdempotencyRecord{
+			Scope:       scope,
+			Key:         key,
+			RequestHash: hash,
+			ExpiresAt:   now.Add(idempotencyRetention()),
+		}
+		if err := database.DB.Create(&record).Error; err != nil {
+			var existing models.IdempotencyRecord
+			if findErr := database.DB.Where("scope = ? AND idempotency_key = ?", scope, key).First(&existing).Error; findErr != nil {
+				if !errors.Is(findErr, gorm.ErrRecordNotFound) {
+					log.Printf("[Idempotency] 查询幂等记录失败: %v", findErr)
+				}
+				utils.Error(c, "处理幂等请求失败")
+				c.Abort()
+				return
+			}
+			switch {
+			case existing.RequestHash != hash:
+				utils.UnprocessableEntity(c, "Idempotency-Key 已用于内容不同的请求")
+			case !existing.Completed:
+				utils.Conflict(c, "相同 Idempotency-Key 的请求正在处理中，请稍后重试")
+			default:
+				c.Header("Idempotent-Replayed", "true")
+				c.Data(existing.StatusCode, "application/json; charset=utf-8", []byte(existing.ResponseBody))
+			}
+			c.Abort()
+			return
+		}
+
+		writer := &idempotencyWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+
+		status := writer.Status()
+		if status < http.StatusOK || status >= http.StatusMultipleChoices {
+			database.DB.Delete(&record)
+			return
+		}
+		if err := database.DB.Model(&record).Updates(map[string]interface{}{
+			"completed":     true,
+			"status_code":   status,
+			"response_body": writer.body.String(),
+		}).Error; err != nil {
+			log.Printf("[Idempotency] 保存幂等响应失败: %v", err)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package middleware
+
+import (
+	"log"
+	"sync"
+	"tangsong-esports/database"
+	"tangsong-esports/models"
+	"tangsong-esports/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 权限缓存有效期
+const permissionCacheTTL = 5 * time.Minute
+
+type memberPermissionEntry struct {
+	role        string
+	permissions map[string]bool
+	loadedAt    time.Time
+}
+
+// permissionCache 缓存角色权限、成员当前角色和附加权限，避免每次请求都查询数据库
+var permissionCache = struct {
+	sync.RWMutex
+	roles         map[string]map[string]bool
+	rolesLoadedAt time.Time
+	members       map[uint]memberPermissionEntry
+}{
+	members: make(map[uint]memberPermissionEntry),
+}
+
+// InvalidatePermissionCache 清空权限缓存，在角色权限或成员权限变更后调用
+func InvalidatePermissionCache() {
+	permissionCache.Lock()
+	defer permissionCache.Unlock()
+	permissionCache.roles = nil
+	permissionCache.members = make(map[uint]memberPermissionEntry)
+}
+
+// rolePermissions 获取角色对应的权限集合
+func rolePermissions(role string) map[string]bool {
+	permissionCache.RLock()
+	if permissionCache.roles != nil && time.Since(permissionCache.rolesLoadedAt) < permissionCacheTTL {
+		perms := permissionCache.roles[role]
+		permissionCache.RUnlock()
+		return perms
+	}
+	permissionCache.RUnlock()
+
+	var rows []models.RolePermission
+	if err := database.DB.Find(&rows).Error; err != nil {
+		log.Printf("[Permission] 加载角色权限失败: %v", err)
+		return nil
+	}
+
+	roles := make(map[string]map[string]bool)
+	for _, row := range rows {
+		if roles[row.RoleName] == nil {
+			roles[row.RoleName] = make(map[string]bool)
+		}
+		roles[row.RoleName][row.PermissionCode] = true
+	}
+
+	permissionCache.Lock()
+	permissionCache.roles = roles
+	permissionCache.rolesLoadedAt = time.Now()
+	permissionCache.Unlock()
+
+	return roles[role]
+}
+
+// memberPermissions 获取成员在数据库中的当前角色，以及根据 MemberPermissions 开关得到的附加权限
+// 角色不取自令牌，成员角色变更后清空缓存即可生效，无需等待访问令牌过期
+func memberPermissions(memberID uint) memberPermissionEntry {
+	permissionCache.RLock()
+	entry, ok := permissionCache.members[memberID]
+	permissionCache.RUnlock()
+	if ok && time.Since(entry.loadedAt) < permissionCacheTTL {
+		return entry
+	}
+
+	entry = memberPermissionEntry{loadedAt: time.Now()}
+	var member models.InternalMember
+	if err := database.DB.Select("member_id", "user_role").First(&member, memberID).Error; err == nil {
+		entry.role = member.UserRole
+	}
+
+	perms := make(map[string]bool)
+	var flags models.MemberPermissions
+	if err := database.DB.Where("member_id = ?", memberID).First(&flags).Error; err == nil {
+		if flags.IsAuditor {
+			perms[models.PermOrderAudit] = true
+		}
+		if flags.CanReport {
+			perms[models.PermOrderReport] = true
+		}
+	}
+
+	entry.permissions = perms
+
+	permissionCache.Lock()
+	permissionCache.members[memberID] = entry
+	permissionCache.Unlock()
+
+	return entry
+}
+
+// CurrentRole 获取当前用户的有效角色：内部成员以数据库中的角色为准，客户使用令牌中的角色
+func CurrentRole(c *gin.Context) string {
+	if memberID, ok := CurrentMemberID(c); ok {
+		return memberPermissions(memberID).role
+	}
+	return CurrentUserRole(c)
+}
+
+// GetPermissions 获取当前登录用户的权限集合
+func GetPermissions(c *gin.Context) map[string]bool {
+	if cached, exists := c.Get("permissions"); exists {
+		return cached.(map[string]bool)
+	}
+
+	perms := make(map[string]bool)
+	role := CurrentRole(c)
+
+	// 超级管理员拥有全部权限，避免误操作导致无人可管理权限
+	if role == models.RoleSuperAdmin && CurrentSubjectType(c) == utils.SubjectStaff {
+		for _, item := range models.PermissionCatalog {
+			perms[item.Code] = true
+		}
+		c.Set("permissions", perms)
+		return perms
+	}
+
+	for perm := range rolePermissions(role) {
+		perms[perm] = true
+	}
+
+	if memberID, ok := CurrentMemberID(c); ok {
+		for perm := range memberPermissions(memberID).permissions {
+			perms[perm] = true
+		}
+	}
+
+	c.Set("permissions", perms)
+	return perms
+}
+
+// HasPermission 判断当前用户是否拥有指定权限
+func HasPermission(c *gin.Context, perm string) bool {
+	return GetPermissions(c)[perm]
+}
+
+// RequirePermission 权限校验中间件，拥有任一指定权限即可访问，需在 AuthMiddleware 之后使用
+func RequirePermission(perms ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		granted := GetPermissions(c)
+		for _, perm := range perms {
+			if granted[perm] {
+				c.Next()
+				return
+			}
+		}
+
+		utils.Forbidden(c, "无权限访问")
+		c.Abort()
+	}
+}
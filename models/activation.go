@@ -0,0 +1,56 @@
+package models
+
+import (
+	"time"
+)
+
+// 激活码用途
+const (
+	ActivationPurposeActivate = "activate" // 管理员创建账户后首次设置密码
+	ActivationPurposeReset    = "reset"    // 管理员要求客户重置密码
+)
+
+// CustomerActivationCode 客户设置密码用的一次性激活码表，仅保存哈希
+type CustomerActivationCode struct {
+	CodeID        uint       `json:"code_id" gorm:"primaryKey;column:code_id"`
+	CustomerID    uint       `json:"customer_id" gorm:"not null;index;comment:客户ID"`
+	Purpose       string     `json:"purpose" gorm:"type:enum('activate','reset');not null;comment:用途"`
+	CodeHash      string     `json:"-" gorm:"size:64;not null;uniqueIndex;comment:激活码哈希"`
+	ExpiresAt     time.Time  `json:"expires_at" gorm:"not null;comment:过期时间"`
+	CreatedBy     uint       `json:"created_by" gorm:"not null;comment:生成人ID"`
+	UsedAt        *time.Time `json:"used_at" gorm:"comment:使用时间"`
+	UsedIP        string     `json:"used_ip" gorm:"size:45;comment:使用IP"`
+	UsedUserAgent string     `json:"used_user_agent" gorm:"type:text;comment:使用时的用户代理"`
+	RevokedAt     *time.Time `json:"revoked_at" gorm:"comment:作废时间，生成新激活码时旧码作废"`
+	CreatedAt     time.Time  `json:"created_at"`
+
+	// 关联关系
+	Customer *Customer       `json:"customer,omitempty" gorm:"foreignKey:CustomerID"`
+	Creator  *InternalMember `json:"creator,omitempty" gorm:"foreignKey:CreatedBy"`
+}
+
+// TableName 指定表名
+func (CustomerActivationCode) TableName() string {
+	return "customer_activation_codes"
+}
+
+// ActivationCodeResponse 新生成的激活码，明文仅在生成时返回一次
+type ActivationCodeResponse struct {
+	Purpose   string    `json:"purpose"`
+	Code      string    `json:"code"`
+	Link      string    `json:"link,omitempty"` // 配置了 customer_activation_url 时返回
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// CustomerCreateResponse 创建客户响应，未设置密码时附带激活码
+type CustomerCreateResponse struct {
+	Customer
+	Activation *ActivationCodeResponse `json:"activation,omitempty"`
+}
+
+// AdminResetCustomerPasswordResponse 管理员重置客户密码响应，未指定新密码时附带重置码
+type AdminResetCustomerPasswordResponse struct {
+	Success    bool                    `json:"success"`
+	Message    string                  `json:"message"`
+	Activation *ActivationCodeResponse `json:"activation,omitempty"`
+}
@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+// 余额冻结状态
+const (
+	HoldStatusActive   = "冻结中"
+	HoldStatusCaptured = "已扣款"
+	HoldStatusReleased = "已释放"
+)
+
+// BalanceHold 余额冻结记录表，余额支付的订单提交时冻结订单金额，审批通过时扣款，驳回时释放
+type BalanceHold struct {
+	HoldID     uint       `json:"hold_id" gorm:"primaryKey;column:hold_id"`
+	OrderID    uint       `json:"order_id" gorm:"uniqueIndex;not null;comment:订单ID"`
+	CustomerID uint       `json:"customer_id" gorm:"not null;index;comment:客户ID"`
+	Amount     Money      `json:"amount" gorm:"type:decimal(10,2);not null;comment:冻结金额"`
+	Status     string     `json:"status" gorm:"type:enum('冻结中','已扣款','已释放');default:'冻结中';index;comment:冻结状态"`
+	ClosedAt   *time.Time `json:"closed_at" gorm:"comment:扣款或释放时间"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+
+	// 关联关系
+	Order *PlaymateOrder `json:"order,omitempty" gorm:"foreignKey:OrderID"`
+}
+
+// TableName 指定表名
+func (BalanceHold) TableName() string {
+	return "balance_holds"
+}
+
+// CustomerBalanceResponse 客户余额信息，可用余额 = 当前余额 - 冻结金额
+type CustomerBalanceResponse struct {
+	CustomerFinancialInfo
+	AvailableBalance Money `json:"available_balance"`
+}
@@ -45,10 +45,14 @@ func (Customer) TableName() string {
 type CustomerFinancialInfo struct {
 	FinancialID       uint      `json:"financial_id" gorm:"primaryKey;column:financial_id"`
 	CustomerID        uint      `json:"customer_id" gorm:"uniqueIndex;not null;comment:客户ID"`
-	InitialRealCharge float64   `json:"initial_real_charge" gorm:"type:decimal(10,2);default:0.00;comment:初始实充金额"`
-	TotalConsumption  float64   `json:"total_consumption" gorm:"type:decimal(10,2);default:0.00;comment:历史消费总额"`
-	TotalRealCharge   float64   `json:"total_real_charge" gorm:"type:decimal(10,2);default:0.00;comment:历史实际充值总额"`
-	CurrentBalance    float64   `json:"current_balance" gorm:"type:decimal(10,2);default:0.00;comment:当前可用余额"`
+	InitialRealCharge Money     `json:"initial_real_charge" gorm:"type:decimal(10,2);default:0.00;comment:初始实充金额"`
+	TotalConsumption  Money     `json:"total_consumption" gorm:"type:decimal(10,2);default:0.00;comment:历史消费总额"`
+	TotalRealCharge   Money     `json:"total_real_charge" gorm:"type:decimal(10,2);default:0.00;comment:历史实际充值总额"`
+	CurrentBalance    Money     `json:"current_balance" gorm:"type:decimal(10,2);default:0.00;comment:当前可用余额"`
+	RealBalance       Money     `json:"real_balance" gorm:"type:decimal(10,2);default:0.00;comment:实充余额（可退）"`
+	GiftBalance       Money     `json:"gift_balance" gorm:"type:decimal(10,2);default:0.00;comment:赠送余额（不可退）"`
+	FrozenBalance     Money     `json:"frozen_balance" gorm:"type:decimal(10,2);default:0.00;comment:待审批订单冻结金额"`
+	Version           uint      `json:"version" gorm:"not null;default:0;comment:版本号，用于并发更新校验"`
 	CreatedAt         time.Time `json:"created_at"`
 	UpdatedAt         time.Time `json:"updated_at"`
 
@@ -61,12 +65,19 @@ func (CustomerFinancialInfo) TableName() string {
 	return "customer_financial_info"
 }
 
+// AvailableBalance 可用余额，扣除待审批订单冻结的金额
+func (f CustomerFinancialInfo) AvailableBalance() Money {
+	return f.CurrentBalance - f.FrozenBalance
+}
+
 // CustomerPreferences 客户服务偏好表
 type CustomerPreferences struct {
 	PreferenceID           uint      `json:"preference_id" gorm:"primaryKey;column:preference_id"`
 	CustomerID             uint      `json:"customer_id" gorm:"uniqueIndex;not null;comment:客户ID"`
 	PlatformBoss           string    `json:"platform_boss" gorm:"size:100;comment:所属平台老板"`
 	ExclusiveCS            string    `json:"exclusive_cs" gorm:"size:100;comment:专属服务客服"`
+	ExclusiveDiscountType  string    `json:"exclusive_discount_type" gorm:"type:enum('无','折扣率','固定折扣');default:'无';comment:专属折扣类型"`
+	ExclusiveDiscountValue Decimal   `json:"exclusive_discount_value" gorm:"type:decimal(10,2);default:0.00;comment:专属折扣值：折扣率为应付比例，固定折扣为每小时减免金额"`
 	CreatedAt              time.Time `json:"created_at"`
 	UpdatedAt              time.Time `json:"updated_at"`
 
@@ -83,11 +94,13 @@ func (CustomerPreferences) TableName() string {
 type CustomerRechargeHistory struct {
 	RechargeID          uint      `json:"recharge_id" gorm:"primaryKey;column:recharge_id"`
 	CustomerID          uint      `json:"customer_id" gorm:"not null;comment:客户ID"`
-	RealChargeAmount    float64   `json:"real_charge_amount" gorm:"type:decimal(10,2);not null;comment:实充金额"`
-	GiftAmount          float64   `json:"gift_amount" gorm:"type:decimal(10,2);default:0.00;comment:赠送金额"`
-	TotalRechargeAmount float64   `json:"total_recharge_amount" gorm:"type:decimal(10,2);not null;comment:本次充值总额"`
+	RealChargeAmount    Money     `json:"real_charge_amount" gorm:"type:decimal(10,2);not null;comment:实充金额"`
+	GiftAmount          Money     `json:"gift_amount" gorm:"type:decimal(10,2);default:0.00;comment:赠送金额"`
+	TotalRechargeAmount Money     `json:"total_recharge_amount" gorm:"type:decimal(10,2);not null;comment:本次充值总额"`
+	RealBalanceAfter    Money     `json:"real_balance_after" gorm:"type:decimal(10,2);default:0.00;comment:充值后实充余额"`
+	GiftBalanceAfter    Money     `json:"gift_balance_after" gorm:"type:decimal(10,2);default:0.00;comment:充值后赠送余额"`
 	PaymentMethod       string    `json:"payment_method" gorm:"type:enum('微信','支付宝','银行转账','平台','内部','其他');not null;comment:付款方式"`
-	TransactionID       string    `json:"transaction_id" gorm:"type:text;comment:收款单号/交易ID"`
+	TransactionID       *string   `json:"transaction_id" gorm:"size:100;uniqueIndex;comment:收款单号/交易ID，同一单号只能登记一次，未填写时为空"`
 	RechargeAt          time.Time `json:"recharge_at" gorm:"comment:充值时间"`
 	Notes               string    `json:"notes" gorm:"type:text;comment:备注"`
 	OperatorID          uint      `json:"operator_id" gorm:"not null;comment:操作员ID"`
@@ -102,6 +115,25 @@ func (CustomerRechargeHistory) TableName() string {
 	return "customer_recharge_history"
 }
 
+// CustomerLoginLogs 客户登录日志表
+type CustomerLoginLogs struct {
+	LogID         uint      `json:"log_id" gorm:"primaryKey;column:log_id"`
+	CustomerID    uint      `json:"customer_id" gorm:"not null;index;comment:客户ID"`
+	LoginTime     time.Time `json:"login_time" gorm:"comment:登录时间"`
+	LoginIP       string    `json:"login_ip" gorm:"size:45;comment:登录IP"`
+	UserAgent     string    `json:"user_agent" gorm:"type:text;comment:用户代理信息"`
+	LoginStatus   string    `json:"login_status" gorm:"type:enum('成功','失败');default:'成功';comment:登录状态"`
+	FailureReason string    `json:"failure_reason" gorm:"size:100;comment:失败原因"`
+
+	// 关联关系
+	Customer *Customer `json:"customer,omitempty" gorm:"foreignKey:CustomerID"`
+}
+
+// TableName 指定表名
+func (CustomerLoginLogs) TableName() string {
+	return "customer_login_logs"
+}
+
 // CustomerCreateRequest 创建客户请求结构体
 type CustomerCreateRequest struct {
 	Account                string     `json:"account" `
@@ -114,18 +146,21 @@ type CustomerCreateRequest struct {
 	AdditionalInfo2        string     `json:"additional_info2"`
 	AdditionalInfo3        string     `json:"additional_info3"`
 	Notes                  string     `json:"notes"`
-	InitialRealCharge      float64    `json:"initial_real_charge"`
+	InitialRealCharge      Money      `json:"initial_real_charge"`
 	PlatformBoss           string     `json:"platform_boss"`
 	ExclusiveCS            string     `json:"exclusive_cs"`
+	ExclusiveDiscountType  string     `json:"exclusive_discount_type"` // 无/折扣率/固定折扣
+	ExclusiveDiscountValue Decimal    `json:"exclusive_discount_value"`
+	Status                 string     `json:"status"` // 可选，更新时传入：正常/禁用/过期
 }
 
 type CustomerRechargeRequest struct {
-	CustomerID       uint    `json:"customer_id"`
-	RealChargeAmount float64 `json:"real_charge_amount" binding:"required"`
-	GiftAmount       float64 `json:"gift_amount"`
-	PaymentMethod    string  `json:"payment_method" binding:"required"`
-	TransactionID    string  `json:"transaction_id"`
-	Notes            string  `json:"notes"`
+	CustomerID       uint   `json:"customer_id"`
+	RealChargeAmount Money  `json:"real_charge_amount" binding:"required"`
+	GiftAmount       Money  `json:"gift_amount"`
+	PaymentMethod    string `json:"payment_method" binding:"required"`
+	TransactionID    string `json:"transaction_id"`
+	Notes            string `json:"notes"`
 }
 
 // 客户注册登录相关请求结构
@@ -147,34 +182,18 @@ type CustomerLoginRequest struct {
 	Password string `json:"password" binding:"required"`
 }
 
-type CustomerLoginResponse struct {
-	Token     string    `json:"token"`
-	ExpiresIn int64     `json:"expires_in"`
-	User      *Customer `json:"user"`
-}
-
-type CustomerRefreshTokenRequest struct {
-	RefreshToken string `json:"refresh_token" binding:"required"`
-}
-
-type CustomerRefreshTokenResponse struct {
-	AccessToken  string    `json:"access_token"`
-	RefreshToken string    `json:"refresh_token"`
-	ExpiresIn    int64     `json:"expires_in"`
-	User         *Customer `json:"user"`
-}
-
 type CustomerSetPasswordRequest struct {
 	Account  string `json:"account" binding:"required"`
-	Password string `json:"password" binding:"required,min=6"`
+	Code     string `json:"code" binding:"required"`     // 管理员生成的激活码或重置码
+	Password string `json:"password" binding:"required"` // 需满足密码策略
 }
 
 type CustomerResetPasswordRequest struct {
 	OldPassword string `json:"old_password" binding:"required"`
-	NewPassword string `json:"new_password" binding:"required,min=6"`
+	NewPassword string `json:"new_password" binding:"required"` // 需满足密码策略
 }
 
 type AdminResetCustomerPasswordRequest struct {
 	CustomerID  uint   `json:"customer_id" binding:"required"`
-	NewPassword string `json:"new_password" binding:"required,min=6"`
+	NewPassword string `json:"new_password"` // 为空时生成重置码，由客户自行设置密码
 }
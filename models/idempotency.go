@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// IdempotencyRecord 幂等请求记录表，保存 Idempotency-Key 对应的请求摘要和首次成功响应
+type IdempotencyRecord struct {
+	RecordID     uint      `json:"record_id" gorm:"primaryKey;column:record_id"`
+	Scope        string    `json:"scope" gorm:"size:191;not null;uniqueIndex:idx_idempotency_scope_key;comment:请求主体和接口"`
+	Key          string    `json:"key" gorm:"column:idempotency_key;size:100;not null;uniqueIndex:idx_idempotency_scope_key;comment:幂等键"`
+	RequestHash  string    `json:"request_hash" gorm:"size:64;not null;comment:请求体SHA-256摘要"`
+	Completed    bool      `json:"completed" gorm:"default:false;comment:是否已保存响应"`
+	StatusCode   int       `json:"status_code" gorm:"comment:响应状态码"`
+	ResponseBody string    `json:"response_body" gorm:"type:mediumtext;comment:响应内容"`
+	ExpiresAt    time.Time `json:"expires_at" gorm:"index;comment:过期时间"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (IdempotencyRecord) TableName() string {
+	return "idempotency_records"
+}
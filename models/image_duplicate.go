@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// 重复图片匹配方式
+const (
+	ImageMatchExact   = "完全相同"
+	ImageMatchSimilar = "高度相似"
+)
+
+// OrderImageDuplicate 重复图片标记表，上传的图片与其他订单已有图片相同或相似时记录，供审核人员核查
+type OrderImageDuplicate struct {
+	DuplicateID    uint      `json:"duplicate_id" gorm:"primaryKey;column:duplicate_id"`
+	ImageID        uint      `json:"image_id" gorm:"not null;index;comment:新上传的图片ID"`
+	OrderID        uint      `json:"order_id" gorm:"not null;index;comment:新上传图片所属订单ID"`
+	MatchedImageID uint      `json:"matched_image_id" gorm:"not null;index;comment:匹配到的已有图片ID"`
+	MatchedOrderID uint      `json:"matched_order_id" gorm:"not null;index;comment:匹配到的图片所属订单ID"`
+	MatchType      string    `json:"match_type" gorm:"type:enum('完全相同','高度相似');not null;comment:匹配方式"`
+	Distance       int       `json:"distance" gorm:"comment:感知哈希汉明距离，完全相同为0"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// TableName 指定表名
+func (OrderImageDuplicate) TableName() string {
+	return "order_image_duplicates"
+}
@@ -0,0 +1,172 @@
+package models
+
+import "time"
+
+// 钱包流水类型
+const (
+	LedgerEntryRecharge    = "recharge"
+	LedgerEntryGift        = "gift"
+	LedgerEntryOrderCharge = "order_charge"
+	LedgerEntryRefund      = "refund"
+	LedgerEntryAdjustment  = "adjustment"
+	LedgerEntryReversal    = "reversal"
+)
+
+// 记账科目，客户钱包对平台而言是负债，贷记增加、借记减少
+const (
+	LedgerAccountCustomerWallet = "customer_wallet"    // 客户钱包
+	LedgerAccountCash           = "platform_cash"      // 平台实收资金
+	LedgerAccountPromotion      = "promotion_expense"  // 赠送支出
+	LedgerAccountOrderRevenue   = "order_revenue"      // 订单收入
+	LedgerAccountAdjustment     = "balance_adjustment" // 人工调账
+)
+
+// 余额分类
+const (
+	BalanceBucketReal = "real" // 实充余额，可退款
+	BalanceBucketGift = "gift" // 赠送余额，不可退款
+)
+
+// 余额支付的扣款顺序
+const (
+	DeductGiftFirst    = "gift_first"   // 先扣赠送余额
+	DeductRealFirst    = "real_first"   // 先扣实充余额
+	DeductProportional = "proportional" // 按两类余额的比例扣减
+)
+
+// 流水关联的来源记录类型
+const (
+	LedgerRefCustomer = "customer"     // 创建客户时的初始充值
+	LedgerRefRecharge = "recharge"     // CustomerRechargeHistory
+	LedgerRefOrder    = "order"        // PlaymateOrder，扣款和退款都关联订单
+	LedgerRefEntry    = "ledger_entry" // 被冲正的流水
+	LedgerRefOpening  = "opening"      // 启用流水前的期初余额
+)
+
+// WalletLedgerEntry 客户钱包流水表，复式记账，只增不改，更正通过冲正流水完成
+type WalletLedgerEntry struct {
+	EntryID          uint      `json:"entry_id" gorm:"primaryKey;column:entry_id"`
+	CustomerID       uint      `json:"customer_id" gorm:"not null;index;comment:客户ID"`
+	EntryType        string    `json:"entry_type" gorm:"type:enum('recharge','gift','order_charge','refund','adjustment','reversal');not null;comment:流水类型"`
+	DebitAccount     string    `json:"debit_account" gorm:"size:50;not null;comment:借方科目"`
+	CreditAccount    string    `json:"credit_account" gorm:"size:50;not null;comment:贷方科目"`
+	Amount           Money     `json:"amount" gorm:"type:decimal(10,2);not null;comment:金额"`
+	GiftAmount       Money     `json:"gift_amount" gorm:"type:decimal(10,2);default:0.00;comment:其中计入赠送余额的部分"`
+	BalanceAfter     Money     `json:"balance_after" gorm:"type:decimal(10,2);not null;comment:记账后客户余额"`
+	GiftBalanceAfter Money     `json:"gift_balance_after" gorm:"type:decimal(10,2);default:0.00;comment:记账后赠送余额"`
+	ReferenceType    string    `json:"reference_type" gorm:"size:50;index:idx_ledger_reference;comment:来源记录类型"`
+	ReferenceID      uint      `json:"reference_id" gorm:"index:idx_ledger_reference;comment:来源记录ID"`
+	ReversalOfID     *uint     `json:"reversal_of_id" gorm:"uniqueIndex;comment:冲正的原流水ID"`
+	OperatorID       *uint     `json:"operator_id" gorm:"comment:操作人ID"`
+	Notes            string    `json:"notes" gorm:"type:text;comment:备注"`
+	CreatedAt        time.Time `json:"created_at"`
+
+	// 关联关系
+	Operator *InternalMember `json:"operator,omitempty" gorm:"foreignKey:OperatorID"`
+}
+
+// TableName 指定表名
+func (WalletLedgerEntry) TableName() string {
+	return "wallet_ledger_entries"
+}
+
+// WalletDelta 本笔流水对客户钱包余额的影响，入账为正、出账为负
+func (e WalletLedgerEntry) WalletDelta() Money {
+	if e.CreditAccount == LedgerAccountCustomerWallet {
+		return e.Amount
+	}
+	if e.DebitAccount == LedgerAccountCustomerWallet {
+		return -e.Amount
+	}
+	return 0
+}
+
+// GiftDelta 本笔流水对赠送余额的影响，其余部分计入实充余额
+func (e WalletLedgerEntry) GiftDelta() Money {
+	if e.WalletDelta() < 0 {
+		return -e.GiftAmount
+	}
+	return e.GiftAmount
+}
+
+// WalletLedgerAccounts 返回流水类型对应的借贷科目，in 表示资金进入客户钱包
+// 冲正流水的科目由原流水对调得到，不在此处定义
+func WalletLedgerAccounts(entryType string, in bool) (debit, credit string, ok bool) {
+	var counter string
+	switch entryType {
+	case LedgerEntryRecharge:
+		counter = LedgerAccountCash
+	case LedgerEntryGift:
+		counter = LedgerAccountPromotion
+	case LedgerEntryOrderCharge, LedgerEntryRefund:
+		counter = LedgerAccountOrderRevenue
+	case LedgerEntryAdjustment:
+		counter = LedgerAccountAdjustment
+	default:
+		return "", "", false
+	}
+	if in {
+		return counter, LedgerAccountCustomerWallet, true
+	}
+	return LedgerAccountCustomerWallet, counter, true
+}
+
+// 钱包流水相关请求结构
+type WalletLedgerFilterRequest struct {
+	PageRequest
+	EntryType string `json:"entry_type" form:"entry_type"`
+	StartDate string `json:"start_date" form:"start_date"`
+	EndDate   string `json:"end_date" form:"end_date"`
+}
+
+type BalanceAdjustmentRequest struct {
+	Amount Money  `json:"amount" binding:"required"` // 正数增加余额，负数减少余额
+	Bucket string `json:"bucket"`                    // real 实充余额（默认），gift 赠送余额
+	Reason string `json:"reason" binding:"required"`
+}
+
+type ReverseLedgerEntryRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+// WalletReconcileResponse 钱包对账结果
+type WalletReconcileResponse struct {
+	CustomerID      uint  `json:"customer_id"`
+	LedgerBalance   Money `json:"ledger_balance"`   // 按流水汇总的余额
+	RecordedBalance Money `json:"recorded_balance"` // CustomerFinancialInfo.CurrentBalance
+	Difference      Money `json:"difference"`
+	LedgerGift      Money `json:"ledger_gift_balance"`   // 按流水汇总的赠送余额
+	RecordedGift    Money `json:"recorded_gift_balance"` // CustomerFinancialInfo.GiftBalance
+	GiftDifference  Money `json:"gift_difference"`
+	Balanced        bool  `json:"balanced"`
+	EntryCount      int64 `json:"entry_count"`
+}
+
+// SplitWalletDebit 按扣款顺序计算 amount 中应从赠送余额扣减的部分，其余从实充余额扣减
+// 余额不足时尽量扣满一类余额，由记账时的余额校验报错；按比例扣减时赠送部分按 mode 舍入到分
+func SplitWalletDebit(amount, realBalance, giftBalance Money, order string, mode RoundingMode) Money {
+	var giftPart Money
+	switch order {
+	case DeductRealFirst:
+		giftPart = amount - realBalance
+	case DeductProportional:
+		if total := realBalance + giftBalance; total > 0 {
+			giftPart = Money(divRound(int64(amount)*int64(giftBalance), int64(total), mode))
+		}
+	default:
+		giftPart = amount
+	}
+	if giftPart > giftBalance {
+		giftPart = giftBalance
+	}
+	if amount-giftPart > realBalance {
+		giftPart = amount - realBalance
+	}
+	if giftPart < 0 {
+		giftPart = 0
+	}
+	if giftPart > amount {
+		giftPart = amount
+	}
+	return giftPart
+}
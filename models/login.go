@@ -0,0 +1,24 @@
+package models
+
+// 登录结果
+const (
+	LoginStatusSuccess = "成功"
+	LoginStatusFailed  = "失败"
+)
+
+// 登录失败原因
+const (
+	LoginFailWrongPassword = "密码错误"
+	LoginFailPasswordUnset = "密码未设置"
+	LoginFailDisabled      = "账户已禁用"
+	LoginFailNotEnabled    = "账户未启用"
+	LoginFailTwoFactor     = "两步验证失败"
+	LoginFailSMSCode       = "短信验证码错误"
+)
+
+// LoginUnlockRequest 解除登录锁定请求，账号和IP至少填写一项
+type LoginUnlockRequest struct {
+	SubjectType string `json:"subject_type" binding:"required"` // staff 或 customer，解除IP锁定时忽略
+	Account     string `json:"account"`
+	IP          string `json:"ip"`
+}
@@ -24,6 +24,14 @@ type InternalMember struct {
 	UpdatedAt    time.Time      `json:"updated_at"`
 	DeletedAt    gorm.DeletedAt `json:"-" gorm:"index"`
 
+	// 首次登录或管理员要求时必须先修改密码
+	MustChangePassword bool `json:"must_change_password" gorm:"default:false;comment:是否需要修改密码"`
+
+	// 两步验证
+	TOTPSecret      string `json:"-" gorm:"column:totp_secret;size:64;comment:TOTP密钥"`
+	TOTPEnabled     bool   `json:"totp_enabled" gorm:"column:totp_enabled;default:false;comment:是否启用两步验证"`
+	TOTPLastCounter uint64 `json:"-" gorm:"column:totp_last_counter;default:0;comment:最近使用的TOTP计数器，防止重放"`
+
 	// 关联关系
 	Permissions       *MemberPermissions       `json:"permissions,omitempty" gorm:"foreignKey:MemberID"`
 	FinancialSettings *MemberFinancialSettings `json:"financial_settings,omitempty" gorm:"foreignKey:MemberID"`
@@ -58,7 +66,7 @@ func (MemberPermissions) TableName() string {
 type MemberFinancialSettings struct {
 	SettingID      uint      `json:"setting_id" gorm:"primaryKey;column:setting_id"`
 	MemberID       uint      `json:"member_id" gorm:"uniqueIndex;not null;comment:成员ID"`
-	CommissionRate float64   `json:"commission_rate" gorm:"type:decimal(5,2);default:0.00;comment:提成比例（百分比）"`
+	CommissionRate Decimal   `json:"commission_rate" gorm:"type:decimal(5,2);default:0.00;comment:提成比例（百分比）"`
 	CreatedAt      time.Time `json:"created_at"`
 	UpdatedAt      time.Time `json:"updated_at"`
 
@@ -94,12 +102,13 @@ func (MemberRelationships) TableName() string {
 
 // MemberLoginLogs 内部成员登录日志表
 type MemberLoginLogs struct {
-	LogID       uint      `json:"log_id" gorm:"primaryKey;column:log_id"`
-	MemberID    uint      `json:"member_id" gorm:"not null;comment:成员ID"`
-	LoginTime   time.Time `json:"login_time" gorm:"comment:登录时间"`
-	LoginIP     string    `json:"login_ip" gorm:"size:45;comment:登录IP"`
-	UserAgent   string    `json:"user_agent" gorm:"type:text;comment:用户代理信息"`
-	LoginStatus string    `json:"login_status" gorm:"type:enum('成功','失败');default:'成功';comment:登录状态"`
+	LogID         uint      `json:"log_id" gorm:"primaryKey;column:log_id"`
+	MemberID      uint      `json:"member_id" gorm:"not null;comment:成员ID"`
+	LoginTime     time.Time `json:"login_time" gorm:"comment:登录时间"`
+	LoginIP       string    `json:"login_ip" gorm:"size:45;comment:登录IP"`
+	UserAgent     string    `json:"user_agent" gorm:"type:text;comment:用户代理信息"`
+	LoginStatus   string    `json:"login_status" gorm:"type:enum('成功','失败');default:'成功';comment:登录状态"`
+	FailureReason string    `json:"failure_reason" gorm:"size:100;comment:失败原因"`
 
 	// 关联关系
 	Member *InternalMember `json:"member,omitempty" gorm:"foreignKey:MemberID"`
@@ -115,11 +124,6 @@ type LoginRequest struct {
 	Account  string `json:"account" binding:"required" example:"admin"`
 	Password string `json:"password" binding:"required" example:"123456"`
 }
-type LoginResponse struct {
-	Token     string          `json:"token"`
-	ExpiresIn int64           `json:"expires_in"`
-	User      *InternalMember `json:"user"`
-}
 
 type MemberCreateRequest struct {
 	Account        string  `json:"account" `
@@ -131,20 +135,14 @@ type MemberCreateRequest struct {
 	Notes          string  `json:"notes"`
 	IsAuditor      bool    `json:"is_auditor"`
 	CanReport      bool    `json:"can_report"`
-	CommissionRate float64 `json:"commission_rate"`  // 修复：与财务设置模型字段一致
+	CommissionRate Decimal `json:"commission_rate"`  // 修复：与财务设置模型字段一致
 	CreatorID      *uint   `json:"creator_id"`
 	AssigneeID     *uint   `json:"assignee_id"`
+	Status         string  `json:"status"`     // 可选，更新时传入：正常/禁用
+	IsEnabled      *bool   `json:"is_enabled"` // 可选，更新时传入
 }
 
 // RefreshTokenRequest 刷新令牌请求
 type RefreshTokenRequest struct {
 	RefreshToken string `json:"refresh_token" binding:"required"`
 }
-
-// RefreshTokenResponse 刷新令牌响应
-type RefreshTokenResponse struct {
-	AccessToken  string          `json:"access_token"`
-	RefreshToken string          `json:"refresh_token"`
-	ExpiresIn    int64           `json:"expires_in"`
-	User         *InternalMember `json:"user"`
-}
@@ -0,0 +1,291 @@
+package models
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// RoundingMode 金额舍入规则
+type RoundingMode string
+
+const (
+	RoundHalfUp   RoundingMode = "half_up"   // 四舍五入，0.5 远离零方向进位
+	RoundHalfEven RoundingMode = "half_even" // 银行家舍入，0.5 向偶数舍入
+)
+
+// ParseRoundingMode 解析舍入规则，无法识别时使用四舍五入
+func ParseRoundingMode(s string) RoundingMode {
+	if RoundingMode(strings.TrimSpace(s)) == RoundHalfEven {
+		return RoundHalfEven
+	}
+	return RoundHalfUp
+}
+
+// divRound 计算 num/den 并按 mode 舍入到整数，den 必须为正数
+func divRound(num, den int64, mode RoundingMode) int64 {
+	q, r := num/den, num%den
+	if r == 0 {
+		return q
+	}
+	sign := int64(1)
+	if num < 0 {
+		sign, r = -1, -r
+	}
+	switch twice := 2 * r; {
+	case twice > den:
+		return q + sign
+	case twice == den:
+		if mode == RoundHalfEven && q%2 == 0 {
+			return q
+		}
+		return q + sign
+	default:
+		return q
+	}
+}
+
+// fixed2 两位小数定点数的公共实现，内部以 1/100 为单位
+type fixed2 int64
+
+func (f fixed2) format() string {
+	sign := ""
+	v := int64(f)
+	if v < 0 {
+		sign, v = "-", -v
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, v/100, v%100)
+}
+
+// parseFixed2 精确解析十进制字符串，超过两位的小数按四舍五入处理
+func parseFixed2(s string) (fixed2, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	if strings.ContainsAny(s, "eE") {
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return 0, err
+		}
+		return fixed2(math.Round(v * 100)), nil
+	}
+
+	neg := false
+	switch s[0] {
+	case '-':
+		neg, s = true, s[1:]
+	case '+':
+		s = s[1:]
+	}
+	intPart, fracPart, _ := strings.Cut(s, ".")
+	if intPart == "" && fracPart == "" {
+		return 0, fmt.Errorf("无效的数值: %q", s)
+	}
+	if intPart == "" {
+		intPart = "0"
+	}
+	for _, part := range []string{intPart, fracPart} {
+		for _, r := range part {
+			if r < '0' || r > '9' {
+				return 0, fmt.Errorf("无效的数值: %q", s)
+			}
+		}
+	}
+
+	units, err := strconv.ParseInt(intPart, 10, 64)
+	if err != nil || units > math.MaxInt64/100-1 {
+		return 0, fmt.Errorf("数值超出范围: %q", s)
+	}
+	cents := units * 100
+	frac := (fracPart + "00")[:2]
+	fracValue, _ := strconv.ParseInt(frac, 10, 64)
+	cents += fracValue
+	if len(fracPart) > 2 && fracPart[2] >= '5' {
+		cents++
+	}
+	if neg {
+		cents = -cents
+	}
+	return fixed2(cents), nil
+}
+
+func (f *fixed2) scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*f = 0
+	case []byte:
+		parsed, err := parseFixed2(string(v))
+		if err != nil {
+			return err
+		}
+		*f = parsed
+	case string:
+		parsed, err := parseFixed2(v)
+		if err != nil {
+			return err
+		}
+		*f = parsed
+	case int64:
+		*f = fixed2(v * 100)
+	case float64:
+		*f = fixed2(math.Round(v * 100))
+	default:
+		return fmt.Errorf("不支持的数值类型: %T", value)
+	}
+	return nil
+}
+
+func (f *fixed2) unmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if s == "null" {
+		return nil
+	}
+	parsed, err := parseFixed2(s)
+	if err != nil {
+		return err
+	}
+	*f = parsed
+	return nil
+}
+
+// Money 金额，以分为单位的定点数，对应 decimal(10,2) 列，JSON 中以两位小数的数字表示
+type Money int64
+
+// Cents 构造以分为单位的金额
+func Cents(cents int64) Money {
+	return Money(cents)
+}
+
+// ParseMoney 精确解析金额字符串，如 "12.34"
+func ParseMoney(s string) (Money, error) {
+	f, err := parseFixed2(s)
+	return Money(f), err
+}
+
+// MoneyFromFloat 将浮点数转换为金额，仅用于查询参数等外部输入
+func MoneyFromFloat(v float64) Money {
+	return Money(math.Round(v * 100))
+}
+
+// Cents 返回以分为单位的整数值
+func (m Money) Cents() int64 {
+	return int64(m)
+}
+
+// Float64 返回浮点值，仅用于展示
+func (m Money) Float64() float64 {
+	return float64(m) / 100
+}
+
+// String 格式化为两位小数
+func (m Money) String() string {
+	return fixed2(m).format()
+}
+
+// IsZero 是否为零
+func (m Money) IsZero() bool {
+	return m == 0
+}
+
+// IsPositive 是否大于零
+func (m Money) IsPositive() bool {
+	return m > 0
+}
+
+// IsNegative 是否小于零
+func (m Money) IsNegative() bool {
+	return m < 0
+}
+
+// Abs 绝对值
+func (m Money) Abs() Money {
+	if m < 0 {
+		return -m
+	}
+	return m
+}
+
+// Mul 乘以两位小数的数量（时长、比例等），结果按 mode 舍入到分
+func (m Money) Mul(d Decimal, mode RoundingMode) Money {
+	return Money(divRound(int64(m)*int64(d), 100, mode))
+}
+
+// Div 按份数平分，结果按 mode 舍入到分
+func (m Money) Div(n int64, mode RoundingMode) Money {
+	if n <= 0 {
+		return 0
+	}
+	return Money(divRound(int64(m), n, mode))
+}
+
+// MarshalJSON 输出两位小数的数字
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON 接受数字或字符串形式的金额
+func (m *Money) UnmarshalJSON(data []byte) error {
+	return (*fixed2)(m).unmarshalJSON(data)
+}
+
+// Scan 实现 sql.Scanner
+func (m *Money) Scan(value interface{}) error {
+	return (*fixed2)(m).scan(value)
+}
+
+// Value 实现 driver.Valuer，以字符串写入避免浮点误差
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
+
+// Decimal 两位小数的定点数，用于时长、提成比例等非金额数值，对应 decimal(5,2) 列
+type Decimal int64
+
+// ParseDecimal 精确解析数值字符串，如 "2.50"
+func ParseDecimal(s string) (Decimal, error) {
+	f, err := parseFixed2(s)
+	return Decimal(f), err
+}
+
+// DecimalFromFloat 将浮点数转换为定点数
+func DecimalFromFloat(v float64) Decimal {
+	return Decimal(math.Round(v * 100))
+}
+
+// Float64 返回浮点值，仅用于展示和比较
+func (d Decimal) Float64() float64 {
+	return float64(d) / 100
+}
+
+// String 格式化为两位小数
+func (d Decimal) String() string {
+	return fixed2(d).format()
+}
+
+// IsPositive 是否大于零
+func (d Decimal) IsPositive() bool {
+	return d > 0
+}
+
+// MarshalJSON 输出两位小数的数字
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalJSON 接受数字或字符串形式的数值
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	return (*fixed2)(d).unmarshalJSON(data)
+}
+
+// Scan 实现 sql.Scanner
+func (d *Decimal) Scan(value interface{}) error {
+	return (*fixed2)(d).scan(value)
+}
+
+// Value 实现 driver.Valuer
+func (d Decimal) Value() (driver.Value, error) {
+	return d.String(), nil
+}
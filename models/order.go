@@ -1,6 +1,7 @@
 package models
 
 import (
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
@@ -13,11 +14,12 @@ type OrderCategory struct {
 	SortOrder       int            `json:"sort_order" gorm:"default:0;comment:排序序号"`
 	IsActive        bool           `json:"is_active" gorm:"default:true;comment:是否开启"`
 	UsageScenario   string         `json:"usage_scenario" gorm:"size:255;comment:使用场景"`
-	CommissionRate  float64        `json:"commission_rate" gorm:"type:decimal(5,2);default:0.00;comment:抽成比例（百分比）"`
+	CommissionRate  Decimal        `json:"commission_rate" gorm:"type:decimal(5,2);default:0.00;comment:抽成比例（百分比）"`
 	IsParticipating bool           `json:"is_participating" gorm:"default:true;comment:是否参与"`
 	IsRequired      bool           `json:"is_required" gorm:"default:false;comment:是否必填"`
 	IsAccelerated   bool           `json:"is_accelerated" gorm:"default:false;comment:是否加速"`
 	AdditionalInfo  string         `json:"additional_info" gorm:"type:text;comment:附加信息"`
+	Aliases         string         `json:"aliases" gorm:"size:255;comment:别名，多个用英文逗号分隔，用于智能识别报单"`
 	CreatedAt       time.Time      `json:"created_at"`
 	UpdatedAt       time.Time      `json:"updated_at"`
 	DeletedAt       gorm.DeletedAt `json:"-" gorm:"index"`
@@ -28,6 +30,17 @@ func (OrderCategory) TableName() string {
 	return "order_categories"
 }
 
+// AliasList 返回去掉空白的别名列表
+func (c OrderCategory) AliasList() []string {
+	var aliases []string
+	for _, alias := range strings.Split(c.Aliases, ",") {
+		if alias = strings.TrimSpace(alias); alias != "" {
+			aliases = append(aliases, alias)
+		}
+	}
+	return aliases
+}
+
 // PlaymateOrder 陪玩报单基本信息表
 type PlaymateOrder struct {
 	OrderID               uint      `json:"order_id" gorm:"primaryKey;column:order_id"`
@@ -37,7 +50,7 @@ type PlaymateOrder struct {
 	ProjectCategory       string    `json:"project_category" gorm:"size:100;not null;comment:项目分类"`
 	StartTime             time.Time `json:"start_time" gorm:"not null;comment:开始时间"`
 	EndTime               time.Time `json:"end_time" gorm:"not null;comment:结束时间"`
-	DurationHours         float64   `json:"duration_hours" gorm:"type:decimal(5,2);not null;comment:陪玩时长（小时）"`
+	DurationHours         Decimal   `json:"duration_hours" gorm:"type:decimal(5,2);not null;comment:陪玩时长（小时）"`
 	ServiceAdditionalInfo string    `json:"service_additional_info" gorm:"type:text;comment:服务附加说明"`
 	InternalNotes         string    `json:"internal_notes" gorm:"type:text;comment:内部备注"`
 	OrderNotes            string    `json:"order_notes" gorm:"type:text;comment:订单备注"`
@@ -57,6 +70,9 @@ type PlaymateOrder struct {
 	Workflow    *OrderWorkflow    `json:"workflow,omitempty" gorm:"foreignKey:OrderID"`
 	PaymentInfo *OrderPaymentInfo `json:"payment_info,omitempty" gorm:"foreignKey:OrderID"`
 	Images      []OrderImages     `json:"images,omitempty" gorm:"foreignKey:OrderID"`
+
+	// 本订单图片与其他订单图片重复的标记
+	ImageDuplicates []OrderImageDuplicate `json:"image_duplicates,omitempty" gorm:"foreignKey:OrderID"`
 }
 
 // TableName 指定表名
@@ -68,14 +84,22 @@ func (PlaymateOrder) TableName() string {
 type OrderPricing struct {
 	PricingID         uint      `json:"pricing_id" gorm:"primaryKey;column:pricing_id"`
 	OrderID           uint      `json:"order_id" gorm:"uniqueIndex;not null;comment:订单ID"`
-	UnitPrice         float64   `json:"unit_price" gorm:"type:decimal(10,2);not null;comment:单价（元/小时）"`
-	TotalPrice        float64   `json:"total_price" gorm:"type:decimal(10,2);not null;comment:订单总价"`
-	FinalPrice        float64   `json:"final_price" gorm:"type:decimal(10,2);not null;comment:最终结算价格"`
+	PriceID           *uint     `json:"price_id" gorm:"comment:价目ID，手动录入单价时为空"`
+	PriceSource       string    `json:"price_source" gorm:"size:20;comment:单价来源：价目表/手动录入"`
+	UnitPrice         Money     `json:"unit_price" gorm:"type:decimal(10,2);not null;comment:单价（元/小时）"`
+	TotalPrice        Money     `json:"total_price" gorm:"type:decimal(10,2);not null;comment:订单原价（单价×时长）"`
+	DiscountAmount    Money     `json:"discount_amount" gorm:"type:decimal(10,2);default:0.00;comment:折扣总额"`
+	FinalPrice        Money     `json:"final_price" gorm:"type:decimal(10,2);not null;comment:最终结算价格"`
+	SkipExclusive     bool      `json:"skip_exclusive" gorm:"default:false;comment:是否不使用客户专属折扣"`
+	ManualDiscount    Money     `json:"manual_discount" gorm:"type:decimal(10,2);default:0.00;comment:手动折扣金额"`
+	ManualReason      string    `json:"manual_reason" gorm:"type:text;comment:手动折扣原因"`
+	ManualOperatorID  *uint     `json:"manual_operator_id" gorm:"comment:手动折扣操作人ID"`
 	CreatedAt         time.Time `json:"created_at"`
 	UpdatedAt         time.Time `json:"updated_at"`
 
 	// 关联关系
-	Order *PlaymateOrder `json:"order,omitempty" gorm:"foreignKey:OrderID"`
+	Order     *PlaymateOrder       `json:"order,omitempty" gorm:"foreignKey:OrderID"`
+	Discounts []OrderPriceDiscount `json:"discounts,omitempty" gorm:"foreignKey:OrderID;references:OrderID"`
 }
 
 // TableName 指定表名
@@ -87,10 +111,15 @@ func (OrderPricing) TableName() string {
 type OrderWorkflow struct {
 	WorkflowID      uint       `json:"workflow_id" gorm:"primaryKey;column:workflow_id"`
 	OrderID         uint       `json:"order_id" gorm:"uniqueIndex;not null;comment:订单ID"`
-	OrderStatus     string     `json:"order_status" gorm:"type:enum('待处理','驳回','已确认','已退回');default:'待处理';comment:订单状态"`
+	OrderStatus     string     `json:"order_status" gorm:"type:enum('待处理','驳回','已确认','已结算','已完成','已退回');default:'待处理';comment:订单状态"`
 	ApproverID      *uint      `json:"approver_id" gorm:"comment:审批人ID"`
 	ApprovalTime    *time.Time `json:"approval_time" gorm:"comment:审批时间"`
 	RejectionReason string     `json:"rejection_reason" gorm:"type:text;comment:驳回原因"`
+	SettlementTime  *time.Time `json:"settlement_time" gorm:"comment:结算时间"`
+	CompletionTime  *time.Time `json:"completion_time" gorm:"comment:完成时间"`
+	ReturnTime      *time.Time `json:"return_time" gorm:"comment:退回时间"`
+	ReturnReason    string     `json:"return_reason" gorm:"type:text;comment:退回原因"`
+	Version         uint       `json:"version" gorm:"not null;default:0;comment:版本号，用于并发更新校验"`
 	CreatedAt       time.Time  `json:"created_at"`
 	UpdatedAt       time.Time  `json:"updated_at"`
 
@@ -106,15 +135,17 @@ func (OrderWorkflow) TableName() string {
 
 // OrderPaymentInfo 订单支付信息表
 type OrderPaymentInfo struct {
-	PaymentID     uint       `json:"payment_id" gorm:"autoIncrement:false;column:payment_id"` // 移除主键，禁用自增
-	OrderID       uint       `json:"order_id" gorm:"primaryKey;not null;comment:订单ID"`      // 改为主键
-	TransactionID string     `json:"transaction_id" gorm:"type:text;comment:付款流水号"`      // 修复：从 payment_transaction_id 改为 transaction_id
-	PaymentMethod string     `json:"payment_method" gorm:"size:50;comment:付款方式"`
-	PaymentTime   *time.Time `json:"payment_time" gorm:"comment:付款时间"`
-	PaymentAmount float64    `json:"payment_amount" gorm:"type:decimal(10,2);comment:付款金额"`
-	PaymentStatus string     `json:"payment_status" gorm:"type:enum('待付款','已付款','付款失败','已退款');default:'待付款';comment:付款状态"`
-	CreatedAt     time.Time  `json:"created_at"`
-	UpdatedAt     time.Time  `json:"updated_at"`
+	PaymentID      uint       `json:"payment_id" gorm:"autoIncrement:false;column:payment_id"` // 移除主键，禁用自增
+	OrderID        uint       `json:"order_id" gorm:"primaryKey;not null;comment:订单ID"`        // 改为主键
+	TransactionID  string     `json:"transaction_id" gorm:"type:text;comment:付款流水号"`           // 修复：从 payment_transaction_id 改为 transaction_id
+	PaymentMethod  string     `json:"payment_method" gorm:"size:50;comment:付款方式"`
+	PaymentTime    *time.Time `json:"payment_time" gorm:"comment:付款时间"`
+	PaymentAmount  Money      `json:"payment_amount" gorm:"type:decimal(10,2);comment:付款金额"`
+	GiftPaidAmount Money      `json:"gift_paid_amount" gorm:"type:decimal(10,2);default:0.00;comment:余额支付中使用赠送余额的部分"`
+	RefundedAmount Money      `json:"refunded_amount" gorm:"type:decimal(10,2);default:0.00;comment:已退款金额"`
+	PaymentStatus  string     `json:"payment_status" gorm:"type:enum('待付款','已付款','付款失败','部分退款','已退款');default:'待付款';comment:付款状态"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
 
 	// 关联关系
 	Order *PlaymateOrder `json:"order,omitempty" gorm:"foreignKey:OrderID"`
@@ -125,14 +156,42 @@ func (OrderPaymentInfo) TableName() string {
 	return "order_payment_info"
 }
 
+// 订单图片类型
+const (
+	ImageTypeSettlement = "结算截图"
+	ImageTypeChat       = "聊天记录"
+	ImageTypeGame       = "游戏截图"
+	ImageTypeOther      = "其他"
+)
+
+// IsValidImageType 检查订单图片类型是否有效
+func IsValidImageType(imageType string) bool {
+	switch imageType {
+	case ImageTypeSettlement, ImageTypeChat, ImageTypeGame, ImageTypeOther:
+		return true
+	}
+	return false
+}
+
 // OrderImages 订单图片表
 type OrderImages struct {
-	ImageID   uint      `json:"image_id" gorm:"primaryKey;column:image_id"`
-	OrderID   uint      `json:"order_id" gorm:"not null;comment:关联的订单ID"`
-	ImageURL  string    `json:"image_url" gorm:"size:255;not null;comment:图片存储URL"`
-	ImageType string    `json:"image_type" gorm:"type:enum('结算截图','聊天记录','游戏截图','其他');default:'其他';comment:图片类型"`
-	UploadAt  time.Time `json:"upload_at" gorm:"comment:上传时间"`
-	Notes     string    `json:"notes" gorm:"type:text;comment:图片备注"`
+	ImageID      uint      `json:"image_id" gorm:"primaryKey;column:image_id"`
+	OrderID      uint      `json:"order_id" gorm:"not null;index;comment:关联的订单ID"`
+	ImageURL     string    `json:"image_url" gorm:"size:255;not null;comment:图片存储路径"`
+	ThumbnailKey string    `json:"-" gorm:"size:255;comment:缩略图存储路径"`
+	ImageType    string    `json:"image_type" gorm:"type:enum('结算截图','聊天记录','游戏截图','其他');default:'其他';comment:图片类型"`
+	ContentType  string    `json:"content_type" gorm:"size:50;comment:文件类型"`
+	FileSize     int64     `json:"file_size" gorm:"comment:文件大小（字节）"`
+	OriginalName string    `json:"original_name" gorm:"size:255;comment:原始文件名"`
+	ContentHash  string    `json:"content_hash" gorm:"size:64;index;comment:文件内容SHA-256"`
+	PHash        *uint64   `json:"phash,omitempty" gorm:"column:perceptual_hash;index;comment:感知哈希，无法解码的格式为空"`
+	UploaderID   *uint     `json:"uploader_id" gorm:"comment:上传人ID"`
+	UploadAt     time.Time `json:"upload_at" gorm:"comment:上传时间"`
+	Notes        string    `json:"notes" gorm:"type:text;comment:图片备注"`
+
+	// 带签名的访问链接，查询时生成
+	URL          string `json:"url" gorm:"-"`
+	ThumbnailURL string `json:"thumbnail_url,omitempty" gorm:"-"`
 
 	// 关联关系
 	Order *PlaymateOrder `json:"order,omitempty" gorm:"foreignKey:OrderID"`
@@ -150,8 +209,12 @@ type OrderCreateRequest struct {
 	ProjectCategory       string    `json:"project_category"`
 	StartTime             time.Time `json:"start_time" binding:"required"` // 修复：从 string 改为 time.Time
 	EndTime               time.Time `json:"end_time" binding:"required"`   // 修复：从 string 改为 time.Time
-	DurationHours         float64   `json:"duration_hours" binding:"required"`
-	UnitPrice             float64   `json:"unit_price" binding:"required"`
+	DurationHours         Decimal   `json:"duration_hours" binding:"required"`
+	UnitPrice             Money     `json:"unit_price"`             // 手动录入的单价，选择价目时忽略
+	PriceID               *uint     `json:"price_id"`               // 类别价目ID，不传且未填写单价时使用类别默认价目
+	ExclusiveDiscount     *bool     `json:"exclusive_discount"`     // 是否使用客户专属折扣，不传时保持原设置（新订单默认使用）；取消需要订单手动折扣权限
+	ManualDiscount        *Money    `json:"manual_discount"`        // 手动折扣金额，需要订单手动折扣权限；不传时保持原有折扣
+	ManualDiscountReason  string    `json:"manual_discount_reason"` // 手动折扣原因，设置手动折扣时必填
 	ServiceAdditionalInfo string    `json:"service_additional_info"`
 	InternalNotes         string    `json:"internal_notes"`
 	OrderNotes            string    `json:"order_notes"`
@@ -167,11 +230,12 @@ type OrderCategoryCreateRequest struct {
 	CategoryName    string  `json:"category_name" binding:"required"`
 	SortOrder       int     `json:"sort_order"`
 	UsageScenario   string  `json:"usage_scenario"`
-	CommissionRate  float64 `json:"commission_rate"`
+	CommissionRate  Decimal `json:"commission_rate"`
 	IsParticipating bool    `json:"is_participating"`
 	IsRequired      bool    `json:"is_required"`
 	IsAccelerated   bool    `json:"is_accelerated"`
 	AdditionalInfo  string  `json:"additional_info"`
+	Aliases         string  `json:"aliases"` // 多个用英文逗号分隔
 }
 
 // OrderApprovalHistory 订单审批操作历史表
@@ -180,7 +244,7 @@ type OrderApprovalHistory struct {
 	OrderID      uint           `json:"order_id" gorm:"not null;comment:订单ID"`
 	OperatorID   uint           `json:"operator_id" gorm:"not null;comment:操作人ID"`
 	OperatorName string         `json:"operator_name" gorm:"size:100;comment:操作人姓名"`
-	Action       string         `json:"action" gorm:"type:enum('approve','reject','status_change');comment:操作类型"`
+	Action       string         `json:"action" gorm:"type:enum('approve','reject','resubmit','settle','complete','return','status_change');comment:操作类型"`
 	FromStatus   string         `json:"from_status" gorm:"size:50;comment:原状态"`
 	ToStatus     string         `json:"to_status" gorm:"size:50;comment:新状态"`
 	Reason       string         `json:"reason" gorm:"type:text;comment:操作原因"`
@@ -226,16 +290,26 @@ type RejectOrderRequest struct {
 }
 
 type BatchApprovalRequest struct {
-	OrderIDs []string `json:"order_ids" binding:"required"`
-	Action   string   `json:"action" binding:"required"`
-	Reason   string   `json:"reason"`
-	Notes    string   `json:"notes"`
+	OrderIDs     []string `json:"order_ids" binding:"required"`
+	Action       string   `json:"action" binding:"required"`
+	Reason       string   `json:"reason"`
+	Notes        string   `json:"notes"`
+	AllOrNothing bool     `json:"all_or_nothing"` // 为 true 时任一订单失败则整批回滚
 }
 
 type UpdateOrderStatusRequestV2 struct {
-	Status string `json:"status" binding:"required"`
-	Reason string `json:"reason"`
-	Notes  string `json:"notes"`
+	Status          string `json:"status" binding:"required"`
+	Reason          string `json:"reason"`
+	Notes           string `json:"notes"`
+	RefundAmount    *Money `json:"refund_amount"`    // 退回时的退款金额，不填则全额退款
+	RefundReference string `json:"refund_reference"` // 直接支付订单退回时的外部退款流水号
+}
+
+type ReturnOrderRequest struct {
+	Reason          string `json:"reason" binding:"required"`
+	Notes           string `json:"notes"`
+	RefundAmount    *Money `json:"refund_amount"`    // 不填则全额退款，填0表示不退款
+	RefundReference string `json:"refund_reference"` // 直接支付订单必填
 }
 
 type GetStatisticsRequest struct {
@@ -263,9 +337,9 @@ type GetOrderStatsReq struct {
 
 type GetOrderStatsResData struct {
 	TotalCount         int     `json:"totalCount"`
-	TotalDurationHours float64 `json:"totalDurationHours"`
-	TotalAmount        float64 `json:"totalAmount"`
-	TotalCommission    float64 `json:"totalCommission"`
+	TotalDurationHours Decimal `json:"totalDurationHours"`
+	TotalAmount        Money   `json:"totalAmount"`
+	TotalCommission    Money   `json:"totalCommission"`
 }
 
 type GetOperationHistoryRequest struct {
@@ -286,18 +360,18 @@ type BatchExportRequest struct {
 // 响应结构
 type OrderStatistics struct {
 	TotalCount         int64            `json:"total_count"`
-	TotalHours         float64          `json:"total_hours"`
-	TotalAmount        float64          `json:"total_amount"`
-	TotalCommission    float64          `json:"total_commission"`
-	AveragePrice       float64          `json:"average_price"`
+	TotalHours         Decimal          `json:"total_hours"`
+	TotalAmount        Money            `json:"total_amount"`
+	TotalCommission    Money            `json:"total_commission"`
+	AveragePrice       Money            `json:"average_price"`
 	StatusDistribution map[string]int64 `json:"status_distribution"`
 	DailyTrend         []DailyTrendItem `json:"daily_trend"`
 }
 
 type DailyTrendItem struct {
-	Date   string  `json:"date"`
-	Count  int64   `json:"count"`
-	Amount float64 `json:"amount"`
+	Date   string `json:"date"`
+	Count  int64  `json:"count"`
+	Amount Money  `json:"amount"`
 }
 
 type BatchApprovalResponse struct {
@@ -305,6 +379,7 @@ type BatchApprovalResponse struct {
 	SuccessCount int                    `json:"success_count"`
 	FailureCount int                    `json:"failure_count"`
 	Failures     []BatchApprovalFailure `json:"failures"`
+	RolledBack   bool                   `json:"rolled_back"` // 整批模式下是否已回滚
 }
 
 type BatchApprovalFailure struct {
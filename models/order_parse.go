@@ -0,0 +1,299 @@
+package models
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// 报单识别字段
+const (
+	ParseFieldCustomer        = "customer"                // 老板账号/名称/手机号
+	ParseFieldCategory        = "category"                // 订单类别名称或别名
+	ParseFieldDuration        = "duration_hours"          // 时长
+	ParseFieldUnitPrice       = "unit_price"              // 单价
+	ParseFieldStartTime       = "start_time"              // 开始时间
+	ParseFieldEndTime         = "end_time"                // 结束时间
+	ParseFieldTimeRange       = "time_range"              // 时间段，如 14:00-16:00
+	ParseFieldProjectCategory = "project_category"        // 项目分类
+	ParseFieldServiceInfo     = "service_additional_info" // 服务附加说明
+	ParseFieldOrderNotes      = "order_notes"             // 订单备注
+)
+
+// IsValidParseField 检查报单识别字段是否有效
+func IsValidParseField(field string) bool {
+	switch field {
+	case ParseFieldCustomer, ParseFieldCategory, ParseFieldDuration, ParseFieldUnitPrice,
+		ParseFieldStartTime, ParseFieldEndTime, ParseFieldTimeRange,
+		ParseFieldProjectCategory, ParseFieldServiceInfo, ParseFieldOrderNotes:
+		return true
+	}
+	return false
+}
+
+// OrderParseRule 报单识别规则表（报单设置），按优先级依次匹配，每个字段取第一个匹配的规则
+type OrderParseRule struct {
+	RuleID      uint      `json:"rule_id" gorm:"primaryKey;column:rule_id"`
+	Field       string    `json:"field" gorm:"size:50;not null;index;comment:识别字段"`
+	Pattern     string    `json:"pattern" gorm:"type:text;not null;comment:正则表达式，取第一个非空分组"`
+	Priority    int       `json:"priority" gorm:"default:100;comment:优先级，数值小的先匹配"`
+	IsActive    bool      `json:"is_active" gorm:"default:true;comment:是否启用"`
+	Description string    `json:"description" gorm:"size:255;comment:规则说明"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (OrderParseRule) TableName() string {
+	return "order_parse_rules"
+}
+
+// DefaultOrderParseRules 初始化的报单识别规则，对应需求文档中的报单文本格式
+var DefaultOrderParseRules = []OrderParseRule{
+	{Field: ParseFieldCustomer, Priority: 10, Description: "老板ID/老板名/会员号", Pattern: `(?m)^\s*(?:老板ID|老指ID|老板名称|老板名|老板|会员号|会员|客户)\s*[:：]\s*(.+?)\s*$`},
+	{Field: ParseFieldDuration, Priority: 10, Description: "时长", Pattern: `(?m)^\s*(?:陪玩时长|时长)\s*[:：]\s*(.+?)\s*$`},
+	{Field: ParseFieldCategory, Priority: 10, Description: "游戏品类", Pattern: `(?m)^\s*(?:游戏品类|订单类别|品类|游戏)\s*[:：]\s*(.+?)\s*$`},
+	{Field: ParseFieldUnitPrice, Priority: 10, Description: "单价", Pattern: `(?m)^\s*(?:单价|价格)\s*[:：]\s*(.+?)\s*$`},
+	{Field: ParseFieldStartTime, Priority: 10, Description: "开始时间", Pattern: `(?m)^\s*(?:开始时间|开始)\s*[:：]\s*(.+?)\s*$`},
+	{Field: ParseFieldEndTime, Priority: 10, Description: "结束时间", Pattern: `(?m)^\s*(?:结束时间|结束)\s*[:：]\s*(.+?)\s*$`},
+	{Field: ParseFieldTimeRange, Priority: 10, Description: "时间段", Pattern: `(?m)^\s*(?:时间段|时间)\s*[:：]\s*(.+?)\s*$`},
+	{Field: ParseFieldProjectCategory, Priority: 10, Description: "陪玩报单/项目分类", Pattern: `(?m)^\s*(?:陪玩报单|项目分类|项目)\s*[:：]\s*(.+?)\s*$`},
+	{Field: ParseFieldServiceInfo, Priority: 10, Description: "陪玩服/区服", Pattern: `(?m)^\s*((?:陪玩服|区服|服务器)\s*[:：]\s*.+?)\s*$`},
+	{Field: ParseFieldOrderNotes, Priority: 10, Description: "备注", Pattern: `(?m)^\s*备注\s*[:：]\s*(.+?)\s*$`},
+}
+
+// ParsedText 规则从报单文本中提取的原始内容
+type ParsedText struct {
+	Value  string
+	RuleID uint
+}
+
+// ExtractParseFields 按规则从文本中提取各字段的原始内容，rules 需已按优先级排序；
+// 无法编译的规则跳过并在 invalid 中返回规则ID
+func ExtractParseFields(text string, rules []OrderParseRule) (fields map[string]ParsedText, invalid []uint) {
+	fields = make(map[string]ParsedText)
+	for _, rule := range rules {
+		if _, done := fields[rule.Field]; done {
+			continue
+		}
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			invalid = append(invalid, rule.RuleID)
+			continue
+		}
+		match := re.FindStringSubmatch(text)
+		if match == nil {
+			continue
+		}
+		value := match[0]
+		for _, group := range match[1:] {
+			if group != "" {
+				value = group
+				break
+			}
+		}
+		if value = strings.TrimSpace(value); value != "" {
+			fields[rule.Field] = ParsedText{Value: value, RuleID: rule.RuleID}
+		}
+	}
+	return fields, invalid
+}
+
+var (
+	durationHourPattern   = regexp.MustCompile(`(\d+(?:\.\d+)?|[一二两三四五六七八九十]+)\s*(?:个)?\s*(半)?\s*(?:小时|钟头|h(?:ours?|rs?)?\b|H\b)`)
+	durationMinutePattern = regexp.MustCompile(`(\d+)\s*(?:分钟|min(?:utes?|s)?\b)`)
+	durationHalfPattern   = regexp.MustCompile(`半\s*(?:个)?\s*(?:小时|钟头)`)
+	plainNumberPattern    = regexp.MustCompile(`^\s*(\d+(?:\.\d+)?)\s*$`)
+	pricePattern          = regexp.MustCompile(`(\d+(?:\.\d{1,2})?)`)
+)
+
+// chineseNumber 解析一到九十九的中文数字
+func chineseNumber(s string) (int, bool) {
+	digits := map[rune]int{'一': 1, '二': 2, '两': 2, '三': 3, '四': 4, '五': 5, '六': 6, '七': 7, '八': 8, '九': 9}
+	runes := []rune(s)
+	switch {
+	case len(runes) == 1 && runes[0] == '十':
+		return 10, true
+	case len(runes) == 1:
+		n, ok := digits[runes[0]]
+		return n, ok
+	case len(runes) == 2 && runes[0] == '十':
+		n, ok := digits[runes[1]]
+		return 10 + n, ok
+	case len(runes) == 2 && runes[1] == '十':
+		n, ok := digits[runes[0]]
+		return n * 10, ok
+	case len(runes) == 3 && runes[1] == '十':
+		tens, ok1 := digits[runes[0]]
+		ones, ok2 := digits[runes[2]]
+		return tens*10 + ones, ok1 && ok2
+	}
+	return 0, false
+}
+
+// ParseDurationText 从文本中解析陪玩时长（小时），支持 2小时、1.5h、两个半小时、半小时、90分钟以及纯数字
+func ParseDurationText(s string) (Decimal, bool) {
+	if match := durationHourPattern.FindStringSubmatch(s); match != nil {
+		hours, err := ParseDecimal(match[1])
+		if err != nil {
+			n, ok := chineseNumber(match[1])
+			if !ok {
+				return 0, false
+			}
+			hours = Decimal(n * 100)
+		}
+		if match[2] != "" {
+			hours += 50
+		}
+		if minutes := durationMinutePattern.FindStringSubmatch(s[strings.Index(s, match[0])+len(match[0]):]); minutes != nil {
+			m, _ := ParseDecimal(minutes[1])
+			hours += Decimal(int64(m) / 60)
+		}
+		return hours, hours > 0
+	}
+	if durationHalfPattern.MatchString(s) {
+		return 50, true
+	}
+	if match := durationMinutePattern.FindStringSubmatch(s); match != nil {
+		minutes, _ := ParseDecimal(match[1])
+		hours := Decimal(int64(minutes) / 60)
+		return hours, hours > 0
+	}
+	if match := plainNumberPattern.FindStringSubmatch(s); match != nil {
+		hours, err := ParseDecimal(match[1])
+		return hours, err == nil && hours > 0
+	}
+	return 0, false
+}
+
+// ParsePriceText 从文本中解析单价，取第一个数值，如 50元/小时、￥68.5
+func ParsePriceText(s string) (Money, bool) {
+	match := pricePattern.FindString(s)
+	if match == "" {
+		return 0, false
+	}
+	price, err := ParseMoney(match)
+	return price, err == nil && price > 0
+}
+
+// 支持的时间格式，dateless 表示只有时分，日期取参考时间当天
+var parseTimeLayouts = []struct {
+	layout   string
+	dateless bool
+	yearless bool
+}{
+	{layout: "2006-01-02 15:04:05"},
+	{layout: "2006-01-02 15:04"},
+	{layout: "2006/01/02 15:04:05"},
+	{layout: "2006/01/02 15:04"},
+	{layout: "2006年1月2日 15:04"},
+	{layout: "2006年1月2日15:04"},
+	{layout: "2006-01-02T15:04:05Z07:00"},
+	{layout: "01-02 15:04", yearless: true},
+	{layout: "1/2 15:04", yearless: true},
+	{layout: "1月2日 15:04", yearless: true},
+	{layout: "1月2日15:04", yearless: true},
+	{layout: "1月2号 15:04", yearless: true},
+	{layout: "1月2号15:04", yearless: true},
+	{layout: "15:04:05", dateless: true},
+	{layout: "15:04", dateless: true},
+	{layout: "15点04分", dateless: true},
+	{layout: "15点04", dateless: true},
+	{layout: "15点", dateless: true},
+}
+
+// ParseTimeText 解析时间文本，缺少年份或日期时按参考时间补全；exact 为 false 表示日期是推断的
+func ParseTimeText(s string, ref time.Time) (t time.Time, exact bool, ok bool) {
+	s = strings.TrimSpace(strings.ReplaceAll(s, "：", ":"))
+	for _, item := range parseTimeLayouts {
+		parsed, err := time.ParseInLocation(item.layout, s, ref.Location())
+		if err != nil {
+			continue
+		}
+		switch {
+		case item.dateless:
+			parsed = time.Date(ref.Year(), ref.Month(), ref.Day(), parsed.Hour(), parsed.Minute(), parsed.Second(), 0, ref.Location())
+		case item.yearless:
+			parsed = time.Date(ref.Year(), parsed.Month(), parsed.Day(), parsed.Hour(), parsed.Minute(), parsed.Second(), 0, ref.Location())
+		}
+		return parsed, !item.dateless && !item.yearless, true
+	}
+	return time.Time{}, false, false
+}
+
+// timeRangeSeparator 时间段的分隔符
+var timeRangeSeparator = regexp.MustCompile(`\s*(?:-|~|～|—|至|到)\s*`)
+
+// ParseTimeRangeText 解析时间段，如 2025-07-12 14:00-16:00、14:00~16:00；
+// 结束时间只有时分时取开始时间的日期，早于开始时间时视为跨天
+func ParseTimeRangeText(s string, ref time.Time) (start, end time.Time, exact bool, ok bool) {
+	s = strings.TrimSpace(strings.ReplaceAll(s, "：", ":"))
+	for _, loc := range timeRangeSeparator.FindAllStringIndex(s, -1) {
+		startText, endText := s[:loc[0]], s[loc[1]:]
+		start, startExact, okStart := ParseTimeText(startText, ref)
+		if !okStart {
+			continue
+		}
+		end, endExact, okEnd := ParseTimeText(endText, start)
+		if !okEnd {
+			continue
+		}
+		if !endExact && end.Before(start) {
+			end = end.AddDate(0, 0, 1)
+		}
+		return start, end, startExact, true
+	}
+	return time.Time{}, time.Time{}, false, false
+}
+
+// 报单识别相关请求和响应结构
+type OrderParseRequest struct {
+	Text string `json:"text" binding:"required"`
+}
+
+// OrderParseDraft 识别出的报单内容，字段与 OrderCreateRequest 一致，未识别的字段为空
+type OrderParseDraft struct {
+	CustomerID            *uint      `json:"customer_id"`
+	OrderCategoryID       *uint      `json:"order_category_id"`
+	ProjectCategory       string     `json:"project_category"`
+	StartTime             *time.Time `json:"start_time"`
+	EndTime               *time.Time `json:"end_time"`
+	DurationHours         *Decimal   `json:"duration_hours"`
+	UnitPrice             *Money     `json:"unit_price"`
+	ServiceAdditionalInfo string     `json:"service_additional_info"`
+	OrderNotes            string     `json:"order_notes"`
+}
+
+// OrderParseCandidate 无法唯一确定时的候选项
+type OrderParseCandidate struct {
+	ID    uint   `json:"id"`
+	Label string `json:"label"`
+}
+
+// OrderParseField 单个字段的识别情况，confidence 为 0-1，source 说明取值来源
+type OrderParseField struct {
+	Field      string                `json:"field"`
+	Raw        string                `json:"raw"`
+	Resolved   bool                  `json:"resolved"`
+	Confidence float64               `json:"confidence"`
+	Source     string                `json:"source"`
+	RuleID     uint                  `json:"rule_id,omitempty"`
+	Message    string                `json:"message,omitempty"`
+	Candidates []OrderParseCandidate `json:"candidates,omitempty"`
+}
+
+// OrderParseResult 报单识别结果
+type OrderParseResult struct {
+	Order      OrderParseDraft   `json:"order"`
+	Fields     []OrderParseField `json:"fields"`
+	Unresolved []string          `json:"unresolved"`
+	Warnings   []string          `json:"warnings,omitempty"`
+}
+
+type OrderParseRuleRequest struct {
+	Field       string `json:"field" binding:"required"`
+	Pattern     string `json:"pattern" binding:"required"`
+	Priority    int    `json:"priority"`
+	IsActive    *bool  `json:"is_active"`
+	Description string `json:"description"`
+}
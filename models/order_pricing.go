@@ -0,0 +1,173 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 客户专属折扣类型
+const (
+	ExclusiveDiscountNone  = "无"
+	ExclusiveDiscountRate  = "折扣率"  // 折扣值为应付比例，如 0.88 表示按原价的88%收取
+	ExclusiveDiscountFixed = "固定折扣" // 折扣值为每小时减免的金额
+)
+
+// 订单折扣明细类型
+const (
+	DiscountTypeExclusive = "客户专属折扣"
+	DiscountTypeManual    = "手动折扣"
+)
+
+// 订单单价来源
+const (
+	PriceSourcePriceList = "价目表"
+	PriceSourceManual    = "手动录入"
+)
+
+// ValidateExclusiveDiscount 校验客户专属折扣设置，返回错误提示，合法时返回空字符串
+func ValidateExclusiveDiscount(discountType string, value Decimal) string {
+	switch discountType {
+	case "", ExclusiveDiscountNone:
+		return ""
+	case ExclusiveDiscountRate:
+		if value <= 0 || value >= 100 {
+			return "折扣率必须大于0且小于1"
+		}
+	case ExclusiveDiscountFixed:
+		if value <= 0 {
+			return "固定折扣金额必须大于0"
+		}
+	default:
+		return "无效的专属折扣类型"
+	}
+	return ""
+}
+
+// NormalizeExclusiveDiscount 未设置专属折扣时类型为“无”，折扣值清零
+func NormalizeExclusiveDiscount(discountType string, value Decimal) (string, Decimal) {
+	if discountType == "" || discountType == ExclusiveDiscountNone {
+		return ExclusiveDiscountNone, 0
+	}
+	return discountType, value
+}
+
+// CategoryPrice 订单类别价目表，同一类别可以按陪玩等级等设置多个单价
+type CategoryPrice struct {
+	PriceID         uint           `json:"price_id" gorm:"primaryKey;column:price_id"`
+	OrderCategoryID uint           `json:"order_category_id" gorm:"not null;index;comment:订单类别ID"`
+	PriceName       string         `json:"price_name" gorm:"size:50;not null;comment:价目名称"`
+	UnitPrice       Money          `json:"unit_price" gorm:"type:decimal(10,2);not null;comment:单价（元/小时）"`
+	IsDefault       bool           `json:"is_default" gorm:"default:false;comment:是否为类别默认价目"`
+	IsActive        bool           `json:"is_active" gorm:"default:true;comment:是否启用"`
+	SortOrder       int            `json:"sort_order" gorm:"default:0;comment:排序序号"`
+	Notes           string         `json:"notes" gorm:"type:text;comment:备注"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	DeletedAt       gorm.DeletedAt `json:"-" gorm:"index"`
+
+	// 关联关系
+	Category *OrderCategory `json:"category,omitempty" gorm:"foreignKey:OrderCategoryID"`
+}
+
+// TableName 指定表名
+func (CategoryPrice) TableName() string {
+	return "order_category_prices"
+}
+
+// OrderPriceDiscount 订单折扣明细表，每次计价时按计算结果重写
+type OrderPriceDiscount struct {
+	DiscountID   uint      `json:"discount_id" gorm:"primaryKey;column:discount_id"`
+	OrderID      uint      `json:"order_id" gorm:"not null;index;comment:订单ID"`
+	DiscountType string    `json:"discount_type" gorm:"type:enum('客户专属折扣','手动折扣');not null;comment:折扣类型"`
+	Description  string    `json:"description" gorm:"size:200;comment:折扣说明"`
+	Amount       Money     `json:"amount" gorm:"type:decimal(10,2);not null;comment:折扣金额"`
+	Reason       string    `json:"reason" gorm:"type:text;comment:手动折扣原因"`
+	OperatorID   *uint     `json:"operator_id" gorm:"comment:手动折扣操作人ID"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// TableName 指定表名
+func (OrderPriceDiscount) TableName() string {
+	return "order_price_discounts"
+}
+
+// PriceQuote 订单计价参数
+type PriceQuote struct {
+	UnitPrice              Money
+	DurationHours          Decimal
+	ExclusiveDiscountType  string // 为空或“无”表示不享受专属折扣
+	ExclusiveDiscountValue Decimal
+	ManualDiscount         Money
+}
+
+// PriceBreakdown 订单计价结果
+type PriceBreakdown struct {
+	ListPrice      Money // 原价：单价×时长
+	DiscountAmount Money
+	FinalPrice     Money
+	ManualDiscount Money // 实际生效的手动折扣，超出折后金额的部分不生效
+	Lines          []OrderPriceDiscount
+}
+
+// CalculateOrderPrice 计算订单价格：先按单价和时长得出原价，再依次扣减客户专属折扣和手动折扣，
+// 每一步的折扣不超过剩余金额，最终价格不小于0
+func CalculateOrderPrice(q PriceQuote, mode RoundingMode) PriceBreakdown {
+	result := PriceBreakdown{ListPrice: q.UnitPrice.Mul(q.DurationHours, mode)}
+	remaining := result.ListPrice
+
+	var exclusive Money
+	var description string
+	switch q.ExclusiveDiscountType {
+	case ExclusiveDiscountRate:
+		if q.ExclusiveDiscountValue > 0 && q.ExclusiveDiscountValue < 100 {
+			exclusive = remaining - remaining.Mul(q.ExclusiveDiscountValue, mode)
+			description = fmt.Sprintf("专属折扣率%s", q.ExclusiveDiscountValue)
+		}
+	case ExclusiveDiscountFixed:
+		if q.ExclusiveDiscountValue > 0 {
+			exclusive = Money(q.ExclusiveDiscountValue).Mul(q.DurationHours, mode)
+			description = fmt.Sprintf("每小时减免%s元", Money(q.ExclusiveDiscountValue))
+		}
+	}
+	if exclusive > remaining {
+		exclusive = remaining
+	}
+	if exclusive > 0 {
+		remaining -= exclusive
+		result.Lines = append(result.Lines, OrderPriceDiscount{
+			DiscountType: DiscountTypeExclusive,
+			Description:  description,
+			Amount:       exclusive,
+		})
+	}
+
+	manual := q.ManualDiscount
+	if manual > remaining {
+		manual = remaining
+	}
+	if manual > 0 {
+		remaining -= manual
+		result.ManualDiscount = manual
+		result.Lines = append(result.Lines, OrderPriceDiscount{
+			DiscountType: DiscountTypeManual,
+			Description:  fmt.Sprintf("减免%s元", manual),
+			Amount:       manual,
+		})
+	}
+
+	result.DiscountAmount = result.ListPrice - remaining
+	result.FinalPrice = remaining
+	return result
+}
+
+// CategoryPriceRequest 创建/更新类别价目请求
+type CategoryPriceRequest struct {
+	PriceName string `json:"price_name" binding:"required"`
+	UnitPrice Money  `json:"unit_price" binding:"required"`
+	IsDefault bool   `json:"is_default"` // 设为默认时取消同类别其他价目的默认标记
+	IsActive  *bool  `json:"is_active"`  // 不传时默认启用
+	SortOrder int    `json:"sort_order"`
+	Notes     string `json:"notes"`
+}
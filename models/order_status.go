@@ -0,0 +1,59 @@
+package models
+
+// 订单状态
+const (
+	OrderStatusPending   = "待处理"
+	OrderStatusRejected  = "驳回"
+	OrderStatusConfirmed = "已确认"
+	OrderStatusSettled   = "已结算"
+	OrderStatusCompleted = "已完成"
+	OrderStatusReturned  = "已退回"
+)
+
+// 订单操作类型，对应 OrderApprovalHistory.Action
+const (
+	OrderActionApprove  = "approve"
+	OrderActionReject   = "reject"
+	OrderActionResubmit = "resubmit"
+	OrderActionSettle   = "settle"
+	OrderActionComplete = "complete"
+	OrderActionReturn   = "return"
+)
+
+// OrderTransition 订单状态流转规则
+type OrderTransition struct {
+	From          string `json:"from"`
+	To            string `json:"to"`
+	Action        string `json:"action"`
+	RequireReason bool   `json:"require_reason"`
+}
+
+// OrderTransitions 订单允许的全部状态流转，未列出的流转一律拒绝
+var OrderTransitions = []OrderTransition{
+	{From: OrderStatusPending, To: OrderStatusConfirmed, Action: OrderActionApprove},
+	{From: OrderStatusPending, To: OrderStatusRejected, Action: OrderActionReject, RequireReason: true},
+	{From: OrderStatusRejected, To: OrderStatusPending, Action: OrderActionResubmit},
+	{From: OrderStatusConfirmed, To: OrderStatusSettled, Action: OrderActionSettle},
+	{From: OrderStatusConfirmed, To: OrderStatusReturned, Action: OrderActionReturn, RequireReason: true},
+	{From: OrderStatusSettled, To: OrderStatusCompleted, Action: OrderActionComplete},
+}
+
+// IsValidOrderStatus 检查订单状态是否存在
+func IsValidOrderStatus(status string) bool {
+	switch status {
+	case OrderStatusPending, OrderStatusRejected, OrderStatusConfirmed,
+		OrderStatusSettled, OrderStatusCompleted, OrderStatusReturned:
+		return true
+	}
+	return false
+}
+
+// FindOrderTransition 查找从 from 到 to 的流转规则
+func FindOrderTransition(from, to string) (OrderTransition, bool) {
+	for _, item := range OrderTransitions {
+		if item.From == from && item.To == to {
+			return item, true
+		}
+	}
+	return OrderTransition{}, false
+}
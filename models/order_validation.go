@@ -0,0 +1,91 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// 订单校验错误代码
+const (
+	ValidationRequired         = "required"
+	ValidationEndBeforeStart   = "end_before_start"
+	ValidationDurationMismatch = "duration_mismatch"
+	ValidationDurationTooLong  = "duration_too_long"
+	ValidationFutureEndTime    = "future_end_time"
+	ValidationOverlap          = "overlap"
+	ValidationInvalidAmount    = "invalid_amount"
+)
+
+// FieldError 单个字段的校验错误
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ValidationErrors 一组字段校验错误，实现 error 接口
+type ValidationErrors []FieldError
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, item := range e {
+		messages = append(messages, item.Message)
+	}
+	return strings.Join(messages, "；")
+}
+
+// Add 追加一条字段错误
+func (e *ValidationErrors) Add(field, code, format string, args ...interface{}) {
+	*e = append(*e, FieldError{Field: field, Code: code, Message: fmt.Sprintf(format, args...)})
+}
+
+// OrderTimeRules 订单时间校验规则，来自系统配置
+type OrderTimeRules struct {
+	MaxHours          Decimal       // 单次订单最大时长，0 表示不限制
+	DurationTolerance time.Duration // 陪玩时长与起止时间差允许的误差
+	FutureSkew        time.Duration // 结束时间允许晚于当前时间的幅度
+}
+
+// ValidateOrderTimes 校验订单起止时间和时长：结束时间晚于开始时间、时长与起止时间一致、
+// 不超过最大时长、结束时间不晚于当前时间加允许的偏差
+func ValidateOrderTimes(start, end time.Time, duration Decimal, now time.Time, rules OrderTimeRules) ValidationErrors {
+	var errs ValidationErrors
+	if start.IsZero() {
+		errs.Add("start_time", ValidationRequired, "开始时间不能为空")
+	}
+	if end.IsZero() {
+		errs.Add("end_time", ValidationRequired, "结束时间不能为空")
+	}
+	if duration <= 0 {
+		errs.Add("duration_hours", ValidationInvalidAmount, "陪玩时长必须大于0")
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	if !end.After(start) {
+		errs.Add("end_time", ValidationEndBeforeStart, "结束时间必须晚于开始时间")
+	} else {
+		span := end.Sub(start)
+		claimed := time.Duration(int64(duration) * int64(time.Hour) / 100)
+		diff := claimed - span
+		if diff < 0 {
+			diff = -diff
+		}
+		if diff > rules.DurationTolerance {
+			errs.Add("duration_hours", ValidationDurationMismatch,
+				"陪玩时长%s小时与起止时间（%.2f小时）不一致", duration, span.Hours())
+		}
+		if rules.MaxHours > 0 && span > time.Duration(int64(rules.MaxHours)*int64(time.Hour)/100) {
+			errs.Add("end_time", ValidationDurationTooLong, "订单时长不能超过%s小时", rules.MaxHours)
+		}
+	}
+	if rules.MaxHours > 0 && duration > rules.MaxHours {
+		errs.Add("duration_hours", ValidationDurationTooLong, "陪玩时长不能超过%s小时", rules.MaxHours)
+	}
+	if end.After(now.Add(rules.FutureSkew)) {
+		errs.Add("end_time", ValidationFutureEndTime, "结束时间不能晚于当前时间")
+	}
+	return errs
+}
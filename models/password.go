@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+)
+
+// PasswordHistory 密码历史表，用于禁止重复使用近期密码
+type PasswordHistory struct {
+	HistoryID    uint      `json:"history_id" gorm:"primaryKey;column:history_id"`
+	SubjectType  string    `json:"subject_type" gorm:"type:enum('staff','customer');not null;index:idx_password_history_subject;comment:主体类型"`
+	SubjectID    uint      `json:"subject_id" gorm:"not null;index:idx_password_history_subject;comment:内部成员ID或客户ID"`
+	PasswordHash string    `json:"-" gorm:"size:255;not null;comment:密码哈希值"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// TableName 指定表名
+func (PasswordHistory) TableName() string {
+	return "password_histories"
+}
+
+// PasswordChangeChallengeResponse 需要先修改密码时的登录响应
+type PasswordChangeChallengeResponse struct {
+	PasswordChangeRequired bool   `json:"password_change_required"`
+	ChallengeToken         string `json:"challenge_token"`
+	ExpiresIn              int64  `json:"expires_in"`
+}
+
+// LoginChangePasswordRequest 登录时强制修改密码请求
+type LoginChangePasswordRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	NewPassword    string `json:"new_password" binding:"required"`
+}
+
+// PasswordPolicyResponse 当前密码策略，供前端提示
+type PasswordPolicyResponse struct {
+	MinLength     int  `json:"min_length"`
+	RequireUpper  bool `json:"require_upper"`
+	RequireLower  bool `json:"require_lower"`
+	RequireDigit  bool `json:"require_digit"`
+	RequireSymbol bool `json:"require_symbol"`
+	HistoryCount  int  `json:"history_count"`
+}
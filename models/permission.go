@@ -0,0 +1,112 @@
+package models
+
+import (
+	"time"
+)
+
+// 角色定义
+const (
+	RoleSuperAdmin = "超级管理员"
+	RoleAdmin      = "普通管理员"
+	RolePlaymate   = "陪玩"
+	RoleCustomer   = "customer"
+)
+
+// 权限代码定义
+const (
+	PermMemberManage     = "member:manage"
+	PermCustomerView     = "customer:view"
+	PermCustomerManage   = "customer:manage"
+	PermCustomerRecharge = "customer:recharge"
+	PermCustomerSelf     = "customer:self"
+	PermCategoryView     = "category:view"
+	PermCategoryManage   = "category:manage"
+	PermOrderReport      = "order:report"
+	PermOrderViewAll     = "order:view_all"
+	PermOrderAudit       = "order:audit"
+	PermOrderSettings    = "order:settings"
+	PermOrderDiscount    = "order:discount"
+	PermConfigManage     = "config:manage"
+	PermLogView          = "log:view"
+	PermPermissionManage = "permission:manage"
+	PermSessionManage    = "session:manage"
+	PermSettlementManage = "settlement:manage"
+)
+
+// PermissionDefinition 权限说明
+type PermissionDefinition struct {
+	Code        string `json:"code"`
+	Description string `json:"description"`
+}
+
+// PermissionCatalog 系统支持的全部权限
+var PermissionCatalog = []PermissionDefinition{
+	{Code: PermMemberManage, Description: "内部成员管理"},
+	{Code: PermCustomerView, Description: "查看客户信息"},
+	{Code: PermCustomerManage, Description: "客户信息管理"},
+	{Code: PermCustomerRecharge, Description: "客户充值"},
+	{Code: PermCustomerSelf, Description: "客户自助服务"},
+	{Code: PermCategoryView, Description: "查看订单类别"},
+	{Code: PermCategoryManage, Description: "订单类别管理"},
+	{Code: PermOrderReport, Description: "陪玩报单"},
+	{Code: PermOrderViewAll, Description: "查看全部订单"},
+	{Code: PermOrderAudit, Description: "订单审核"},
+	{Code: PermOrderSettings, Description: "报单设置"},
+	{Code: PermOrderDiscount, Description: "订单手动折扣"},
+	{Code: PermConfigManage, Description: "系统配置管理"},
+	{Code: PermLogView, Description: "查看操作日志"},
+	{Code: PermPermissionManage, Description: "角色权限管理"},
+	{Code: PermSessionManage, Description: "登录会话管理"},
+	{Code: PermSettlementManage, Description: "提成结算管理"},
+}
+
+// DefaultRolePermissions 各角色的默认权限，用于初始化数据
+var DefaultRolePermissions = map[string][]string{
+	RoleAdmin: {
+		PermCustomerView, PermCustomerManage, PermCustomerRecharge,
+		PermCategoryView, PermCategoryManage,
+		PermOrderReport, PermOrderViewAll, PermOrderAudit, PermOrderSettings, PermOrderDiscount,
+		PermLogView, PermSettlementManage,
+	},
+	RolePlaymate: {
+		PermCustomerView, PermCategoryView,
+	},
+	RoleCustomer: {
+		PermCustomerSelf,
+	},
+}
+
+// IsValidPermission 检查权限代码是否存在
+func IsValidPermission(code string) bool {
+	for _, item := range PermissionCatalog {
+		if item.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// RolePermission 角色权限表
+type RolePermission struct {
+	RolePermissionID uint      `json:"role_permission_id" gorm:"primaryKey;column:role_permission_id"`
+	RoleName         string    `json:"role_name" gorm:"size:50;not null;uniqueIndex:idx_role_permission;comment:角色名称"`
+	PermissionCode   string    `json:"permission_code" gorm:"size:100;not null;uniqueIndex:idx_role_permission;comment:权限代码"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (RolePermission) TableName() string {
+	return "role_permissions"
+}
+
+// RolePermissionsUpdateRequest 更新角色权限请求
+type RolePermissionsUpdateRequest struct {
+	Permissions []string `json:"permissions" binding:"required"`
+}
+
+// RolePermissionsResponse 角色权限响应
+type RolePermissionsResponse struct {
+	RoleName    string   `json:"role_name"`
+	Permissions []string `json:"permissions"`
+}
@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+// 退款方式
+const (
+	RefundMethodBalance  = "退回余额"
+	RefundMethodExternal = "原路退回"
+)
+
+// OrderRefund 订单退款记录表，每次退款一条，只增不改
+type OrderRefund struct {
+	RefundID          uint      `json:"refund_id" gorm:"primaryKey;column:refund_id"`
+	OrderID           uint      `json:"order_id" gorm:"not null;index;comment:订单ID"`
+	CustomerID        uint      `json:"customer_id" gorm:"not null;index;comment:客户ID"`
+	ActionID          uint      `json:"action_id" gorm:"comment:关联的订单操作历史ID"`
+	Amount            Money     `json:"amount" gorm:"type:decimal(10,2);not null;comment:退款金额"`
+	GiftAmount        Money     `json:"gift_amount" gorm:"type:decimal(10,2);default:0.00;comment:其中退回赠送余额的部分"`
+	RefundMethod      string    `json:"refund_method" gorm:"type:enum('退回余额','原路退回');not null;comment:退款方式"`
+	ExternalReference string    `json:"external_reference" gorm:"size:100;comment:外部退款流水号"`
+	BalanceAfter      *Money    `json:"balance_after" gorm:"type:decimal(10,2);comment:退回余额后的客户余额"`
+	LedgerEntryID     *uint     `json:"ledger_entry_id" gorm:"comment:退回余额对应的钱包流水ID"`
+	Reason            string    `json:"reason" gorm:"type:text;comment:退款原因"`
+	OperatorID        uint      `json:"operator_id" gorm:"not null;comment:操作人ID"`
+	RefundedAt        time.Time `json:"refunded_at" gorm:"comment:退款时间"`
+	CreatedAt         time.Time `json:"created_at"`
+
+	// 关联关系
+	Order    *PlaymateOrder  `json:"order,omitempty" gorm:"foreignKey:OrderID"`
+	Operator *InternalMember `json:"operator,omitempty" gorm:"foreignKey:OperatorID"`
+}
+
+// TableName 指定表名
+func (OrderRefund) TableName() string {
+	return "order_refunds"
+}
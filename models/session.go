@@ -0,0 +1,67 @@
+package models
+
+import (
+	"time"
+)
+
+// UserSession 登录会话表，内部成员与客户共用，通过 SubjectType 区分
+type UserSession struct {
+	SessionID      uint       `json:"session_id" gorm:"primaryKey;column:session_id"`
+	TokenID        string     `json:"-" gorm:"size:64;uniqueIndex;not null;comment:会话令牌ID"`
+	SubjectType    string     `json:"subject_type" gorm:"type:enum('staff','customer');not null;index:idx_session_subject;comment:主体类型"`
+	SubjectID      uint       `json:"subject_id" gorm:"not null;index:idx_session_subject;comment:主体ID"`
+	RefreshTokenID string     `json:"-" gorm:"size:64;comment:当前有效的刷新令牌ID"`
+	LoginIP        string     `json:"login_ip" gorm:"size:45;comment:登录IP"`
+	UserAgent      string     `json:"user_agent" gorm:"type:text;comment:用户代理信息"`
+	LastActiveAt   time.Time  `json:"last_active_at" gorm:"comment:最近活跃时间"`
+	ExpiresAt      time.Time  `json:"expires_at" gorm:"comment:会话过期时间"`
+	RevokedAt      *time.Time `json:"revoked_at" gorm:"comment:注销时间"`
+	RevokeReason   string     `json:"revoke_reason" gorm:"size:100;comment:注销原因"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (UserSession) TableName() string {
+	return "user_sessions"
+}
+
+// IsActive 判断会话是否仍然有效
+func (s *UserSession) IsActive(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
+
+// 会话注销原因
+const (
+	SessionRevokeLogout        = "主动登出"
+	SessionRevokeLogoutAll     = "登出全部设备"
+	SessionRevokeAdmin         = "管理员注销"
+	SessionRevokeRefreshReuse  = "刷新令牌重复使用"
+	SessionRevokeAccountOff    = "账户已禁用"
+	SessionRevokeAccountDelete = "账户已删除"
+	SessionRevokePasswordReset = "需修改密码"
+	SessionRevokeTwoFactor     = "需启用两步验证"
+)
+
+// SessionListRequest 会话查询请求
+type SessionListRequest struct {
+	SubjectType string `json:"subject_type" form:"subject_type" binding:"required"`
+	SubjectID   uint   `json:"subject_id" form:"subject_id" binding:"required"`
+}
+
+// RevokeSubjectSessionsRequest 注销指定用户全部会话请求
+type RevokeSubjectSessionsRequest struct {
+	SubjectType string `json:"subject_type" binding:"required"`
+	SubjectID   uint   `json:"subject_id" binding:"required"`
+}
+
+// AuthTokenResponse 登录、注册和刷新令牌的统一响应，内部成员与客户共用
+type AuthTokenResponse struct {
+	AccessToken   string      `json:"access_token"`
+	RefreshToken  string      `json:"refresh_token"`
+	TokenType     string      `json:"token_type"` // 固定为 Bearer
+	ExpiresIn     int64       `json:"expires_in"` // 访问令牌有效期（秒）
+	SubjectType   string      `json:"subject_type"`
+	User          interface{} `json:"user"`                     // 内部成员为 InternalMember，客户为 Customer
+	RecoveryCodes []string    `json:"recovery_codes,omitempty"` // 登录时完成两步验证绑定才返回
+}
@@ -0,0 +1,179 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 结算单支付状态
+const (
+	SettlementStatusUnpaid = "未支付"
+	SettlementStatusPaid   = "已支付"
+)
+
+// 提成比例来源
+const (
+	CommissionSourceOverride = "override" // 成员+订单类别的单独设置
+	CommissionSourceMember   = "member"   // MemberFinancialSettings.CommissionRate
+	CommissionSourceCategory = "category" // OrderCategory.CommissionRate
+	CommissionSourceDefault  = "default"  // 系统配置 default_commission_rate
+)
+
+// DefaultCommissionPrecedence 默认的提成比例取值顺序
+var DefaultCommissionPrecedence = []string{
+	CommissionSourceOverride, CommissionSourceMember, CommissionSourceCategory, CommissionSourceDefault,
+}
+
+// ParseCommissionPrecedence 解析逗号分隔的提成比例取值顺序，忽略无法识别的来源，结果为空时使用默认顺序
+func ParseCommissionPrecedence(s string) []string {
+	var precedence []string
+	seen := make(map[string]bool)
+	for _, item := range strings.Split(s, ",") {
+		source := strings.TrimSpace(item)
+		switch source {
+		case CommissionSourceOverride, CommissionSourceMember, CommissionSourceCategory, CommissionSourceDefault:
+			if !seen[source] {
+				seen[source] = true
+				precedence = append(precedence, source)
+			}
+		}
+	}
+	if len(precedence) == 0 {
+		return DefaultCommissionPrecedence
+	}
+	return precedence
+}
+
+// ResolveCommissionRate 按取值顺序选出第一个已设置的提成比例，rates 中只包含已设置的来源
+func ResolveCommissionRate(precedence []string, rates map[string]Decimal) (Decimal, string, bool) {
+	for _, source := range precedence {
+		if rate, ok := rates[source]; ok {
+			return rate, source, true
+		}
+	}
+	return 0, "", false
+}
+
+// CommissionOverride 提成比例单独设置表，针对某个成员在某个订单类别上的提成比例
+type CommissionOverride struct {
+	OverrideID      uint           `json:"override_id" gorm:"primaryKey;column:override_id"`
+	MemberID        uint           `json:"member_id" gorm:"not null;uniqueIndex:idx_commission_override;comment:成员ID"`
+	OrderCategoryID uint           `json:"order_category_id" gorm:"not null;uniqueIndex:idx_commission_override;comment:订单类别ID"`
+	CommissionRate  Decimal        `json:"commission_rate" gorm:"type:decimal(5,2);not null;comment:提成比例"`
+	Notes           string         `json:"notes" gorm:"type:text;comment:备注"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	DeletedAt       gorm.DeletedAt `json:"-" gorm:"index"`
+
+	// 关联关系
+	Member   *InternalMember `json:"member,omitempty" gorm:"foreignKey:MemberID"`
+	Category *OrderCategory  `json:"category,omitempty" gorm:"foreignKey:OrderCategoryID"`
+}
+
+// TableName 指定表名
+func (CommissionOverride) TableName() string {
+	return "commission_overrides"
+}
+
+// SettlementBatch 提成结算单，每个成员每个结算周期一张
+type SettlementBatch struct {
+	BatchID          uint       `json:"batch_id" gorm:"primaryKey;column:batch_id"`
+	MemberID         uint       `json:"member_id" gorm:"not null;index;comment:结算成员ID"`
+	PeriodStart      time.Time  `json:"period_start" gorm:"type:date;not null;comment:结算周期开始日期"`
+	PeriodEnd        time.Time  `json:"period_end" gorm:"type:date;not null;comment:结算周期结束日期"`
+	OrderCount       int        `json:"order_count" gorm:"comment:订单数"`
+	TotalOrderAmount Money      `json:"total_order_amount" gorm:"type:decimal(10,2);default:0.00;comment:订单总额"`
+	TotalCommission  Money      `json:"total_commission" gorm:"type:decimal(10,2);default:0.00;comment:提成合计"`
+	AdjustmentAmount Money      `json:"adjustment_amount" gorm:"type:decimal(10,2);default:0.00;comment:调整合计，扣款为负"`
+	PayableAmount    Money      `json:"payable_amount" gorm:"type:decimal(10,2);default:0.00;comment:应付金额"`
+	Status           string     `json:"status" gorm:"type:enum('未支付','已支付');default:'未支付';comment:支付状态"`
+	PaymentReference string     `json:"payment_reference" gorm:"size:100;comment:付款流水号"`
+	PaidAt           *time.Time `json:"paid_at" gorm:"comment:付款时间"`
+	PaidBy           *uint      `json:"paid_by" gorm:"comment:付款操作人ID"`
+	CreatorID        uint       `json:"creator_id" gorm:"not null;comment:创建人ID"`
+	Notes            string     `json:"notes" gorm:"type:text;comment:备注"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+
+	// 关联关系
+	Member      *InternalMember        `json:"member,omitempty" gorm:"foreignKey:MemberID"`
+	Creator     *InternalMember        `json:"creator,omitempty" gorm:"foreignKey:CreatorID"`
+	Items       []SettlementItem       `json:"items,omitempty" gorm:"foreignKey:BatchID"`
+	Adjustments []SettlementAdjustment `json:"adjustments,omitempty" gorm:"foreignKey:BatchID"`
+}
+
+// TableName 指定表名
+func (SettlementBatch) TableName() string {
+	return "settlement_batches"
+}
+
+// SettlementItem 结算单明细，每个订单只能结算一次
+type SettlementItem struct {
+	ItemID           uint      `json:"item_id" gorm:"primaryKey;column:item_id"`
+	BatchID          uint      `json:"batch_id" gorm:"not null;index;comment:结算单ID"`
+	OrderID          uint      `json:"order_id" gorm:"uniqueIndex;not null;comment:订单ID"`
+	OrderAmount      Money     `json:"order_amount" gorm:"type:decimal(10,2);not null;comment:订单金额"`
+	CommissionRate   Decimal   `json:"commission_rate" gorm:"type:decimal(5,2);not null;comment:提成比例"`
+	RateSource       string    `json:"rate_source" gorm:"size:20;comment:提成比例来源"`
+	CommissionAmount Money     `json:"commission_amount" gorm:"type:decimal(10,2);not null;comment:提成金额"`
+	CreatedAt        time.Time `json:"created_at"`
+
+	// 关联关系
+	Order *PlaymateOrder `json:"order,omitempty" gorm:"foreignKey:OrderID"`
+}
+
+// TableName 指定表名
+func (SettlementItem) TableName() string {
+	return "settlement_items"
+}
+
+// SettlementAdjustment 结算单调整项，正数为补发，负数为扣款
+type SettlementAdjustment struct {
+	AdjustmentID uint      `json:"adjustment_id" gorm:"primaryKey;column:adjustment_id"`
+	BatchID      uint      `json:"batch_id" gorm:"not null;index;comment:结算单ID"`
+	Amount       Money     `json:"amount" gorm:"type:decimal(10,2);not null;comment:调整金额"`
+	Reason       string    `json:"reason" gorm:"type:text;not null;comment:调整原因"`
+	OperatorID   uint      `json:"operator_id" gorm:"not null;comment:操作人ID"`
+	CreatedAt    time.Time `json:"created_at"`
+
+	// 关联关系
+	Operator *InternalMember `json:"operator,omitempty" gorm:"foreignKey:OperatorID"`
+}
+
+// TableName 指定表名
+func (SettlementAdjustment) TableName() string {
+	return "settlement_adjustments"
+}
+
+// 结算相关请求结构
+type SettlementCreateRequest struct {
+	MemberID    uint   `json:"member_id" binding:"required"`
+	PeriodStart string `json:"period_start" binding:"required"` // YYYY-MM-DD，按审批通过日期筛选订单
+	PeriodEnd   string `json:"period_end" binding:"required"`
+	Notes       string `json:"notes"`
+}
+
+type SettlementFilterRequest struct {
+	PageRequest
+	MemberID uint   `json:"member_id" form:"member_id"`
+	Status   string `json:"status" form:"status"`
+}
+
+type SettlementAdjustmentRequest struct {
+	Amount Money  `json:"amount" binding:"required"` // 正数补发，负数扣款
+	Reason string `json:"reason" binding:"required"`
+}
+
+type SettlementPayRequest struct {
+	PaymentReference string `json:"payment_reference" binding:"required"`
+	Notes            string `json:"notes"`
+}
+
+type CommissionOverrideRequest struct {
+	MemberID        uint    `json:"member_id" binding:"required"`
+	OrderCategoryID uint    `json:"order_category_id" binding:"required"`
+	CommissionRate  Decimal `json:"commission_rate"`
+	Notes           string  `json:"notes"`
+}
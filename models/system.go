@@ -70,8 +70,11 @@ type PageResponse struct {
 
 // 常量定义
 const (
-	StatusSuccess   = 200
-	StatusError     = 500
-	StatusForbidden = 403
-	StatusNotFound  = 404
+	StatusSuccess       = 200
+	StatusError         = 500
+	StatusForbidden     = 403
+	StatusNotFound      = 404
+	StatusConflict      = 409
+	StatusUnprocessable = 422
+	StatusTooMany       = 429
 )
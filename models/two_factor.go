@@ -0,0 +1,71 @@
+package models
+
+import (
+	"time"
+)
+
+// MemberRecoveryCode 两步验证恢复码表，仅保存哈希
+type MemberRecoveryCode struct {
+	RecoveryCodeID uint       `json:"recovery_code_id" gorm:"primaryKey;column:recovery_code_id"`
+	MemberID       uint       `json:"member_id" gorm:"not null;index;comment:成员ID"`
+	CodeHash       string     `json:"-" gorm:"size:64;not null;comment:恢复码哈希"`
+	UsedAt         *time.Time `json:"used_at" gorm:"comment:使用时间"`
+	CreatedAt      time.Time  `json:"created_at"`
+
+	// 关联关系
+	Member *InternalMember `json:"member,omitempty" gorm:"foreignKey:MemberID"`
+}
+
+// TableName 指定表名
+func (MemberRecoveryCode) TableName() string {
+	return "member_recovery_codes"
+}
+
+// TwoFactorChallengeResponse 密码验证通过后需要两步验证时的登录响应
+type TwoFactorChallengeResponse struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	SetupRequired     bool   `json:"setup_required"` // 角色要求两步验证但尚未绑定，需先调用绑定接口
+	ChallengeToken    string `json:"challenge_token"`
+	ExpiresIn         int64  `json:"expires_in"`
+}
+
+// TwoFactorLoginRequest 两步验证登录请求，验证码和恢复码二选一
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code"`
+	RecoveryCode   string `json:"recovery_code"`
+}
+
+// TwoFactorChallengeRequest 仅携带登录挑战令牌的请求
+type TwoFactorChallengeRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+}
+
+// TwoFactorSetupResponse 两步验证绑定信息
+type TwoFactorSetupResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"` // otpauth URI，可直接生成二维码
+}
+
+// TwoFactorCodeRequest 提交验证码请求
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// TwoFactorDisableRequest 关闭两步验证请求
+type TwoFactorDisableRequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// TwoFactorStatusResponse 两步验证状态
+type TwoFactorStatusResponse struct {
+	Enabled                bool  `json:"enabled"`
+	Required               bool  `json:"required"`
+	RecoveryCodesRemaining int64 `json:"recovery_codes_remaining"`
+}
+
+// RecoveryCodesResponse 恢复码，仅在生成时返回一次
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
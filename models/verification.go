@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+)
+
+// 短信验证码用途
+const (
+	SMSPurposeVerifyPhone = "verify_phone" // 绑定手机号验证
+	SMSPurposeLogin       = "login"        // 手机号验证码登录
+)
+
+// SMSVerificationCode 短信验证码表，仅保存哈希
+type SMSVerificationCode struct {
+	VerificationID uint       `json:"verification_id" gorm:"primaryKey;column:verification_id"`
+	PhoneNumber    string     `json:"phone_number" gorm:"size:20;not null;index;comment:手机号码"`
+	Purpose        string     `json:"purpose" gorm:"type:enum('verify_phone','login');not null;comment:用途"`
+	CustomerID     uint       `json:"customer_id" gorm:"not null;index;comment:客户ID"`
+	CodeHash       string     `json:"-" gorm:"size:64;not null;comment:验证码哈希"`
+	ExpiresAt      time.Time  `json:"expires_at" gorm:"not null;comment:过期时间"`
+	Attempts       int        `json:"attempts" gorm:"default:0;comment:校验失败次数"`
+	UsedAt         *time.Time `json:"used_at" gorm:"comment:使用时间"`
+	SendIP         string     `json:"send_ip" gorm:"size:45;index;comment:请求发送的IP"`
+	CreatedAt      time.Time  `json:"created_at"`
+
+	// 关联关系
+	Customer *Customer `json:"customer,omitempty" gorm:"foreignKey:CustomerID"`
+}
+
+// TableName 指定表名
+func (SMSVerificationCode) TableName() string {
+	return "sms_verification_codes"
+}
+
+// VerifyPhoneRequest 手机号验证请求
+type VerifyPhoneRequest struct {
+	Code string `json:"code" binding:"required,len=6"`
+}
+
+// SendLoginSMSRequest 发送登录验证码请求
+type SendLoginSMSRequest struct {
+	PhoneNumber string `json:"phone_number" binding:"required"`
+}
+
+// SMSLoginRequest 手机号验证码登录请求
+type SMSLoginRequest struct {
+	PhoneNumber string `json:"phone_number" binding:"required"`
+	Code        string `json:"code" binding:"required,len=6"`
+}
+
+// SMSSendResponse 发送验证码响应
+type SMSSendResponse struct {
+	ExpiresIn int64 `json:"expires_in"` // 验证码有效期（秒）
+	Interval  int64 `json:"interval"`   // 再次发送的最短间隔（秒）
+}
@@ -1,8 +1,11 @@
 package router
 
 import (
+	"log"
+	"tangsong-esports/config"
 	"tangsong-esports/controllers"
 	"tangsong-esports/middleware"
+	"tangsong-esports/models"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -13,6 +16,11 @@ import (
 func InitRouter() *gin.Engine {
 	r := gin.New()
 
+	// 只信任配置的反向代理，防止客户端伪造 X-Forwarded-For 绕过按IP的登录锁定和短信限流
+	if err := r.SetTrustedProxies(config.AppConfig.TrustedProxies); err != nil {
+		log.Fatal("受信任代理配置无效:", err)
+	}
+
 	// 中间件
 	r.Use(gin.Logger())
 	r.Use(gin.Recovery())
@@ -21,7 +29,7 @@ func InitRouter() *gin.Engine {
 	config := cors.DefaultConfig()
 	config.AllowAllOrigins = true
 	config.AllowMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
-	config.AllowHeaders = []string{"Origin", "Content-Length", "Content-Type", "Authorization"}
+	config.AllowHeaders = []string{"Origin", "Content-Length", "Content-Type", "Authorization", middleware.IdempotencyKeyHeader}
 	r.Use(cors.New(config))
 
 	// Swagger 文档
@@ -36,86 +44,202 @@ func InitRouter() *gin.Engine {
 			// 内部员工认证
 			public.POST("/login", controllers.Login)
 			public.POST("/refresh", controllers.RefreshToken)
+			public.POST("/login/2fa", controllers.LoginTwoFactor)
+			public.POST("/login/2fa/setup", controllers.LoginTwoFactorSetup)
+			public.POST("/login/change-password", controllers.LoginChangePassword)
+			public.GET("/password-policy", controllers.GetPasswordPolicy)
 
 			// 客户认证
 			public.POST("/customer/register", controllers.CustomerRegister)
 			public.POST("/customer/login", controllers.CustomerLogin)
 			public.POST("/customer/refresh", controllers.CustomerRefreshToken)
+			public.POST("/customer/login/sms/send", controllers.SendLoginSMS)
+			public.POST("/customer/login/sms", controllers.CustomerSMSLogin)
 			public.POST("/customer/set-password", controllers.CustomerSetPassword)
+
+			// 上传文件（凭签名链接访问）
+			public.GET("/files/*key", controllers.ServeFile)
 		}
 
-		// 受保护路由（需要认证）
+		// 客户路由（仅接受客户令牌）
+		customerSelf := api.Group("/customer")
+		customerSelf.Use(middleware.CustomerAuthMiddleware())
+		customerSelf.Use(middleware.RequirePermission(models.PermCustomerSelf))
+		{
+			customerSelf.GET("/profile", controllers.GetCustomerProfile)
+			customerSelf.PUT("/profile", controllers.UpdateCustomerProfile)
+			customerSelf.GET("/balance", controllers.GetCustomerBalance)
+			customerSelf.GET("/ledger", controllers.GetMyLedger)
+			customerSelf.POST("/reset-password", controllers.CustomerResetPassword)
+			// 手机号验证
+			customerSelf.POST("/phone/send-code", controllers.SendPhoneVerificationCode)
+			customerSelf.POST("/phone/verify", controllers.VerifyPhone)
+			// 客户查看自己的订单
+			customerSelf.GET("/orders", controllers.GetCustomerOrders)
+			// 客户查看自己的登录记录
+			customerSelf.GET("/login-logs", controllers.GetMyCustomerLoginLogs)
+			// 客户登出
+			customerSelf.POST("/logout", controllers.Logout)
+			customerSelf.POST("/logout-all", controllers.LogoutAll)
+		}
+
+		// 受保护路由（仅接受内部成员令牌）
 		protected := api.Group("")
-		protected.Use(middleware.AuthMiddleware())
+		protected.Use(middleware.StaffAuthMiddleware())
 		{
+			// 携带 Idempotency-Key 的重试请求返回首次响应，用于充值、报单和审批等不可重复执行的操作
+			idempotent := middleware.Idempotency()
+
+			// 登出
+			protected.POST("/logout", controllers.Logout)
+			protected.POST("/logout-all", controllers.LogoutAll)
+
+			// 两步验证
+			twoFactor := protected.Group("/2fa")
+			{
+				twoFactor.GET("", controllers.GetTwoFactorStatus)
+				twoFactor.POST("/setup", controllers.SetupTwoFactor)
+				twoFactor.POST("/enable", controllers.EnableTwoFactor)
+				twoFactor.POST("/disable", controllers.DisableTwoFactor)
+				twoFactor.POST("/recovery-codes", controllers.RegenerateRecoveryCodes)
+			}
+
+			// 会话管理
+			sessions := protected.Group("/sessions")
+			sessions.Use(middleware.RequirePermission(models.PermSessionManage))
+			{
+				sessions.GET("", controllers.GetSessions)
+				sessions.POST("/:id/revoke", controllers.RevokeSessionByID)
+				sessions.POST("/revoke-all", controllers.RevokeSubjectSessions)
+			}
+
+			// 登录锁定管理
+			protected.POST("/login-locks/unlock", middleware.RequirePermission(models.PermSessionManage), controllers.UnlockLogin)
+
+			// 权限管理
+			protected.GET("/permissions/me", controllers.GetMyPermissions)
+			permissions := protected.Group("/permissions")
+			permissions.Use(middleware.RequirePermission(models.PermPermissionManage))
+			{
+				permissions.GET("", controllers.GetPermissionCatalog)
+				permissions.GET("/roles", controllers.GetRolePermissions)
+				permissions.PUT("/roles/:role", controllers.UpdateRolePermissions)
+			}
+
 			// 内部成员管理
 			members := protected.Group("/members")
+			members.Use(middleware.RequirePermission(models.PermMemberManage))
 			{
 				members.GET("", controllers.GetMembers)
 				members.POST("", controllers.CreateMember)
 				members.PUT("/:id", controllers.UpdateMember)
 				members.DELETE("/:id", controllers.DeleteMember)
 				members.GET("/:id", controllers.GetMemberByID)
+				members.POST("/:id/2fa/reset", controllers.ResetMemberTwoFactor)
 			}
 
 			// 客户管理
 			customers := protected.Group("/customers")
 			{
-				customers.GET("", controllers.GetCustomers)
-				customers.POST("", controllers.CreateCustomer)
-				customers.PUT("/:id", controllers.UpdateCustomer)
-				customers.DELETE("/:id", controllers.DeleteCustomer)
-				customers.GET("/:id", controllers.GetCustomerByID)
-				customers.POST("/:id/recharge", controllers.RechargeCustomer)
-				customers.GET("/:id/recharge-history", controllers.GetCustomerRechargeHistory)
-				customers.POST("/reset-password", controllers.AdminResetCustomerPassword)
-			}
+				customerView := middleware.RequirePermission(models.PermCustomerView, models.PermCustomerManage)
+				customerManage := middleware.RequirePermission(models.PermCustomerManage)
+				customerRecharge := middleware.RequirePermission(models.PermCustomerRecharge)
 
-			// 客户个人信息
-			protected.GET("/customer/profile", controllers.GetCustomerProfile)
-			protected.PUT("/customer/profile", controllers.UpdateCustomerProfile)
-			protected.GET("/customer/balance", controllers.GetCustomerBalance)
-			protected.POST("/customer/reset-password", controllers.CustomerResetPassword)
-			// 客户查看自己的订单
-			protected.GET("/customer/orders", controllers.GetCustomerOrders)
+				customers.GET("", customerView, controllers.GetCustomers)
+				customers.POST("", customerManage, controllers.CreateCustomer)
+				customers.PUT("/:id", customerManage, controllers.UpdateCustomer)
+				customers.DELETE("/:id", customerManage, controllers.DeleteCustomer)
+				customers.GET("/:id", customerView, controllers.GetCustomerByID)
+				customers.POST("/:id/recharge", customerRecharge, idempotent, controllers.RechargeCustomer)
+				customers.GET("/:id/recharge-history", customerView, controllers.GetCustomerRechargeHistory)
+				customers.GET("/:id/ledger", customerView, controllers.GetCustomerLedger)
+				customers.GET("/:id/ledger/reconcile", customerView, controllers.ReconcileCustomerLedger)
+				customers.POST("/:id/ledger/adjustments", customerRecharge, controllers.AdjustCustomerBalance)
+				customers.POST("/:id/ledger/:entryId/reverse", customerRecharge, controllers.ReverseLedgerEntry)
+				customers.GET("/:id/activation-codes", customerManage, controllers.GetCustomerActivationCodes)
+				customers.POST("/reset-password", customerManage, controllers.AdminResetCustomerPassword)
+			}
 
 			// 订单类别管理
 			categories := protected.Group("/order-categories")
 			{
-				categories.GET("", controllers.GetOrderCategories)
-				categories.POST("", controllers.CreateOrderCategory)
-				categories.PUT("/:id", controllers.UpdateOrderCategory)
-				categories.DELETE("/:id", controllers.DeleteOrderCategory)
+				categoryManage := middleware.RequirePermission(models.PermCategoryManage)
+
+				categories.GET("", middleware.RequirePermission(models.PermCategoryView, models.PermCategoryManage), controllers.GetOrderCategories)
+				categories.POST("", categoryManage, controllers.CreateOrderCategory)
+				categories.PUT("/:id", categoryManage, controllers.UpdateOrderCategory)
+				categories.DELETE("/:id", categoryManage, controllers.DeleteOrderCategory)
+				categories.GET("/:id/prices", middleware.RequirePermission(models.PermCategoryView, models.PermCategoryManage), controllers.GetCategoryPrices)
+				categories.POST("/:id/prices", categoryManage, controllers.CreateCategoryPrice)
+				categories.PUT("/:id/prices/:price_id", categoryManage, controllers.UpdateCategoryPrice)
+				categories.DELETE("/:id/prices/:price_id", categoryManage, controllers.DeleteCategoryPrice)
 			}
 
 			// 陪玩报单管理
 			orders := protected.Group("/orders")
 			{
-				orders.GET("", controllers.GetOrders)
-				orders.POST("", controllers.CreateOrder)
-				orders.PUT("/:id", controllers.UpdateOrder)
-				orders.GET("/:id", controllers.GetOrderByID)
-				orders.PUT("/:id/status", controllers.UpdateOrderStatus)
-				orders.POST("/:id/images", controllers.UploadOrderImages)
-				orders.GET("/stats", controllers.GetOrderStats)
+				orderView := middleware.RequirePermission(models.PermOrderReport, models.PermOrderViewAll)
+				orderReport := middleware.RequirePermission(models.PermOrderReport)
+
+				orders.GET("", orderView, controllers.GetOrders)
+				orders.POST("", orderReport, idempotent, controllers.CreateOrder)
+				orders.PUT("/:id", orderReport, controllers.UpdateOrder)
+				orders.GET("/:id", orderView, controllers.GetOrderByID)
+				orders.PUT("/:id/status", middleware.RequirePermission(models.PermOrderAudit), controllers.UpdateOrderStatus)
+				orders.POST("/:id/images", orderReport, controllers.UploadOrderImages)
+				orders.GET("/:id/images", orderView, controllers.GetOrderImages)
+				orders.DELETE("/:id/images/:image_id", orderReport, controllers.DeleteOrderImage)
+				orders.GET("/stats", orderView, controllers.GetOrderStats)
+				orders.POST("/parse", orderReport, controllers.ParseOrderText)
+			}
+
+			// 报单设置（智能识别规则）
+			parseRules := protected.Group("/order-parse-rules")
+			parseRules.Use(middleware.RequirePermission(models.PermOrderSettings))
+			{
+				parseRules.GET("", controllers.GetOrderParseRules)
+				parseRules.POST("", controllers.CreateOrderParseRule)
+				parseRules.PUT("/:id", controllers.UpdateOrderParseRule)
+				parseRules.DELETE("/:id", controllers.DeleteOrderParseRule)
 			}
 
 			// 订单审批管理
 			approval := protected.Group("/order-approval")
+			approval.Use(middleware.RequirePermission(models.PermOrderAudit))
 			{
 				approval.GET("/pending", controllers.GetPendingOrders)
 				approval.GET("", controllers.GetApprovalOrders)
-				approval.POST("/:id/approve", controllers.ApproveOrder)
-				approval.POST("/:id/reject", controllers.RejectOrder)
-				approval.POST("/batch", controllers.BatchApproval)
+				approval.GET("/transitions", controllers.GetOrderTransitions)
+				approval.POST("/:id/approve", idempotent, controllers.ApproveOrder)
+				approval.POST("/:id/reject", idempotent, controllers.RejectOrder)
+				approval.POST("/batch", idempotent, controllers.BatchApproval)
 				approval.PATCH("/:id/status", controllers.UpdateOrderStatusV2)
+				approval.POST("/:id/return", idempotent, controllers.ReturnOrder)
+				approval.GET("/:id/refunds", controllers.GetOrderRefunds)
 				approval.GET("/statistics", controllers.GetStatistics)
 				approval.GET("/history", controllers.GetOperationHistory)
 				approval.POST("/export", controllers.BatchExport)
 			}
 
+			// 提成结算
+			settlements := protected.Group("/settlements")
+			{
+				settlementManage := middleware.RequirePermission(models.PermSettlementManage)
+
+				settlements.GET("", settlementManage, controllers.GetSettlements)
+				settlements.POST("", settlementManage, controllers.CreateSettlement)
+				settlements.GET("/mine", controllers.GetMySettlements)
+				settlements.GET("/commission-overrides", settlementManage, controllers.GetCommissionOverrides)
+				settlements.POST("/commission-overrides", settlementManage, controllers.SaveCommissionOverride)
+				settlements.DELETE("/commission-overrides/:id", settlementManage, controllers.DeleteCommissionOverride)
+				settlements.GET("/:id", controllers.GetSettlementByID)
+				settlements.POST("/:id/adjustments", settlementManage, controllers.AddSettlementAdjustment)
+				settlements.POST("/:id/pay", settlementManage, idempotent, controllers.PaySettlement)
+			}
+
 			// 系统配置
 			configs := protected.Group("/configs")
+			configs.Use(middleware.RequirePermission(models.PermConfigManage))
 			{
 				configs.GET("", controllers.GetConfigs)
 				configs.PUT("/:key", controllers.UpdateConfig)
@@ -123,9 +247,18 @@ func InitRouter() *gin.Engine {
 
 			// 操作日志
 			logs := protected.Group("/logs")
+			logs.Use(middleware.RequirePermission(models.PermLogView))
 			{
 				logs.GET("", controllers.GetOperationLogs)
 			}
+
+			// 登录日志
+			loginLogs := protected.Group("/login-logs")
+			loginLogs.Use(middleware.RequirePermission(models.PermLogView))
+			{
+				loginLogs.GET("/members", controllers.GetMemberLoginLogs)
+				loginLogs.GET("/customers", controllers.GetCustomerLoginLogs)
+			}
 		}
 	}
 
@@ -9,8 +9,9 @@ import requests
 import json
 import time
 import sys
-from typing import Dict, Any, Optional
+from typing import Dict, Any, Optional, List
 from dataclasses import dataclass
+from concurrent.futures import ThreadPoolExecutor
 from datetime import datetime, timedelta
 
 
@@ -118,6 +119,56 @@ class APITester:
             
             return result
     
+    def make_concurrent_requests(self, requests_list: List[tuple],
+                                 expected_status: tuple = (200,)) -> List[TestResult]:
+        """并发发送一组请求，requests_list 中每项为 (method, endpoint, data)，
+        状态码在 expected_status 内的请求记为通过"""
+        headers = {'Authorization': f'Bearer {self.token}'} if self.token else {}
+
+        def send(item):
+            method, endpoint, data = item
+            start_time = time.time()
+            try:
+                # requests.Session 不保证线程安全，每个请求单独发送
+                response = requests.request(method, f"{self.base_url}{endpoint}", json=data,
+                                            headers={**self.session.headers, **headers})
+                try:
+                    response_data = response.json()
+                except json.JSONDecodeError:
+                    response_data = {"text": response.text}
+                return TestResult(
+                    endpoint=endpoint,
+                    method=method.upper(),
+                    status_code=response.status_code,
+                    success=response.status_code in expected_status,
+                    response_time=time.time() - start_time,
+                    error_message=None if response.status_code in expected_status else response_data.get('message', 'Unknown error'),
+                    response_data=response_data
+                )
+            except Exception as e:
+                return TestResult(endpoint=endpoint, method=method.upper(), status_code=0, success=False,
+                                  response_time=time.time() - start_time, error_message=str(e))
+
+        with ThreadPoolExecutor(max_workers=len(requests_list)) as executor:
+            results = list(executor.map(send, requests_list))
+
+        for result in results:
+            self.test_results.append(result)
+            status = "✅ PASS" if result.success else "❌ FAIL"
+            self.log(f"{status} {result.method} {result.endpoint} ({result.status_code}) - {result.response_time:.3f}s [并发]")
+        return results
+
+    def check(self, condition: bool, message: str) -> bool:
+        """记录一条断言结果，计入测试报告"""
+        self.test_results.append(TestResult(endpoint=f"[断言] {message}", method="CHECK",
+                                            status_code=0, success=condition, response_time=0.0,
+                                            error_message=None if condition else message))
+        if condition:
+            self.log(f"✅ {message}")
+        else:
+            self.log(f"❌ {message}", "ERROR")
+        return condition
+
     def login(self) -> bool:
         """用户登录获取Token"""
         self.log("开始登录测试...")
@@ -205,6 +256,7 @@ class APITester:
             "notes": "自动化测试创建",
             "initial_real_charge": 1000.00,
             "exclusive_discount_type": "固定折扣",
+            "exclusive_discount_value": 5.00,
             "platform_boss": "平台老板A",
             "exclusive_cs": "客服小王"
         }
@@ -285,9 +337,10 @@ class APITester:
         self.make_request('GET', '/orders', params={'page': 1, 'page_size': 10})
         
         # 2. 创建订单
+        # 结束时间不能晚于当前时间，使用已结束的时间段
         now = datetime.now()
-        start_time = now.strftime("%Y-%m-%d %H:%M:%S")
-        end_time = (now + timedelta(hours=2)).strftime("%Y-%m-%d %H:%M:%S")
+        start_time = (now - timedelta(hours=3)).strftime("%Y-%m-%d %H:%M:%S")
+        end_time = (now - timedelta(hours=1)).strftime("%Y-%m-%d %H:%M:%S")
         
         order_data = {
             "customer_id": self.test_data['customer_id'],
@@ -343,6 +396,320 @@ class APITester:
             'end_date': today
         })
     
+    # 智能识别报单的样例语料：text 为粘贴的报单文本，expect 为识别结果中 order 的期望值，
+    # {customer} / {category} 替换为测试中创建的客户账号和类别名称，
+    # unresolved 为期望未识别的字段
+    ORDER_PARSE_CORPUS = [
+        {
+            "name": "需求文档示例格式",
+            "text": "老指ID: {customer}\n时长: 2小时\n游戏品类: {category}\n陪玩服: 艾欧尼亚\n陪玩报单: 2小时大乱斗",
+            "expect": {"customer_id": "customer", "order_category_id": "category", "duration_hours": 2.0,
+                       "project_category": "2小时大乱斗", "service_additional_info": "陪玩服: 艾欧尼亚"},
+            "unresolved": ["start_time", "end_time", "unit_price"],
+        },
+        {
+            "name": "中文冒号、别名和时间段",
+            "text": "老板：{customer}\n品类：测试别名{suffix}\n时间：2025-07-12 14:00-16:30\n单价：50元/小时",
+            "expect": {"customer_id": "customer", "order_category_id": "category", "duration_hours": 2.5,
+                       "unit_price": 50.0, "start_time": "2025-07-12T14:00:00", "end_time": "2025-07-12T16:30:00"},
+            "unresolved": [],
+        },
+        {
+            "name": "开始时间加时长推算结束时间",
+            "text": "会员号: {customer}\n游戏: {category}\n开始时间: 2025-07-12 20:00\n时长: 两个半小时\n单价: ￥68.5",
+            "expect": {"duration_hours": 2.5, "unit_price": 68.5, "end_time": "2025-07-12T22:30:00"},
+            "unresolved": [],
+        },
+        {
+            "name": "非整小时时间段推算时长",
+            "text": "老板ID: {customer}\n游戏品类: {category}\n时间: 2025-07-12 14:00-16:20\n单价: 50",
+            "expect": {"duration_hours": 2.33, "start_time": "2025-07-12T14:00:00", "end_time": "2025-07-12T16:20:00"},
+            "unresolved": [],
+            "warnings": [],
+        },
+        {
+            "name": "非整小时时间段与填写的时长一致",
+            "text": "老板ID: {customer}\n游戏品类: {category}\n时间: 2025-07-12 14:00-16:20\n时长: 2.33小时\n单价: 50",
+            "expect": {"duration_hours": 2.33, "end_time": "2025-07-12T16:20:00"},
+            "unresolved": [],
+            "warnings": [],
+        },
+        {
+            "name": "跨天时间段",
+            "text": "老板ID: {customer}\n游戏品类: {category}\n时间: 2025-07-12 23:00~01:00\n单价: 40",
+            "expect": {"duration_hours": 2.0, "end_time": "2025-07-13T01:00:00"},
+            "unresolved": [],
+        },
+        {
+            "name": "时长写在报单内容中",
+            "text": "老板ID: {customer}\n游戏品类: {category}\n陪玩报单: 90分钟排位",
+            "expect": {"duration_hours": 1.5},
+            "unresolved": ["start_time", "end_time", "unit_price"],
+        },
+        {
+            "name": "未知客户和类别",
+            "text": "老板ID: 不存在的老板_{suffix}\n游戏品类: 不存在的游戏_{suffix}\n时长: 1h",
+            "expect": {"customer_id": None, "order_category_id": None, "duration_hours": 1.0},
+            "unresolved": ["customer", "category", "start_time", "end_time", "unit_price"],
+        },
+        {
+            "name": "无法识别的文本",
+            "text": "今天打得很开心",
+            "expect": {"customer_id": None, "order_category_id": None, "duration_hours": None},
+            "unresolved": ["customer", "category", "start_time", "end_time", "duration_hours", "unit_price"],
+        },
+    ]
+
+    def test_order_parse(self):
+        """测试智能识别报单接口，逐条核对样例语料的识别结果"""
+        self.log("开始测试智能识别报单接口...")
+
+        # 1. 获取识别规则
+        self.make_request('GET', '/order-parse-rules')
+
+        # 2. 准备识别用的客户和带别名的订单类别
+        suffix = str(int(time.time()))
+        category_name = f"识别测试游戏_{suffix}"
+        customer_account = f"parse_{suffix}"
+        category = self.make_request('POST', '/order-categories', data={
+            "category_name": category_name,
+            "aliases": f"测试别名{suffix}",
+            "is_participating": True,
+        })
+        customer = self.make_request('POST', '/customers', data={
+            "account": customer_account,
+            "customer_name": f"识别测试客户_{suffix}",
+        })
+        if not (category.success and customer.success):
+            self.log("创建识别测试数据失败，跳过语料测试", "WARN")
+            return
+        ids = {
+            "category": category.response_data.get('data', {}).get('category_id'),
+            "customer": customer.response_data.get('data', {}).get('customer_id'),
+        }
+
+        # 3. 逐条识别样例语料
+        for case in self.ORDER_PARSE_CORPUS:
+            text = case["text"].format(customer=customer_account, category=category_name, suffix=suffix)
+            result = self.make_request('POST', '/orders/parse', data={"text": text})
+            if not result.success:
+                continue
+            data = result.response_data.get('data', {})
+            order = data.get('order', {})
+
+            problems = []
+            for field, expected in case["expect"].items():
+                if expected in ids:
+                    expected = ids[expected]
+                actual = order.get(field)
+                if isinstance(actual, str) and isinstance(expected, str) and field.endswith('_time'):
+                    actual = actual[:19]
+                if isinstance(expected, float) and actual is not None:
+                    actual = float(actual)
+                if actual != expected:
+                    problems.append(f"{field} 期望 {expected}，实际 {actual}")
+            if sorted(data.get('unresolved') or []) != sorted(case["unresolved"]):
+                problems.append(f"unresolved 期望 {case['unresolved']}，实际 {data.get('unresolved')}")
+            if "warnings" in case and (data.get('warnings') or []) != case["warnings"]:
+                problems.append(f"warnings 期望 {case['warnings']}，实际 {data.get('warnings')}")
+
+            if problems:
+                result.success = False
+                result.error_message = f"{case['name']}: " + "; ".join(problems)
+                self.log(f"❌ 识别结果不符 - {result.error_message}", "ERROR")
+            else:
+                self.log(f"✅ 识别结果符合 - {case['name']}")
+
+        # 4. 清理测试数据
+        self.make_request('DELETE', f"/customers/{ids['customer']}")
+        self.make_request('DELETE', f"/order-categories/{ids['category']}")
+    
+    def get_customer_financial(self, customer_id: int) -> Dict[str, float]:
+        """查询客户财务信息，金额统一转为 float"""
+        result = self.make_request('GET', f'/customers/{customer_id}')
+        if not result.success:
+            return {}
+        info = result.response_data.get('data', {}).get('financial_info') or {}
+        return {k: float(v) for k, v in info.items() if isinstance(v, (int, float, str)) and k.endswith(('_balance', '_charge', '_consumption'))}
+
+    def sum_customer_ledger(self, customer_id: int) -> tuple:
+        """按流水汇总客户钱包余额和赠送余额：贷记客户钱包为增加，借记为减少"""
+        balance, gift, page = 0.0, 0.0, 1
+        while True:
+            result = self.make_request('GET', f'/customers/{customer_id}/ledger',
+                                       params={'page': page, 'page_size': 100})
+            if not result.success:
+                return None, None
+            data = result.response_data.get('data', {})
+            entries = data.get('list') or []
+            for entry in entries:
+                sign = 0
+                if entry.get('credit_account') == 'customer_wallet':
+                    sign = 1
+                elif entry.get('debit_account') == 'customer_wallet':
+                    sign = -1
+                balance += sign * float(entry.get('amount', 0))
+                gift += sign * float(entry.get('gift_amount', 0))
+            if not entries or page * 100 >= data.get('total', 0):
+                return round(balance, 2), round(gift, 2)
+            page += 1
+
+    def check_customer_ledger(self, customer_id: int, financial: Dict[str, float], stage: str):
+        """核对流水汇总、对账接口和客户财务信息三者一致"""
+        ledger_balance, ledger_gift = self.sum_customer_ledger(customer_id)
+        self.check(ledger_balance == financial.get('current_balance'),
+                   f"{stage}: 流水汇总余额 {ledger_balance} 与当前余额 {financial.get('current_balance')} 一致")
+        self.check(ledger_gift == financial.get('gift_balance'),
+                   f"{stage}: 流水汇总赠送余额 {ledger_gift} 与赠送余额 {financial.get('gift_balance')} 一致")
+        result = self.make_request('GET', f'/customers/{customer_id}/ledger/reconcile')
+        if result.success:
+            reconcile = result.response_data.get('data', {})
+            self.check(reconcile.get('balanced') is True,
+                       f"{stage}: 对账平衡（差额 {reconcile.get('difference')}，赠送差额 {reconcile.get('gift_difference')}）")
+
+    def test_concurrency(self):
+        """并发测试：同一客户上并发充值和审批，核对余额、流水，并确认冲突写入返回409而不是被覆盖"""
+        self.log("开始并发充值和审批测试...")
+
+        recharge_count = 10
+        order_count = 5
+        duplicate_count = 5
+        real_amount, gift_amount = 100.00, 10.00
+        unit_price, hours = 20.00, 1.0
+
+        # 1. 准备独立的客户和订单类别，避免受其他测试数据影响
+        suffix = str(int(time.time()))
+        category = self.make_request('POST', '/order-categories', data={
+            "category_name": f"并发测试游戏_{suffix}",
+            "is_participating": True,
+        })
+        customer = self.make_request('POST', '/customers', data={
+            "account": f"concurrency_{suffix}",
+            "customer_name": f"并发测试客户_{suffix}",
+        })
+        if not (category.success and customer.success):
+            self.log("创建并发测试数据失败，跳过并发测试", "WARN")
+            return
+        category_id = category.response_data.get('data', {}).get('category_id')
+        customer_id = customer.response_data.get('data', {}).get('customer_id')
+
+        # 2. 并发充值，每笔使用不同的收款单号，全部成功且余额按笔数累加
+        recharges = [('POST', f'/customers/{customer_id}/recharge', {
+            "real_charge_amount": real_amount,
+            "gift_amount": gift_amount,
+            "payment_method": "微信",
+            "transaction_id": f"CC{suffix}{i:03d}",
+            "notes": "并发测试充值",
+        }) for i in range(recharge_count)]
+        results = self.make_concurrent_requests(recharges)
+        self.check(all(r.status_code == 200 for r in results), f"{recharge_count} 笔并发充值全部成功")
+
+        total_real = round(recharge_count * real_amount, 2)
+        total_gift = round(recharge_count * gift_amount, 2)
+        financial = self.get_customer_financial(customer_id)
+        self.check(financial.get('current_balance') == round(total_real + total_gift, 2),
+                   f"并发充值后当前余额为 {total_real + total_gift}，实际 {financial.get('current_balance')}")
+        self.check(financial.get('real_balance') == total_real,
+                   f"并发充值后实充余额为 {total_real}，实际 {financial.get('real_balance')}")
+        self.check(financial.get('gift_balance') == total_gift,
+                   f"并发充值后赠送余额为 {total_gift}，实际 {financial.get('gift_balance')}")
+        self.check(financial.get('total_real_charge') == total_real,
+                   f"并发充值后累计实充为 {total_real}，实际 {financial.get('total_real_charge')}")
+        self.check_customer_ledger(customer_id, financial, "并发充值后")
+
+        # 3. 同一收款单号并发充值，只能成功一次，其余返回409
+        duplicate = {
+            "real_charge_amount": real_amount,
+            "gift_amount": 0,
+            "payment_method": "微信",
+            "transaction_id": f"CCDUP{suffix}",
+            "notes": "并发测试重复充值",
+        }
+        results = self.make_concurrent_requests(
+            [('POST', f'/customers/{customer_id}/recharge', duplicate)] * duplicate_count,
+            expected_status=(200, 409))
+        statuses = sorted(r.status_code for r in results)
+        self.check(statuses == [200] + [409] * (duplicate_count - 1),
+                   f"同一收款单号并发充值一次成功、其余409，实际 {statuses}")
+        total_real = round(total_real + real_amount, 2)
+        financial = self.get_customer_financial(customer_id)
+        self.check(financial.get('real_balance') == total_real,
+                   f"重复充值只入账一次，实充余额为 {total_real}，实际 {financial.get('real_balance')}")
+        self.check_customer_ledger(customer_id, financial, "重复充值后")
+
+        # 4. 创建多笔余额支付的订单，时间段互不重叠且已结束
+        order_ids = []
+        base = datetime.now().astimezone().replace(microsecond=0) - timedelta(days=2)
+        for i in range(order_count + 1):
+            start = base + timedelta(hours=i * 2)
+            result = self.make_request('POST', '/orders', data={
+                "customer_id": customer_id,
+                "order_category_id": category_id,
+                "project_category": "并发测试",
+                "start_time": start.isoformat(),
+                "end_time": (start + timedelta(hours=hours)).isoformat(),
+                "duration_hours": hours,
+                "unit_price": unit_price,
+                "exclusive_discount": False,
+                "use_balance_payment": True,
+            })
+            if result.success:
+                order_ids.append(result.response_data.get('data', {}).get('order_id'))
+        if not self.check(len(order_ids) == order_count + 1, f"创建 {order_count + 1} 笔余额支付订单"):
+            self.cleanup_concurrency(customer_id, category_id)
+            return
+
+        final_prices = {}
+        for order_id in order_ids:
+            result = self.make_request('GET', f'/orders/{order_id}')
+            if result.success:
+                pricing = result.response_data.get('data', {}).get('pricing') or {}
+                final_prices[order_id] = float(pricing.get('final_price', 0))
+
+        # 5. 并发审批不同订单，每笔都扣款且余额不被覆盖
+        batch, contested = order_ids[:order_count], order_ids[order_count]
+        results = self.make_concurrent_requests(
+            [('POST', f'/order-approval/{order_id}/approve', {"notes": "并发测试审批"}) for order_id in batch])
+        self.check(all(r.status_code == 200 for r in results), f"{order_count} 笔订单并发审批全部成功")
+
+        consumed = round(sum(final_prices.get(order_id, 0) for order_id in batch), 2)
+        balance = round(total_real + total_gift - consumed, 2)
+        financial = self.get_customer_financial(customer_id)
+        self.check(financial.get('current_balance') == balance,
+                   f"并发审批后当前余额为 {balance}，实际 {financial.get('current_balance')}")
+        self.check(financial.get('total_consumption') == consumed,
+                   f"并发审批后累计消费为 {consumed}，实际 {financial.get('total_consumption')}")
+        self.check(financial.get('frozen_balance') == round(final_prices.get(contested, 0), 2),
+                   f"并发审批后只剩未审批订单的冻结金额，实际 {financial.get('frozen_balance')}")
+        self.check_customer_ledger(customer_id, financial, "并发审批后")
+
+        # 6. 同一订单并发审批，只能成功一次，其余返回409，余额只扣一次
+        results = self.make_concurrent_requests(
+            [('POST', f'/order-approval/{contested}/approve', {"notes": "并发测试重复审批"})] * duplicate_count,
+            expected_status=(200, 409))
+        statuses = sorted(r.status_code for r in results)
+        self.check(statuses == [200] + [409] * (duplicate_count - 1),
+                   f"同一订单并发审批一次成功、其余409，实际 {statuses}")
+
+        consumed = round(consumed + final_prices.get(contested, 0), 2)
+        balance = round(total_real + total_gift - consumed, 2)
+        financial = self.get_customer_financial(customer_id)
+        self.check(financial.get('current_balance') == balance,
+                   f"重复审批只扣款一次，当前余额为 {balance}，实际 {financial.get('current_balance')}")
+        self.check(financial.get('total_consumption') == consumed,
+                   f"重复审批后累计消费为 {consumed}，实际 {financial.get('total_consumption')}")
+        self.check(financial.get('frozen_balance') == 0,
+                   f"全部审批后冻结金额为 0，实际 {financial.get('frozen_balance')}")
+        self.check_customer_ledger(customer_id, financial, "重复审批后")
+
+        # 7. 清理测试数据
+        self.cleanup_concurrency(customer_id, category_id)
+
+    def cleanup_concurrency(self, customer_id: int, category_id: int):
+        """清理并发测试创建的客户和订单类别，订单保留在库中供核对"""
+        self.make_request('DELETE', f'/customers/{customer_id}')
+        self.make_request('DELETE', f'/order-categories/{category_id}')
+    
     def test_system_config(self):
         """测试系统配置接口"""
         self.log("开始测试系统配置接口...")
@@ -405,6 +772,8 @@ class APITester:
             self.test_customers()
             self.test_order_categories()
             self.test_orders()
+            self.test_order_parse()
+            self.test_concurrency()
             self.test_system_config()
             self.test_operation_logs()
         except Exception as e:
@@ -0,0 +1,104 @@
+package utils
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	_ "image/gif" // 注册 GIF 解码
+	"image/jpeg"
+	_ "image/png" // 注册 PNG 解码
+	"io"
+)
+
+// ImageSize 只读取图片头部获取宽高，不解码像素数据
+func ImageSize(r io.Reader) (width, height int, err error) {
+	cfg, _, err := image.DecodeConfig(r)
+	return cfg.Width, cfg.Height, err
+}
+
+// DecodeImage 解码图片，仅支持标准库可解码的 JPEG、PNG、GIF
+// 解码会按图片声明的尺寸分配内存，调用前应先用 ImageSize 检查像素数
+func DecodeImage(r io.Reader) (image.Image, error) {
+	img, _, err := image.Decode(r)
+	return img, err
+}
+
+// MakeThumbnail 生成 JPEG 缩略图，最长边缩放到 maxPixel，原图更小时不放大
+func MakeThumbnail(src image.Image, maxPixel int) ([]byte, error) {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if maxPixel > 0 && (width > maxPixel || height > maxPixel) {
+		if width >= height {
+			height = max(1, height*maxPixel/width)
+			width = maxPixel
+		} else {
+			width = max(1, width*maxPixel/height)
+			height = maxPixel
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, resizeImage(src, width, height), &jpeg.Options{Quality: 80}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// resizeImage 按区域平均缩放图片，透明部分铺白底
+func resizeImage(src image.Image, width, height int) *image.RGBA {
+	bounds := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	srcWidth, srcHeight := bounds.Dx(), bounds.Dy()
+	for y := 0; y < height; y++ {
+		y0 := bounds.Min.Y + y*srcHeight/height
+		y1 := max(y0+1, bounds.Min.Y+(y+1)*srcHeight/height)
+		for x := 0; x < width; x++ {
+			x0 := bounds.Min.X + x*srcWidth/width
+			x1 := max(x0+1, bounds.Min.X+(x+1)*srcWidth/width)
+
+			// 取对应区域的平均颜色，缩小时比最近邻采样更平滑
+			var rSum, gSum, bSum, aSum, count uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					rSum += uint64(cr)
+					gSum += uint64(cg)
+					bSum += uint64(cb)
+					aSum += uint64(ca)
+					count++
+				}
+			}
+			// JPEG 不支持透明，透明部分铺白底
+			background := 0xffff - aSum/count
+			dst.Set(x, y, color.RGBA64{
+				R: uint16(rSum/count + background),
+				G: uint16(gSum/count + background),
+				B: uint16(bSum/count + background),
+				A: 0xffff,
+			})
+		}
+	}
+	return dst
+}
+
+// DifferenceHash 计算图片的差值感知哈希（dHash）：缩放为 9x8 灰度图，比较相邻像素亮度得到 64 位
+// 重新压缩、缩放或轻微调色后的同一张图片哈希值相近，可用汉明距离判断相似程度
+func DifferenceHash(src image.Image) uint64 {
+	small := resizeImage(src, 9, 8)
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			hash <<= 1
+			if luminance(small.At(x, y)) > luminance(small.At(x+1, y)) {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// luminance 计算像素亮度
+func luminance(c color.Color) uint32 {
+	r, g, b, _ := c.RGBA()
+	return (299*r + 587*g + 114*b) / 1000
+}
@@ -1,197 +1,269 @@
 package utils
 
 import (
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/base64"
-	"encoding/json"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
-	"strconv"
-	"strings"
+	"sync"
 	"tangsong-esports/config"
 	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// 令牌主体类型，区分内部成员与客户，两者ID来自不同的表
+const (
+	SubjectStaff    = "staff"
+	SubjectCustomer = "customer"
+)
+
+// 令牌类型
+const (
+	TokenTypeAccess         = "access"
+	TokenTypeRefresh        = "refresh"
+	TokenTypeChallenge      = "2fa_challenge"   // 密码验证通过、等待两步验证的登录挑战
+	TokenTypePasswordChange = "password_change" // 密码验证通过、必须先修改密码的登录挑战
 )
 
+// ChallengeTokenTTL 登录挑战令牌有效期
+const ChallengeTokenTTL = 5 * time.Minute
+
+// 未配置 jwt.keys 时，使用 jwt.secret 作为该ID的密钥
+const defaultKeyID = "default"
+
+// Claims 令牌声明，jti/exp/iat/iss/aud 由 RegisteredClaims 提供
 type Claims struct {
-	MemberID  uint   `json:"member_id"`
-	Account   string `json:"account"`
-	UserRole  string `json:"user_role"`
-	TokenType string `json:"token_type"` // access 或 refresh
-	Exp       int64  `json:"exp"`
-	Iat       int64  `json:"iat"`
+	SubjectID   uint   `json:"sub_id"`
+	SubjectType string `json:"sub_type"` // staff 或 customer
+	Account     string `json:"account"`
+	UserRole    string `json:"user_role"`
+	SessionID   string `json:"sid"`        // 服务端会话ID
+	TokenType   string `json:"token_type"` // access 或 refresh
+	jwt.RegisteredClaims
 }
 
-// GenerateToken 生成JWT令牌 (简化版本)
-func GenerateToken(memberID uint, account, userRole string) (string, error) {
-	return generateToken(memberID, account, userRole, "access", 24*time.Hour)
+// TokenService 令牌服务，支持通过 kid 同时验证多个密钥以便平滑轮换
+type TokenService struct {
+	keys        map[string][]byte
+	activeKeyID string
+	issuer      string
+	audience    string
+	accessTTL   time.Duration
+	refreshTTL  time.Duration
 }
 
-// GenerateRefreshToken 生成刷新令牌
-func GenerateRefreshToken(memberID uint, account, userRole string) (string, error) {
-	return generateToken(memberID, account, userRole, "refresh", 7*24*time.Hour) // 7天
+// NewTokenService 根据配置创建令牌服务
+func NewTokenService(cfg config.JWTConfig) (*TokenService, error) {
+	keys := make(map[string][]byte)
+	for _, key := range cfg.Keys {
+		if key.ID == "" || key.Secret == "" {
+			return nil, fmt.Errorf("JWT密钥的 id 和 secret 不能为空")
+		}
+		keys[key.ID] = []byte(key.Secret)
+	}
+	if len(keys) == 0 {
+		if cfg.Secret == "" {
+			return nil, fmt.Errorf("未配置JWT密钥")
+		}
+		keys[defaultKeyID] = []byte(cfg.Secret)
+	}
+
+	activeKeyID := cfg.ActiveKeyID
+	if activeKeyID == "" {
+		activeKeyID = defaultKeyID
+	}
+	if _, ok := keys[activeKeyID]; !ok {
+		return nil, fmt.Errorf("当前签名密钥 %s 不存在", activeKeyID)
+	}
+
+	accessTTL := time.Duration(cfg.Expire) * time.Hour
+	if accessTTL <= 0 {
+		accessTTL = 24 * time.Hour
+	}
+	refreshTTL := time.Duration(cfg.RefreshExpire) * time.Hour
+	if refreshTTL <= 0 {
+		refreshTTL = 7 * 24 * time.Hour
+	}
+
+	return &TokenService{
+		keys:        keys,
+		activeKeyID: activeKeyID,
+		issuer:      cfg.Issuer,
+		audience:    cfg.Audience,
+		accessTTL:   accessTTL,
+		refreshTTL:  refreshTTL,
+	}, nil
 }
 
-// generateToken 生成指定类型的令牌 - 使用字符串拼接避免 JSON 序列化问题
-func generateToken(memberID uint, account, userRole, tokenType string, duration time.Duration) (string, error) {
-	// JWT Header - 手动构建 JSON 字符串
-	headerJSON := `{"alg":"HS256","typ":"JWT"}`
-	headerEncoded := base64.RawURLEncoding.EncodeToString([]byte(headerJSON))
+// Generate 签发指定类型的令牌
+func (s *TokenService) Generate(tokenType, subjectType string, subjectID uint, account, userRole, sessionID, tokenID string) (string, error) {
+	ttl := s.accessTTL
+	switch tokenType {
+	case TokenTypeRefresh:
+		ttl = s.refreshTTL
+	case TokenTypeChallenge, TokenTypePasswordChange:
+		ttl = ChallengeTokenTTL
+	}
 
-	// JWT Payload - 手动构建 JSON 字符串
 	now := time.Now()
-	exp := now.Add(duration).Unix()
-	iat := now.Unix()
-	// 转义用户角色中的特殊字符
-	escapedUserRole := strings.ReplaceAll(userRole, `"`, `\"`)
-	payloadJSON := fmt.Sprintf(`{"member_id":%d,"account":"%s","user_role":"%s","token_type":"%s","exp":%d,"iat":%d}`,
-		memberID, account, escapedUserRole, tokenType, exp, iat)
-	payloadEncoded := base64.RawURLEncoding.EncodeToString([]byte(payloadJSON))
-
-	// 创建签名
-	message := headerEncoded + "." + payloadEncoded
-	signature := createSignature(message, config.AppConfig.JWT.Secret)
+	claims := Claims{
+		SubjectID:   subjectID,
+		SubjectType: subjectType,
+		Account:     account,
+		UserRole:    userRole,
+		SessionID:   sessionID,
+		TokenType:   tokenType,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenID,
+			Issuer:    s.issuer,
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+	if s.audience != "" {
+		claims.Audience = jwt.ClaimStrings{s.audience}
+	}
 
-	return message + "." + signature, nil
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = s.activeKeyID
+	return token.SignedString(s.keys[s.activeKeyID])
 }
 
-// ParseToken 解析JWT令牌 (简化版本)
-func ParseToken(tokenString string) (*Claims, error) {
-	claims, err := parseToken(tokenString)
+// Parse 解析并校验令牌，要求签名算法、kid、签发者、受众、有效期和令牌类型均匹配
+func (s *TokenService) Parse(tokenString, tokenType string) (*Claims, error) {
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuedAt(),
+	}
+	if s.issuer != "" {
+		options = append(options, jwt.WithIssuer(s.issuer))
+	}
+	if s.audience != "" {
+		options = append(options, jwt.WithAudience(s.audience))
+	}
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, s.keyFunc, options...)
 	if err != nil {
 		return nil, err
 	}
 
-	// 检查令牌类型
-	if claims.TokenType != "access" {
+	if claims.ExpiresAt == nil {
+		return nil, jwt.ErrTokenRequiredClaimMissing
+	}
+	if claims.TokenType != tokenType {
 		return nil, fmt.Errorf("invalid token type")
 	}
+	if claims.SubjectType != SubjectStaff && claims.SubjectType != SubjectCustomer {
+		return nil, fmt.Errorf("invalid subject type")
+	}
 
 	return claims, nil
 }
 
-// ParseRefreshToken 解析刷新令牌
-func ParseRefreshToken(tokenString string) (*Claims, error) {
-	claims, err := parseToken(tokenString)
-	if err != nil {
-		return nil, err
+// keyFunc 根据令牌头部的 kid 选择验证密钥
+func (s *TokenService) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, ok := token.Header["kid"].(string)
+	if !ok || kid == "" {
+		return nil, errors.New("missing kid")
 	}
-
-	// 检查令牌类型
-	if claims.TokenType != "refresh" {
-		return nil, fmt.Errorf("invalid refresh token")
+	key, ok := s.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown kid: %s", kid)
 	}
+	return key, nil
+}
 
-	return claims, nil
+// AccessTTL 访问令牌有效期
+func (s *TokenService) AccessTTL() time.Duration {
+	return s.accessTTL
 }
 
-// parseToken 解析令牌的通用函数
-func parseToken(tokenString string) (*Claims, error) {
-	parts := strings.Split(tokenString, ".")
-	if len(parts) != 3 {
-		return nil, fmt.Errorf("invalid token format")
-	}
+// RefreshTTL 刷新令牌有效期
+func (s *TokenService) RefreshTTL() time.Duration {
+	return s.refreshTTL
+}
 
-	// 验证签名
-	message := parts[0] + "." + parts[1]
-	expectedSignature := createSignature(message, config.AppConfig.JWT.Secret)
-	if parts[2] != expectedSignature {
-		log.Printf("[parseToken] 签名验证失败 - 期望: %s, 实际: %s", expectedSignature, parts[2])
-		return nil, fmt.Errorf("invalid signature")
-	}
+var (
+	defaultTokenService *TokenService
+	tokenServiceOnce    sync.Once
+)
 
-	// 解码 Payload
-	payloadBytes, err := base64URLDecode(parts[1])
+// InitTokenService 使用全局配置初始化默认令牌服务，配置错误时启动失败
+func InitTokenService() {
+	service, err := NewTokenService(config.AppConfig.JWT)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode payload: %v", err)
+		log.Fatal("令牌服务初始化失败:", err)
 	}
+	defaultTokenService = service
+}
 
-	var claims Claims
-	if err := json.Unmarshal(payloadBytes, &claims); err != nil {
-		// 尝试手动解析 JSON（如果标准解析失败）
-		if manualClaims, manualErr := parseClaimsManually(string(payloadBytes)); manualErr == nil {
-			claims = *manualClaims
-		} else {
-			return nil, fmt.Errorf("failed to unmarshal claims: %v", err)
+// tokens 获取默认令牌服务，未显式初始化时按全局配置懒加载
+func tokens() *TokenService {
+	tokenServiceOnce.Do(func() {
+		if defaultTokenService == nil {
+			InitTokenService()
 		}
+	})
+	return defaultTokenService
+}
+
+// GenerateTokenID 生成随机令牌ID
+func GenerateTokenID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
 	}
+	return hex.EncodeToString(buf), nil
+}
 
-	// 检查过期时间
-	currentTime := time.Now().Unix()
-	if currentTime > claims.Exp {
-		log.Printf("[parseToken] 令牌已过期 - 当前: %d, 过期: %d", currentTime, claims.Exp)
-		return nil, fmt.Errorf("token expired")
+// GenerateToken 生成访问令牌
+func GenerateToken(subjectType string, subjectID uint, account, userRole, sessionID string) (string, error) {
+	tokenID, err := GenerateTokenID()
+	if err != nil {
+		return "", err
 	}
+	return tokens().Generate(TokenTypeAccess, subjectType, subjectID, account, userRole, sessionID, tokenID)
+}
 
-	return &claims, nil
+// GenerateRefreshToken 生成刷新令牌，tokenID 由会话记录用于轮换校验
+func GenerateRefreshToken(subjectType string, subjectID uint, account, userRole, sessionID, tokenID string) (string, error) {
+	return tokens().Generate(TokenTypeRefresh, subjectType, subjectID, account, userRole, sessionID, tokenID)
 }
 
-// parseClaimsManually 手动解析 Claims（用于处理格式不正确的 JSON）
-func parseClaimsManually(jsonStr string) (*Claims, error) {
-	claims := &Claims{}
-	// 去掉花括号
-	jsonStr = strings.Trim(jsonStr, "{}")
-	// 按引号分割并解析
-	parts := strings.Split(jsonStr, `"`)
-	for i := 0; i < len(parts)-1; i += 4 {
-		if i+3 >= len(parts) {
-			break
-		}
-		key := parts[i+1]
-		value := parts[i+3]
-
-		switch key {
-		case "member_id":
-			if val, err := strconv.ParseUint(value, 10, 32); err == nil {
-				claims.MemberID = uint(val)
-			}
-		case "account":
-			claims.Account = value
-		case "user_role":
-			claims.UserRole = value
-		case "token_type":
-			claims.TokenType = value
-		case "exp":
-			if val, err := strconv.ParseInt(value, 10, 64); err == nil {
-				claims.Exp = val
-			}
-		case "iat":
-			if val, err := strconv.ParseInt(value, 10, 64); err == nil {
-				claims.Iat = val
-			}
-		}
+// GenerateChallengeToken 生成登录挑战令牌（两步验证或强制改密），不关联会话
+func GenerateChallengeToken(tokenType, subjectType string, subjectID uint, account, userRole string) (string, error) {
+	tokenID, err := GenerateTokenID()
+	if err != nil {
+		return "", err
 	}
-	return claims, nil
+	return tokens().Generate(tokenType, subjectType, subjectID, account, userRole, "", tokenID)
 }
 
-// base64URLDecode 兼容标准 Base64URL 解码
-func base64URLDecode(data string) ([]byte, error) {
-	// 首先尝试 RawURLEncoding
-	if decoded, err := base64.RawURLEncoding.DecodeString(data); err == nil {
-		return decoded, nil
-	}
-	// 如果失败，尝试标准 URLEncoding
-	if decoded, err := base64.URLEncoding.DecodeString(data); err == nil {
-		return decoded, nil
-	}
-	// 如果还是失败，尝试添加填充后再解码
-	switch len(data) % 4 {
-	case 2:
-		data += "=="
-	case 3:
-		data += "="
-	}
-	return base64.URLEncoding.DecodeString(data)
+// ParseToken 解析访问令牌
+func ParseToken(tokenString string) (*Claims, error) {
+	return tokens().Parse(tokenString, TokenTypeAccess)
+}
+
+// ParseRefreshToken 解析刷新令牌
+func ParseRefreshToken(tokenString string) (*Claims, error) {
+	return tokens().Parse(tokenString, TokenTypeRefresh)
+}
+
+// ParseChallengeToken 解析指定类型的登录挑战令牌
+func ParseChallengeToken(tokenString, tokenType string) (*Claims, error) {
+	return tokens().Parse(tokenString, tokenType)
 }
 
-// base64URLEncode 标准 Base64URL 编码
-func base64URLEncode(data []byte) string {
-	return base64.RawURLEncoding.EncodeToString(data)
+// AccessTokenTTL 访问令牌有效期
+func AccessTokenTTL() time.Duration {
+	return tokens().AccessTTL()
 }
 
-// createSignature 创建HMAC-SHA256签名
-func createSignature(message, secret string) string {
-	h := hmac.New(sha256.New, []byte(secret))
-	h.Write([]byte(message))
-	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+// RefreshTokenTTL 刷新令牌有效期
+func RefreshTokenTTL() time.Duration {
+	return tokens().RefreshTTL()
 }
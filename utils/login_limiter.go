@@ -0,0 +1,177 @@
+package utils
+
+import (
+	"sync"
+	"time"
+)
+
+// LoginAttemptState 某个限流键（账号或IP）的失败计数与锁定状态
+type LoginAttemptState struct {
+	Failures    int       // 当前统计窗口内的失败次数
+	WindowStart time.Time // 统计窗口开始时间
+	LockCount   int       // 累计锁定次数，用于递增锁定时长
+	LockedUntil time.Time // 锁定截止时间
+}
+
+// LoginAttemptStore 登录失败计数存储，默认使用进程内存储，多实例部署时可替换为共享存储
+type LoginAttemptStore interface {
+	Get(key string) (LoginAttemptState, bool)
+	Save(key string, state LoginAttemptState, ttl time.Duration)
+	Delete(key string)
+}
+
+// MemoryLoginAttemptStore 进程内登录失败计数存储
+type MemoryLoginAttemptStore struct {
+	mu      sync.Mutex
+	entries map[string]memoryLoginAttempt
+}
+
+type memoryLoginAttempt struct {
+	state     LoginAttemptState
+	expiresAt time.Time
+}
+
+// NewMemoryLoginAttemptStore 创建进程内存储
+func NewMemoryLoginAttemptStore() *MemoryLoginAttemptStore {
+	return &MemoryLoginAttemptStore{entries: make(map[string]memoryLoginAttempt)}
+}
+
+// Get 获取状态，过期记录视为不存在
+func (s *MemoryLoginAttemptStore) Get(key string) (LoginAttemptState, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[key]
+	if !ok {
+		return LoginAttemptState{}, false
+	}
+	if time.Now().After(entry.expiresAt) {
+		delete(s.entries, key)
+		return LoginAttemptState{}, false
+	}
+	return entry.state, true
+}
+
+// Save 保存状态，同时清理已过期的记录
+func (s *MemoryLoginAttemptStore) Save(key string, state LoginAttemptState, ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for k, entry := range s.entries {
+		if now.After(entry.expiresAt) {
+			delete(s.entries, k)
+		}
+	}
+	s.entries[key] = memoryLoginAttempt{state: state, expiresAt: now.Add(ttl)}
+}
+
+// Delete 删除状态
+func (s *MemoryLoginAttemptStore) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+}
+
+// LoginLockPolicy 登录锁定策略
+type LoginLockPolicy struct {
+	MaxFailures     int           // 窗口内允许的最大失败次数
+	Window          time.Duration // 失败次数统计窗口
+	LockDuration    time.Duration // 首次锁定时长，之后每次翻倍
+	MaxLockDuration time.Duration // 锁定时长上限
+}
+
+// lockDuration 计算第 lockCount 次锁定的时长
+func (p LoginLockPolicy) lockDuration(lockCount int) time.Duration {
+	duration := p.LockDuration
+	for i := 1; i < lockCount && duration < p.MaxLockDuration; i++ {
+		duration *= 2
+	}
+	if p.MaxLockDuration > 0 && duration > p.MaxLockDuration {
+		duration = p.MaxLockDuration
+	}
+	return duration
+}
+
+// stateTTL 状态保留时长，需覆盖锁定期和下一次递增锁定的判断
+func (p LoginLockPolicy) stateTTL() time.Duration {
+	return p.Window + 2*p.MaxLockDuration
+}
+
+// LoginLimiter 登录失败限流器，按账号和IP分别计数，达到阈值后递增锁定
+type LoginLimiter struct {
+	mu    sync.Mutex
+	store LoginAttemptStore
+}
+
+// NewLoginLimiter 创建登录限流器
+func NewLoginLimiter(store LoginAttemptStore) *LoginLimiter {
+	return &LoginLimiter{store: store}
+}
+
+// LockedFor 返回键的剩余锁定时长，未锁定返回0
+func (l *LoginLimiter) LockedFor(key string) time.Duration {
+	state, ok := l.store.Get(key)
+	if !ok {
+		return 0
+	}
+	remaining := time.Until(state.LockedUntil)
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// RecordFailure 记录一次失败，达到阈值时锁定并返回锁定时长
+func (l *LoginLimiter) RecordFailure(key string, policy LoginLockPolicy) time.Duration {
+	if policy.MaxFailures <= 0 {
+		return 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	state, _ := l.store.Get(key)
+	if state.WindowStart.IsZero() || now.Sub(state.WindowStart) > policy.Window {
+		state.Failures = 0
+		state.WindowStart = now
+	}
+	state.Failures++
+
+	var locked time.Duration
+	if state.Failures >= policy.MaxFailures {
+		state.LockCount++
+		locked = policy.lockDuration(state.LockCount)
+		state.LockedUntil = now.Add(locked)
+		state.Failures = 0
+		state.WindowStart = time.Time{}
+	}
+
+	l.store.Save(key, state, policy.stateTTL())
+	return locked
+}
+
+// Reset 清除键的失败计数和锁定状态
+func (l *LoginLimiter) Reset(key string) {
+	l.store.Delete(key)
+}
+
+var (
+	loginLimiter     *LoginLimiter
+	loginLimiterOnce sync.Once
+)
+
+// SetLoginAttemptStore 替换登录失败计数存储，需在服务启动时调用
+func SetLoginAttemptStore(store LoginAttemptStore) {
+	loginLimiterOnce.Do(func() {})
+	loginLimiter = NewLoginLimiter(store)
+}
+
+// DefaultLoginLimiter 获取全局登录限流器
+func DefaultLoginLimiter() *LoginLimiter {
+	loginLimiterOnce.Do(func() {
+		loginLimiter = NewLoginLimiter(NewMemoryLoginAttemptStore())
+	})
+	return loginLimiter
+}
@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// 常见弱密码，比较时忽略大小写
+var commonPasswords = []string{
+	"123456", "1234567", "12345678", "123456789", "1234567890", "111111", "000000", "666666", "888888",
+	"123123", "123321", "654321", "112233", "121212", "abc123", "abc12345", "a123456", "a1234567",
+	"password", "password1", "passw0rd", "p@ssw0rd", "admin", "admin123", "admin888", "root", "root123",
+	"qwerty", "qwerty123", "qwertyuiop", "1q2w3e4r", "1qaz2wsx", "zxcvbnm", "asdfghjkl", "iloveyou",
+	"woaini", "woaini1314", "5201314", "aa123456", "qq123456", "welcome", "letmein", "test123",
+}
+
+// PasswordPolicy 密码策略
+type PasswordPolicy struct {
+	MinLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	HistoryCount  int      // 不允许重复使用最近 N 次的密码，0 表示不检查
+	Blacklist     []string // 在内置弱密码之外追加的禁用密码
+}
+
+// Validate 检查密码是否满足策略，account 用于禁止密码与账号相同
+func (p PasswordPolicy) Validate(password, account string) error {
+	if utf8.RuneCountInString(password) < p.MinLength {
+		return fmt.Errorf("密码长度不能少于%d位", p.MinLength)
+	}
+	// bcrypt 只接受不超过72字节的密码，中文等多字节字符按 UTF-8 编码后的字节数计算
+	if len(password) > 72 {
+		return errors.New("密码长度不能超过72字节（英文字母、数字和符号每个1字节，中文每个3字节）")
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsSpace(r):
+			return errors.New("密码不能包含空白字符")
+		default:
+			hasSymbol = true
+		}
+	}
+	if p.RequireUpper && !hasUpper {
+		return errors.New("密码必须包含大写字母")
+	}
+	if p.RequireLower && !hasLower {
+		return errors.New("密码必须包含小写字母")
+	}
+	if p.RequireDigit && !hasDigit {
+		return errors.New("密码必须包含数字")
+	}
+	if p.RequireSymbol && !hasSymbol {
+		return errors.New("密码必须包含特殊字符")
+	}
+
+	lower := strings.ToLower(password)
+	if account != "" && lower == strings.ToLower(account) {
+		return errors.New("密码不能与账号相同")
+	}
+	for _, item := range commonPasswords {
+		if lower == item {
+			return errors.New("密码过于简单，请更换")
+		}
+	}
+	for _, item := range p.Blacklist {
+		if item != "" && lower == strings.ToLower(strings.TrimSpace(item)) {
+			return errors.New("密码过于简单，请更换")
+		}
+	}
+	return nil
+}
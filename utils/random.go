@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+)
+
+// 一次性码字符集，去掉了易混淆的 0/o/1/l/i
+const codeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+// RandomCode 生成指定长度的随机一次性码
+func RandomCode(length int) (string, error) {
+	buf := make([]byte, length)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	for i, b := range buf {
+		buf[i] = codeAlphabet[int(b)%len(codeAlphabet)]
+	}
+	return string(buf), nil
+}
+
+// HashOneTimeCode 一次性码的存储哈希，忽略大小写和首尾空白；
+// 一次性码本身为高熵随机值，使用 SHA-256 即可
+func HashOneTimeCode(code string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(code))))
+	return fmt.Sprintf("%x", sum)
+}
+
+// RandomDigits 生成指定位数的数字验证码
+func RandomDigits(length int) (string, error) {
+	buf := make([]byte, length)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	for i, b := range buf {
+		buf[i] = '0' + b%10
+	}
+	return string(buf), nil
+}
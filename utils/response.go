@@ -43,6 +43,10 @@ func ErrorWithCode(c *gin.Context, code int, message string) {
 		httpStatus = http.StatusForbidden
 	case models.StatusNotFound:
 		httpStatus = http.StatusNotFound
+	case models.StatusConflict:
+		httpStatus = http.StatusConflict
+	case models.StatusUnprocessable:
+		httpStatus = http.StatusUnprocessableEntity
 	case models.StatusError:
 		httpStatus = http.StatusInternalServerError
 	}
@@ -76,3 +80,36 @@ func Unauthorized(c *gin.Context, message string) {
 		Message: message,
 	})
 }
+
+// Conflict 与当前资源状态冲突
+func Conflict(c *gin.Context, message string) {
+	c.JSON(http.StatusConflict, models.Response{
+		Code:    models.StatusConflict,
+		Message: message,
+	})
+}
+
+// UnprocessableEntity 请求内容无法处理
+func UnprocessableEntity(c *gin.Context, message string) {
+	c.JSON(http.StatusUnprocessableEntity, models.Response{
+		Code:    models.StatusUnprocessable,
+		Message: message,
+	})
+}
+
+// ValidationFailed 字段校验失败，data 中返回每个字段的错误
+func ValidationFailed(c *gin.Context, errs models.ValidationErrors) {
+	c.JSON(http.StatusUnprocessableEntity, models.Response{
+		Code:    models.StatusUnprocessable,
+		Message: errs.Error(),
+		Data:    errs,
+	})
+}
+
+// TooManyRequests 请求过于频繁
+func TooManyRequests(c *gin.Context, message string) {
+	c.JSON(http.StatusTooManyRequests, models.Response{
+		Code:    models.StatusTooMany,
+		Message: message,
+	})
+}
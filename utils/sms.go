@@ -0,0 +1,123 @@
+package utils
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"tangsong-esports/config"
+	"time"
+)
+
+// SMSSender 短信发送接口，接入真实短信服务商时实现该接口并通过 SetSMSSender 注册
+type SMSSender interface {
+	Send(phone, message string) error
+}
+
+// smsCodePattern 匹配短信中的验证码
+var smsCodePattern = regexp.MustCompile(`\d{4,}`)
+
+// LogSMSSender 仅将短信内容写入日志，用于开发环境；验证码打码后写入，日志中无法读取验证码
+type LogSMSSender struct{}
+
+// Send 写入日志
+func (LogSMSSender) Send(phone, message string) error {
+	redacted := smsCodePattern.ReplaceAllStringFunc(message, func(code string) string {
+		return strings.Repeat("*", len(code))
+	})
+	log.Printf("[SMS] 发送至 %s: %s", phone, redacted)
+	return nil
+}
+
+// FileSMSSender 将短信追加写入文件，便于开发和测试时读取验证码
+type FileSMSSender struct {
+	mu   sync.Mutex
+	Path string
+}
+
+// Send 追加写入文件，每条短信一行
+func (s *FileSMSSender) Send(phone, message string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintf(f, "%s\t%s\t%s\n", time.Now().Format(time.RFC3339), phone, message)
+	return err
+}
+
+// unavailableSMSSender 短信发送器配置无效时使用，所有发送均失败
+type unavailableSMSSender struct {
+	err error
+}
+
+// Send 返回初始化时的错误
+func (s unavailableSMSSender) Send(phone, message string) error {
+	return s.err
+}
+
+// NewSMSSender 根据配置创建短信发送器；log 和 file 不会真正发出短信，生产模式下不允许使用
+func NewSMSSender(cfg config.SMSConfig, mode string) (SMSSender, error) {
+	if mode == "release" {
+		switch cfg.Provider {
+		case "", "log", "file":
+			return nil, fmt.Errorf("生产环境必须配置真实的短信服务商，当前为 %q", cfg.Provider)
+		}
+	}
+	switch cfg.Provider {
+	case "", "log":
+		return LogSMSSender{}, nil
+	case "file":
+		if cfg.FilePath == "" {
+			return nil, fmt.Errorf("未配置短信文件路径")
+		}
+		return &FileSMSSender{Path: cfg.FilePath}, nil
+	default:
+		return nil, fmt.Errorf("不支持的短信服务商: %s", cfg.Provider)
+	}
+}
+
+var (
+	smsSender     SMSSender
+	smsSenderOnce sync.Once
+)
+
+// SetSMSSender 替换短信发送器，需在服务启动时调用
+func SetSMSSender(sender SMSSender) {
+	smsSenderOnce.Do(func() {})
+	smsSender = sender
+}
+
+// InitSMSSender 服务启动时按配置创建短信发送器，配置无效时拒绝启动；已通过 SetSMSSender 注册发送器时跳过
+func InitSMSSender() {
+	smsSenderOnce.Do(func() {
+		sender, err := NewSMSSender(config.AppConfig.SMS, config.AppConfig.Mode)
+		if err != nil {
+			log.Fatal("短信发送器初始化失败:", err)
+		}
+		smsSender = sender
+	})
+}
+
+// DefaultSMSSender 获取全局短信发送器，未设置时按配置创建，配置无效时发送一律失败
+func DefaultSMSSender() SMSSender {
+	smsSenderOnce.Do(func() {
+		sender, err := NewSMSSender(config.AppConfig.SMS, config.AppConfig.Mode)
+		if err != nil {
+			log.Printf("[SMS] 短信发送器初始化失败: %v", err)
+			sender = unavailableSMSSender{err: err}
+		}
+		smsSender = sender
+	})
+	return smsSender
+}
@@ -0,0 +1,164 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"tangsong-esports/config"
+	"time"
+)
+
+// ErrFileNotFound 存储中不存在该文件
+var ErrFileNotFound = errors.New("文件不存在")
+
+// Storage 文件存储接口，接入对象存储（如 S3 兼容服务）时实现该接口并通过 SetStorage 注册
+// key 为以 / 分隔的相对路径，如 orders/12/xxx.jpg
+type Storage interface {
+	Put(key string, r io.Reader, contentType string) error
+	Get(key string) (io.ReadCloser, error)
+	Delete(key string) error
+}
+
+// LocalStorage 将文件存储在本地目录
+type LocalStorage struct {
+	Root string
+}
+
+// path 将 key 转换为本地路径，拒绝跳出根目录的 key
+func (s *LocalStorage) path(key string) (string, error) {
+	cleaned := filepath.Clean("/" + key)
+	if cleaned == "/" || strings.Contains(key, "..") {
+		return "", fmt.Errorf("无效的文件路径: %s", key)
+	}
+	return filepath.Join(s.Root, filepath.FromSlash(cleaned)), nil
+}
+
+// Put 写入文件，先写临时文件再重命名，避免读到写了一半的文件
+func (s *LocalStorage) Put(key string, r io.Reader, contentType string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Get 读取文件
+func (s *LocalStorage) Get(key string) (io.ReadCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrFileNotFound
+	}
+	return f, err
+}
+
+// Delete 删除文件，文件不存在时不报错
+func (s *LocalStorage) Delete(key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// NewStorage 根据配置创建文件存储
+func NewStorage(cfg config.StorageConfig) (Storage, error) {
+	switch cfg.Provider {
+	case "", "local":
+		if cfg.LocalDir == "" {
+			return nil, fmt.Errorf("未配置本地存储目录")
+		}
+		return &LocalStorage{Root: cfg.LocalDir}, nil
+	default:
+		return nil, fmt.Errorf("不支持的文件存储: %s", cfg.Provider)
+	}
+}
+
+var (
+	storage     Storage
+	storageOnce sync.Once
+)
+
+// SetStorage 替换文件存储，需在服务启动时调用
+func SetStorage(s Storage) {
+	storageOnce.Do(func() {})
+	storage = s
+}
+
+// DefaultStorage 获取全局文件存储，未设置时按配置创建
+func DefaultStorage() Storage {
+	storageOnce.Do(func() {
+		s, err := NewStorage(config.AppConfig.Storage)
+		if err != nil {
+			log.Printf("[Storage] 文件存储初始化失败，改为本地 uploads 目录: %v", err)
+			s = &LocalStorage{Root: "uploads"}
+		}
+		storage = s
+	})
+	return storage
+}
+
+// fileSignSecret 文件链接签名密钥
+func fileSignSecret() []byte {
+	if secret := config.AppConfig.Storage.SignSecret; secret != "" {
+		return []byte(secret)
+	}
+	return []byte(config.AppConfig.JWT.Secret)
+}
+
+// fileSignature 计算 key 和过期时间的签名
+func fileSignature(key string, expires int64) string {
+	mac := hmac.New(sha256.New, fileSignSecret())
+	mac.Write([]byte(key + "\n" + strconv.FormatInt(expires, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignFileURL 生成带过期时间和签名的文件访问链接，持有链接即可在有效期内访问文件
+func SignFileURL(key string) string {
+	minutes := config.AppConfig.Storage.URLExpireMinutes
+	if minutes <= 0 {
+		minutes = 30
+	}
+	expires := time.Now().Add(time.Duration(minutes) * time.Minute).Unix()
+	return fmt.Sprintf("/api/v1/files/%s?expires=%d&signature=%s", key, expires, fileSignature(key, expires))
+}
+
+// VerifyFileSignature 校验文件访问链接的签名和有效期
+func VerifyFileSignature(key, expires, signature string) bool {
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > expiresAt {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(fileSignature(key, expiresAt)))
+}
@@ -0,0 +1,179 @@
+package utils
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"hash"
+	"testing"
+	"time"
+)
+
+// RFC 4226 附录 D 的测试向量
+func TestHOTPRFC4226(t *testing.T) {
+	key := []byte("12345678901234567890")
+	expected := []string{
+		"755224", "287082", "359152", "969429", "338314",
+		"254676", "287922", "162583", "399871", "520489",
+	}
+	for counter, want := range expected {
+		if got := HOTP(key, uint64(counter), 6, sha1.New); got != want {
+			t.Errorf("HOTP(counter=%d) = %s, want %s", counter, got, want)
+		}
+	}
+}
+
+// RFC 6238 附录 B 的测试向量，8 位验证码
+func TestTOTPRFC6238(t *testing.T) {
+	keys := map[string][]byte{
+		"SHA1":   []byte("12345678901234567890"),
+		"SHA256": []byte("12345678901234567890123456789012"),
+		"SHA512": []byte("1234567890123456789012345678901234567890123456789012345678901234"),
+	}
+	hashes := map[string]func() hash.Hash{
+		"SHA1":   sha1.New,
+		"SHA256": sha256.New,
+		"SHA512": sha512.New,
+	}
+	cases := []struct {
+		unix int64
+		mode string
+		want string
+	}{
+		{59, "SHA1", "94287082"},
+		{59, "SHA256", "46119246"},
+		{59, "SHA512", "90693936"},
+		{1111111109, "SHA1", "07081804"},
+		{1111111109, "SHA256", "68084774"},
+		{1111111109, "SHA512", "25091201"},
+		{1111111111, "SHA1", "14050471"},
+		{1111111111, "SHA256", "67062674"},
+		{1111111111, "SHA512", "99943326"},
+		{1234567890, "SHA1", "89005924"},
+		{1234567890, "SHA256", "91819424"},
+		{1234567890, "SHA512", "93441116"},
+		{2000000000, "SHA1", "69279037"},
+		{2000000000, "SHA256", "90698825"},
+		{2000000000, "SHA512", "38618901"},
+		{20000000000, "SHA1", "65353130"},
+		{20000000000, "SHA256", "77737706"},
+		{20000000000, "SHA512", "47863826"},
+	}
+	for _, tc := range cases {
+		counter := TOTPCounter(time.Unix(tc.unix, 0))
+		if got := HOTP(keys[tc.mode], counter, 8, hashes[tc.mode]); got != tc.want {
+			t.Errorf("TOTP %s at %d = %s, want %s", tc.mode, tc.unix, got, tc.want)
+		}
+	}
+}
+
+// TOTPCode 使用 base32 密钥和 6 位验证码，结果为 RFC 6238 SHA1 向量的后 6 位
+func TestTOTPCode(t *testing.T) {
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+	cases := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for unix, want := range cases {
+		got, err := TOTPCode(secret, time.Unix(unix, 0))
+		if err != nil {
+			t.Fatalf("TOTPCode(%d) error: %v", unix, err)
+		}
+		if got != want {
+			t.Errorf("TOTPCode(%d) = %s, want %s", unix, got, want)
+		}
+	}
+
+	// 小写、空格和填充符不影响解码
+	lower := "gezd gnbv gy3t qojq gezd gnbv gy3t qojq===="
+	if got, err := TOTPCode(lower, time.Unix(59, 0)); err != nil || got != "287082" {
+		t.Errorf("TOTPCode(lowercase secret) = %s, %v, want 287082", got, err)
+	}
+
+	if _, err := TOTPCode("not base32!", time.Unix(59, 0)); err == nil {
+		t.Error("TOTPCode with invalid secret should fail")
+	}
+}
+
+func TestValidateTOTPWindow(t *testing.T) {
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+	now := time.Unix(1234567890, 0)
+	current := TOTPCounter(now)
+
+	codeAt := func(t0 time.Time) string {
+		code, err := TOTPCode(secret, t0)
+		if err != nil {
+			t.Fatalf("TOTPCode error: %v", err)
+		}
+		return code
+	}
+
+	cases := []struct {
+		name   string
+		at     time.Time
+		want   bool
+		offset int64
+	}{
+		{"当前时间步", now, true, 0},
+		{"上一个时间步", now.Add(-TOTPPeriod * time.Second), true, -1},
+		{"下一个时间步", now.Add(TOTPPeriod * time.Second), true, 1},
+		{"超出前偏移", now.Add(-2 * TOTPPeriod * time.Second), false, 0},
+		{"超出后偏移", now.Add(2 * TOTPPeriod * time.Second), false, 0},
+	}
+	for _, tc := range cases {
+		counter, ok := ValidateTOTP(secret, codeAt(tc.at), now, 0)
+		if ok != tc.want {
+			t.Errorf("%s: ValidateTOTP ok = %v, want %v", tc.name, ok, tc.want)
+			continue
+		}
+		if ok && counter != uint64(int64(current)+tc.offset) {
+			t.Errorf("%s: counter = %d, want %d", tc.name, counter, int64(current)+tc.offset)
+		}
+	}
+
+	if _, ok := ValidateTOTP(secret, "12345", now, 0); ok {
+		t.Error("code with wrong length should be rejected")
+	}
+	if _, ok := ValidateTOTP("not base32!", codeAt(now), now, 0); ok {
+		t.Error("invalid secret should be rejected")
+	}
+}
+
+func TestValidateTOTPReplay(t *testing.T) {
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+	now := time.Unix(1234567890, 0)
+	code, err := TOTPCode(secret, now)
+	if err != nil {
+		t.Fatalf("TOTPCode error: %v", err)
+	}
+
+	counter, ok := ValidateTOTP(secret, code, now, 0)
+	if !ok {
+		t.Fatal("first use should be accepted")
+	}
+
+	// 同一验证码在有效期内再次提交视为重放
+	if _, ok := ValidateTOTP(secret, code, now.Add(10*time.Second), counter); ok {
+		t.Error("reused code should be rejected")
+	}
+
+	// 已使用过较新的验证码后，较早时间步的验证码也不再接受
+	previous, err := TOTPCode(secret, now.Add(-TOTPPeriod*time.Second))
+	if err != nil {
+		t.Fatalf("TOTPCode error: %v", err)
+	}
+	if _, ok := ValidateTOTP(secret, previous, now, counter); ok {
+		t.Error("code older than last used counter should be rejected")
+	}
+
+	// 下一个时间步的新验证码仍然可用
+	next, err := TOTPCode(secret, now.Add(TOTPPeriod*time.Second))
+	if err != nil {
+		t.Fatalf("TOTPCode error: %v", err)
+	}
+	if got, ok := ValidateTOTP(secret, next, now.Add(TOTPPeriod*time.Second), counter); !ok || got != counter+1 {
+		t.Errorf("next step code: counter = %d, ok = %v, want %d, true", got, ok, counter+1)
+	}
+}